@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	metrics.describe("ethereal_adopted_pods_total", "counter", "Existing pods adopted through spec.selector.")
+}
+
+// adoptedTemplate - ה-snapshot של פוד שאומץ: ה-labels (בשביל Services שבוחרים אותו) וה-spec.
+// נשמר ב-status.adoption.template ומחליף את התבנית שנבנית מה-spec של ה-EtherealPod
+type adoptedTemplate struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Spec   corev1.PodSpec    `json:"spec"`
+}
+
+func readAdoptedTemplate(item unstructured.Unstructured) *adoptedTemplate {
+	m, found, _ := unstructured.NestedMap(item.Object, "status", "adoption", "template")
+	if !found {
+		return nil
+	}
+	a := &adoptedTemplate{}
+	if err := fromUnstructured(m, a); err != nil {
+		slog.Warn("Ignoring invalid status.adoption.template", "name", item.GetName(), "error", err)
+		return nil
+	}
+	return a
+}
+
+// adoptPods - spec.selector: פודים שנוצרו ידנית ותואמים ל-selector עוברים לניהול של ה-EtherealPod.
+// ה-apply נוגע רק ב-metadata, אז הפוד ממשיך לרוץ בלי restart. ה-spec של הפוד הראשון שאומץ
+// נשמר כ-snapshot, וממנו מקימים את ההתחיות. הפוד מקבל את ה-hash של תבנית ה-snapshot, כך ש-restart
+// או שינוי placement מחליפים אותו כמו כל פוד אחר. מאמצים רק עד spec.replicas, כדי שהקטנה לא תמחק פודים ותיקים
+func adoptPods(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured, spec map[string]interface{}) {
+	raw, found, _ := unstructured.NestedMap(spec, "selector")
+	if !found {
+		// בלי selector חוזרים לתבנית מה-spec. פודים שכבר אומצו נשארים עד שהם מתים
+		if _, adopted, _ := unstructured.NestedMap(item.Object, "status", "adoption"); adopted {
+			if err := patchStatus(ctx, dyn, *item, map[string]interface{}{"adoption": nil}); err != nil {
+				slog.Warn("Failed to clear adoption snapshot", "name", item.GetName(), "error", err)
+				return
+			}
+			unstructured.RemoveNestedField(item.Object, "status", "adoption")
+		}
+		return
+	}
+	var ls metav1.LabelSelector
+	if err := fromUnstructured(raw, &ls); err != nil {
+		slog.Warn("Ignoring invalid spec.selector", "name", item.GetName(), "error", err)
+		return
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil || selector.Empty() {
+		// selector ריק תואם לכל הפודים ב-namespace
+		slog.Warn("Ignoring invalid spec.selector", "name", item.GetName(), "error", err)
+		return
+	}
+
+	list, err := client.CoreV1().Pods(item.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		slog.Error("Failed to list pods for adoption", "name", item.GetName(), "error", err)
+		return
+	}
+	var candidates []*corev1.Pod
+	for i := range list.Items {
+		if adoptable(&list.Items[i]) {
+			candidates = append(candidates, &list.Items[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	managed, err := listManagedPods(ctx, client, *item)
+	if err != nil {
+		slog.Error("Failed to list pods", "name", item.GetName(), "error", err)
+		return
+	}
+	room := desiredReplicas(spec) - classifyPods(*item, managed, podTemplate{}, time.Now()).alive()
+	// הוותיקים קודם
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+	})
+
+	var tmpl *podTemplate
+	for _, pod := range candidates {
+		if room <= 0 {
+			slog.Debug("Not adopting pod, EtherealPod already has all its replicas", "name", item.GetName(), "pod", pod.Name)
+			continue
+		}
+		if _, found, _ := unstructured.NestedMap(item.Object, "status", "adoption", "template"); !found {
+			if err := recordSnapshot(ctx, dyn, item, pod); err != nil {
+				slog.Warn("Failed to record adoption snapshot", "name", item.GetName(), "pod", pod.Name, "error", err)
+				return
+			}
+		}
+		if tmpl == nil {
+			// אותה תבנית ש-reconcile תבנה מה-snapshot, אחרת הפוד ייראה כ-drift כבר בסבב הבא
+			t := applyRollback(*item, desiredTemplate(*item, spec))
+			if t.configHash, err = computeConfigHash(ctx, client, item.GetNamespace(), t); err != nil {
+				slog.Error("Failed to read referenced config", "name", item.GetName(), "error", err)
+				return
+			}
+			tmpl = &t
+		}
+
+		// רק metadata - אין לאופרטור בעלות על אף שדה ב-spec של הפוד
+		ac := corev1ac.Pod(pod.Name, pod.Namespace)
+		meta := metav1.ObjectMeta{
+			Labels:          managedLabels(*item),
+			Annotations:     adoptionAnnotations(*tmpl, time.Now()),
+			OwnerReferences: ownerReferences(*item, true),
+		}
+		if err := toApplyConfiguration(map[string]interface{}{"metadata": meta}, ac); err != nil {
+			slog.Error("Failed to build pod adoption", "name", item.GetName(), "pod", pod.Name, "error", err)
+			continue
+		}
+		if _, err := client.CoreV1().Pods(pod.Namespace).Apply(ctx, ac, applyOptions("pods", pod.Namespace, pod.Name, "reason", "Adopted")); err != nil {
+			if !reportApplyConflict(ctx, client, *item, "pods", pod.Name, err) {
+				slog.Error("Failed to adopt pod", "name", item.GetName(), "pod", pod.Name, "error", err)
+			}
+			continue
+		}
+		room--
+		slog.Info("Adopted pod", "name", item.GetName(), "pod", pod.Name)
+		metrics.add("ethereal_adopted_pods_total", map[string]string{"namespace": item.GetNamespace()}, 1)
+		recordEvent(ctx, client, *item, corev1.EventTypeNormal, "Adopted", fmt.Sprintf("Adopted pod %s matching spec.selector", pod.Name))
+	}
+}
+
+// annotationAdoptedAt - מתי הפוד אומץ. ה-ttl נספר מכאן ולא מתחילת הריצה שלו, אחרת פוד ותיק
+// היה מוחלף כבר בסבב הראשון אחרי האימוץ
+const annotationAdoptedAt = "sunday.com/adopted-at"
+
+func adoptionAnnotations(tmpl podTemplate, now time.Time) map[string]string {
+	annotations := tmpl.annotations()
+	annotations[annotationAdoptedAt] = now.UTC().Format(time.RFC3339)
+	return annotations
+}
+
+// adoptable - פוד חי שאף בקר אחר לא מנהל: לא של EtherealPod, ולא של ReplicaSet/StatefulSet/Job וכו'
+func adoptable(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+		return false
+	}
+	return pod.Labels[labelEtherealPod] == "" && metav1.GetControllerOf(pod) == nil
+}
+
+// recordSnapshot שומרת את הפוד כתבנית ב-status.adoption, ומעדכנת את item כדי שהסבב הזה כבר ישתמש בה
+func recordSnapshot(ctx context.Context, dyn dynamic.Interface, item *unstructured.Unstructured, pod *corev1.Pod) error {
+	snapshot := adoptedTemplate{Labels: map[string]string{}, Spec: *pod.Spec.DeepCopy()}
+	for k, v := range pod.Labels {
+		snapshot.Labels[k] = v
+	}
+	// מה שה-scheduler וה-admission ממלאים יתמלא מחדש בפוד החדש
+	snapshot.Spec.NodeName = ""
+	snapshot.Spec.EphemeralContainers = nil
+	snapshot.Spec.Volumes = withoutServiceAccountToken(snapshot.Spec.Volumes)
+	for _, containers := range [][]corev1.Container{snapshot.Spec.InitContainers, snapshot.Spec.Containers} {
+		for i := range containers {
+			containers[i].VolumeMounts = withoutServiceAccountTokenMount(containers[i].VolumeMounts)
+		}
+	}
+
+	template, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&snapshot)
+	if err != nil {
+		return err
+	}
+	adoption := map[string]interface{}{
+		"template": template,
+		"from":     pod.Name,
+		"at":       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := patchStatus(ctx, dyn, *item, map[string]interface{}{"adoption": adoption}); err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(item.Object, adoption, "status", "adoption")
+}
+
+// ה-volume של ה-token של ה-service account (kube-api-access-xxxxx) מוזרק ב-admission לכל פוד חדש
+func withoutServiceAccountToken(volumes []corev1.Volume) []corev1.Volume {
+	var kept []corev1.Volume
+	for _, v := range volumes {
+		if !strings.HasPrefix(v.Name, "kube-api-access-") {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func withoutServiceAccountTokenMount(mounts []corev1.VolumeMount) []corev1.VolumeMount {
+	var kept []corev1.VolumeMount
+	for _, m := range mounts {
+		if !strings.HasPrefix(m.Name, "kube-api-access-") {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// apply מלבישה את ה-snapshot על הפוד שנבנה מהתבנית: ה-spec של הפוד שאומץ, ה-labels שלו
+// (חוץ מאלה שהאופרטור מנהל), ו-placement של ה-EtherealPod אם יש - בנוסף למה שהיה בפוד, לא במקומו
+func (a *adoptedTemplate) apply(pod *corev1.Pod) {
+	spec := a.Spec.DeepCopy()
+	spec.Affinity = mergeAffinity(spec.Affinity, pod.Spec.Affinity)
+	spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, pod.Spec.TopologySpreadConstraints...)
+	pod.Spec = *spec
+	for k, v := range a.Labels {
+		if k != "managed-by" && k != labelEtherealPod && k != labelHomeCluster {
+			pod.Labels[k] = v
+		}
+	}
+}
+
+// mergeAffinity מוסיפה ל-affinity של ה-snapshot את מה שהאופרטור בונה (spec.placement, avoidNode).
+// required של ה-snapshot נשאר: פוד שהיה נעול ל-node pool מסוים לא יקום מחוץ לו
+func mergeAffinity(snapshot, operator *corev1.Affinity) *corev1.Affinity {
+	if operator == nil {
+		return snapshot
+	}
+	if snapshot == nil {
+		return operator
+	}
+	merged := snapshot.DeepCopy()
+	if operator.NodeAffinity != nil {
+		if merged.NodeAffinity == nil {
+			merged.NodeAffinity = &corev1.NodeAffinity{}
+		}
+		merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			merged.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, operator.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	if operator.PodAntiAffinity != nil {
+		if merged.PodAntiAffinity == nil {
+			merged.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, operator.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution...)
+		merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			merged.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, operator.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution...)
+	}
+	return merged
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// legacyPod - פוד שמישהו יצר ידנית, רץ ומוכן
+func legacyPod(name string, created time.Time, owners ...metav1.OwnerReference) *corev1.Pod {
+	now := metav1.Now()
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name),
+			Labels:            map[string]string{"app": "legacy-sunday"},
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences:   owners,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      "node-1",
+			RestartPolicy: corev1.RestartPolicyAlways,
+			Containers: []corev1.Container{{
+				Name: "app", Image: "sunday-app:v0",
+				VolumeMounts: []corev1.VolumeMount{{Name: "kube-api-access-x7k2p", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"}},
+			}},
+			Volumes: []corev1.Volume{{Name: "kube-api-access-x7k2p"}},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: now}},
+		},
+	}
+}
+
+func TestAdoption(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "legacy-sunday"}},
+	})
+	now := time.Now()
+	controlled := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs", UID: "rs", Controller: ptr(true)}
+	for _, pod := range []*corev1.Pod{
+		legacyPod("legacy", now.Add(-2*time.Hour)),
+		legacyPod("legacy-2", now.Add(-time.Hour)),                      // מעבר ל-spec.replicas
+		legacyPod("from-replicaset", now.Add(-3*time.Hour), controlled), // יש לו כבר בקר
+	} {
+		if err := c.client.Tracker().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.settle(t)
+
+	owner := c.item(t)
+	adopted := map[string]bool{}
+	for _, pod := range c.pods(t) {
+		if pod.Labels[labelEtherealPod] == "ghost" {
+			adopted[pod.Name] = metav1.IsControlledBy(&pod, &owner)
+		}
+	}
+	if len(adopted) != 1 || !adopted["legacy"] {
+		t.Fatalf("adopted %v, want only the oldest unowned pod, controlled by the EtherealPod", adopted)
+	}
+	if from, _, _ := unstructured.NestedString(c.item(t).Object, "status", "adoption", "from"); from != "legacy" {
+		t.Errorf("status.adoption.from = %q", from)
+	}
+
+	// האופרטור לא מקים פוד נוסף ולא מחליף את הפוד שאומץ
+	item := c.item(t)
+	queue := reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+	if len(queue) != 0 || len(c.deleted()) != 0 {
+		t.Fatalf("adopted pod was not left alone: queued %d, deleted %v", len(queue), c.deleted())
+	}
+
+	// מהרגע שאומץ הוא מרופא כמו כל פוד אחר, מתוך ה-snapshot. legacy-2 נמחק קודם, אחרת הוא היה מאומץ במקומו
+	for _, name := range []string{"legacy-2", "legacy"} {
+		if err := c.client.CoreV1().Pods("default").Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.settle(t)
+	var resurrected *corev1.Pod
+	for _, pod := range c.pods(t) {
+		if pod.Labels[labelEtherealPod] == "ghost" {
+			resurrected = pod.DeepCopy()
+		}
+	}
+	if resurrected == nil {
+		t.Fatal("the adopted pod was not resurrected")
+	}
+	container := resurrected.Spec.Containers[0]
+	if container.Name != "app" || container.Image != "sunday-app:v0" || resurrected.Spec.RestartPolicy != corev1.RestartPolicyAlways {
+		t.Errorf("resurrected pod does not follow the snapshot: %+v", resurrected.Spec)
+	}
+	if resurrected.Labels["app"] != "legacy-sunday" {
+		t.Errorf("resurrected pod lost the original labels: %v", resurrected.Labels)
+	}
+	if resurrected.Spec.NodeName != "" || len(resurrected.Spec.Volumes) != 0 || len(container.VolumeMounts) != 0 {
+		t.Errorf("snapshot kept node or service account token: %+v", resurrected.Spec)
+	}
+}
+
+// פוד שאומץ נושא את ה-hash של ה-snapshot, אז restart מחליף אותו כמו כל פוד אחר
+func TestAdoptedPodFollowsRestarts(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "legacy-sunday"}},
+	})
+	if err := c.client.Tracker().Add(legacyPod("legacy", time.Now().Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	c.settle(t)
+
+	c.edit(t, int64(1), "spec", "restartGeneration")
+	item := c.item(t)
+	queue := reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+	if len(queue) != 1 || queue[0].reason != reasonManualRestart || !queue[0].rollout {
+		t.Fatalf("queue = %+v, want one ManualRestart replacement of the adopted pod", queue)
+	}
+
+	c.settle(t)
+	c.settle(t)
+	pods := c.pods(t)
+	if len(pods) != 1 || pods[0].Name == "legacy" {
+		t.Fatalf("after the restart got %d pods, want only the replacement of the adopted pod", len(pods))
+	}
+	if pods[0].Spec.Containers[0].Image != "sunday-app:v0" {
+		t.Errorf("replacement does not follow the snapshot: %+v", pods[0].Spec)
+	}
+}
+
+// placement של ה-EtherealPod ו-avoidNode מתווספים ל-affinity של הפוד שאומץ, ולא מוחקים אותו
+func TestAdoptedAffinityIsMerged(t *testing.T) {
+	pool := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"gpu"}}
+	legacy := legacyPod("legacy", time.Now())
+	legacy.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{pool}}},
+		}},
+		PodAffinity: &corev1.PodAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}}, TopologyKey: corev1.LabelHostname,
+		}}},
+	}
+
+	item := unstructured.Unstructured{}
+	item.SetName("ghost")
+	item.SetNamespace("default")
+	tmpl := podTemplate{
+		adopted:   &adoptedTemplate{Labels: legacy.Labels, Spec: legacy.Spec},
+		placement: &podPlacement{AntiAffinity: "preferred"},
+		avoidNode: "node-1",
+	}
+	affinity := desiredPod(item, tmpl).Spec.Affinity
+
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("the adopted pod's required node affinity was dropped: %+v", affinity)
+	}
+	if affinity.PodAffinity == nil || len(affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("the adopted pod's pod affinity was dropped: %+v", affinity.PodAffinity)
+	}
+	if len(affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("avoidNode was not added: %+v", affinity.NodeAffinity)
+	}
+	if affinity.PodAntiAffinity == nil || len(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 1 {
+		t.Errorf("spec.placement anti-affinity was not added: %+v", affinity.PodAntiAffinity)
+	}
+	if legacy.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution != nil {
+		t.Error("merging changed the snapshot itself")
+	}
+}
+
+// spec.ttl נספר מרגע האימוץ: אימוץ של פוד ותיק לא מפעיל restart מיד
+func TestAdoptedPodTTLCountsFromAdoption(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "legacy-sunday"}},
+		"ttl":      int64(3600),
+	})
+	legacy := legacyPod("legacy", time.Now().Add(-48*time.Hour))
+	legacy.Status.StartTime = &metav1.Time{Time: legacy.CreationTimestamp.Time}
+	if err := c.client.Tracker().Add(legacy); err != nil {
+		t.Fatal(err)
+	}
+	c.settle(t)
+
+	pods := c.pods(t)
+	if len(pods) != 1 || pods[0].Name != "legacy" {
+		t.Fatalf("got %d pods after adoption, want only the adopted pod", len(pods))
+	}
+	if _, err := time.Parse(time.RFC3339, pods[0].Annotations[annotationAdoptedAt]); err != nil {
+		t.Errorf("adopted pod has no %s: %v", annotationAdoptedAt, pods[0].Annotations)
+	}
+	if !podExpired(&pods[0], time.Hour, time.Now().Add(time.Hour+time.Minute)) {
+		t.Error("the adopted pod does not expire an hour after its adoption")
+	}
+}
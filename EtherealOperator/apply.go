@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// fieldManager הוא השם שתחתיו האופרטור מחזיק שדות ב-server-side apply. כלים אחרים
+// (sidecar injectors למשל) יכולים להחזיק שדות אחרים באותו אובייקט בלי שנדרוס אותם
+const fieldManager = "ethereal-operator"
+
+func init() {
+	metrics.describe("ethereal_apply_conflicts_total", "counter", "Server-side apply conflicts with other field managers, by resource.")
+}
+
+// applyOptions - בלי force: שדה שמנהל אחר מחזיק הוא קונפליקט שמדווחים עליו, לא דורסים
+func applyOptions(resource, namespace, name string, attrs ...any) metav1.ApplyOptions {
+	return metav1.ApplyOptions{FieldManager: fieldManager, DryRun: planned("apply", resource, namespace, name, attrs...)}
+}
+
+// reportApplyConflict מדווחת על קונפליקט של apply ב-Event, בלוג ובמטריקה. מחזירה false אם זו לא שגיאת קונפליקט
+func reportApplyConflict(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, resource, name string, err error) bool {
+	if !apierrors.IsConflict(err) {
+		return false
+	}
+	slog.Warn("Server-side apply conflict", "name", item.GetName(), "resource", resource, "object", name, "error", err)
+	metrics.add("ethereal_apply_conflicts_total", map[string]string{"resource": resource}, 1)
+	recordEvent(ctx, client, item, corev1.EventTypeWarning, "FieldConflict",
+		fmt.Sprintf("Apply of %s %s conflicts with another field manager: %v", resource, name, err))
+	return true
+}
+
+// applyPod יוצרת את הפוד ב-apply. ל-apply אין generateName, אז השם נוצר כאן באותה צורה
+// ובודקים שהוא פנוי - אחרת apply היה מעדכן פוד קיים במקום ליצור חדש
+func applyPod(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, pod *corev1.Pod) (*corev1.Pod, error) {
+	pods := client.CoreV1().Pods(item.GetNamespace())
+	name := ""
+	for attempt := 0; attempt < 5 && name == ""; attempt++ {
+		candidate := pod.GenerateName + randomSuffix(5)
+		if _, err := pods.Get(ctx, candidate, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+			name = candidate
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("could not find a free pod name for %s", pod.GenerateName)
+	}
+
+	ac := corev1ac.Pod(name, item.GetNamespace())
+	if err := toApplyConfiguration(pod, ac); err != nil {
+		return nil, err
+	}
+	ac.WithName(name).WithNamespace(item.GetNamespace()).WithGenerateName("")
+	ac.Status = nil
+
+	created, err := pods.Apply(ctx, ac, applyOptions("pods", item.GetNamespace(), name, "image", pod.Spec.Containers[0].Image))
+	if err != nil {
+		reportApplyConflict(ctx, client, item, "pods", name, err)
+		return nil, err
+	}
+	return created, nil
+}
+
+// toApplyConfiguration ממירה אובייקט רגיל ל-apply configuration דרך JSON - לשניהם אותם שדות.
+// שדות ריקים עם omitempty לא נשלחים, ולכן האופרטור לא לוקח עליהם בעלות
+func toApplyConfiguration(obj, ac interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ac)
+}
+
+// nameRand מגרילה סיומות לשמות. --simulate מחליפה אותה במקור קבוע, כדי שהפלט יחזור על עצמו
+var nameRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// randomSuffix כמו הסיומת של generateName: בלי תנועות ובלי תווים שקל לבלבל
+func randomSuffix(n int) string {
+	const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[nameRand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// ownedStatus שומרת את ה-status המלא שהאופרטור מנהל לכל אובייקט. כל עדכון חלקי (כמו merge patch)
+// ממוזג לתוכו וה-status כולו נשלח ב-apply, כי apply מוחק שדות של המנהל שלא נשלחו
+type ownedStatus struct {
+	mu    sync.Mutex
+	byUID map[types.UID]map[string]interface{}
+}
+
+var statuses = &ownedStatus{byUID: map[types.UID]map[string]interface{}{}}
+
+// merge מחילה את העדכון בסמנטיקה של merge patch (nil מוחק) ומחזירה עותק של ה-status המלא.
+// בפעם הראשונה מתחילים מה-status הקיים של האובייקט
+func (s *ownedStatus) merge(obj unstructured.Unstructured, update map[string]interface{}) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.byUID[obj.GetUID()]
+	if !ok {
+		current, _, _ = unstructured.NestedMap(obj.Object, "status")
+		if current == nil {
+			current = map[string]interface{}{}
+		}
+	}
+	current = mergeJSON(current, runtime.DeepCopyJSON(update))
+	s.byUID[obj.GetUID()] = current
+	return runtime.DeepCopyJSON(current)
+}
+
+// forget מוחקת את ה-status של EtherealPods שכבר לא קיימים
+func (s *ownedStatus) forget(items []unstructured.Unstructured) {
+	exists := make(map[types.UID]bool, len(items))
+	for _, item := range items {
+		exists[item.GetUID()] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid := range s.byUID {
+		if !exists[uid] {
+			delete(s.byUID, uid)
+		}
+	}
+}
+
+// mergeJSON מחילה update על base בסמנטיקה של JSON merge patch (RFC 7386) ומחזירה את base
+func mergeJSON(base, update map[string]interface{}) map[string]interface{} {
+	for k, v := range update {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		patch, isMap := v.(map[string]interface{})
+		existing, wasMap := base[k].(map[string]interface{})
+		if isMap && wasMap {
+			base[k] = mergeJSON(existing, patch)
+			continue
+		}
+		if isMap {
+			base[k] = mergeJSON(map[string]interface{}{}, patch)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
+
+// applyStatusOf שולחת את ה-status המלא ל-subresource של status. force - ה-status הוא של האופרטור
+func applyStatusOf(ctx context.Context, res dynamic.ResourceInterface, obj unstructured.Unstructured, status map[string]interface{}) error {
+	applied := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"metadata":   map[string]interface{}{"name": obj.GetName(), "namespace": obj.GetNamespace()},
+		"status":     status,
+	}}
+	if obj.GetNamespace() == "" {
+		unstructured.RemoveNestedField(applied.Object, "metadata", "namespace")
+	}
+	data, _ := json.Marshal(status)
+	opts := metav1.ApplyOptions{FieldManager: fieldManager, Force: true, DryRun: planned("apply", "status", obj.GetNamespace(), obj.GetName(), "status", string(data))}
+	_, err := res.ApplyStatus(ctx, obj.GetName(), applied, opts)
+	return err
+}
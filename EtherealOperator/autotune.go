@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const defaultAutoTuneFactor = 1.5
+
+// autoTunePolicy היא מדיניות ההגדלה של הזיכרון אחרי OOMKilled (spec.autoTune)
+type autoTunePolicy struct {
+	factor    float64
+	maxMemory resource.Quantity
+}
+
+// autoTuneSettings קוראת את spec.autoTune; מחזירה false אם המדיניות לא מוגדרת או כבויה
+func autoTuneSettings(spec map[string]interface{}) (autoTunePolicy, bool) {
+	policy := autoTunePolicy{factor: defaultAutoTuneFactor}
+
+	autoTune, found, _ := unstructured.NestedMap(spec, "autoTune")
+	if !found {
+		return policy, false
+	}
+	if enabled, found, _ := unstructured.NestedBool(autoTune, "enabled"); found && !enabled {
+		return policy, false
+	}
+
+	if f, ok := numberField(autoTune, "memoryFactor"); ok && f > 1 {
+		policy.factor = f
+	}
+
+	maxMemory, _, _ := unstructured.NestedString(autoTune, "maxMemory")
+	q, err := resource.ParseQuantity(maxMemory)
+	if err != nil {
+		slog.Warn("Ignoring spec.autoTune: invalid maxMemory", "value", maxMemory, "error", err)
+		return policy, false
+	}
+	policy.maxMemory = q
+	return policy, true
+}
+
+// numberField קוראת שדה מספרי שיכול להגיע כ-int64 או כ-float64 מה-JSON
+func numberField(obj map[string]interface{}, fields ...string) (float64, bool) {
+	v, found, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !found {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// tunedResources מחילה את ערכי הזיכרון מ-status.autoTune על המשאבים שב-spec
+func tunedResources(item unstructured.Unstructured, resources corev1.ResourceRequirements) corev1.ResourceRequirements {
+	for field, apply := range map[string]*corev1.ResourceList{"memoryLimit": &resources.Limits, "memoryRequest": &resources.Requests} {
+		value, found, _ := unstructured.NestedString(item.Object, "status", "autoTune", field)
+		if !found || value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			continue
+		}
+		if *apply == nil {
+			*apply = corev1.ResourceList{}
+		}
+		(*apply)[corev1.ResourceMemory] = q
+	}
+	return resources
+}
+
+// resetAutoTuneOnSpecChange מוחקת את הכיוונון כשה-spec השתנה מאז שנקבע (generation חדש)
+func resetAutoTuneOnSpecChange(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured) {
+	generation, found, _ := unstructured.NestedInt64(item.Object, "status", "autoTune", "observedGeneration")
+	if !found || generation == item.GetGeneration() {
+		return
+	}
+
+	if err := patchStatus(ctx, dyn, *item, map[string]interface{}{"autoTune": nil}); err != nil {
+		slog.Warn("Failed to reset auto-tuned resources", "name", item.GetName(), "error", err)
+		return
+	}
+	unstructured.RemoveNestedField(item.Object, "status", "autoTune")
+
+	slog.Info("Spec changed, auto-tuned resources reset", "name", item.GetName())
+	recordEvent(ctx, client, *item, corev1.EventTypeNormal, "AutoTuneReset", "Spec changed, auto-tuned memory resources were reset to spec.resources")
+}
+
+// oomKilled בודקת אם אחד הקונטיינרים בדוח נהרג בגלל חריגה מהזיכרון
+func oomKilled(report *postMortem) bool {
+	for _, c := range report.Containers {
+		if c.Reason == "OOMKilled" {
+			return true
+		}
+	}
+	return false
+}
+
+// tuneAfterOOM מגדילה את ה-requests וה-limits של הזיכרון לפי המדיניות, עד התקרה,
+// ושומרת את הערכים ב-status כדי שהתחייה הבאה תשתמש בהם. בלי limit מכווננים רק את ה-request:
+// limit שלא נקבע ב-spec לא ממציאים
+func tuneAfterOOM(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, spec map[string]interface{}, pod *corev1.Pod) {
+	policy, ok := autoTuneSettings(spec)
+	if !ok || len(pod.Spec.Containers) == 0 {
+		return
+	}
+
+	current := pod.Spec.Containers[0].Resources
+	limit, hasLimit := current.Limits[corev1.ResourceMemory]
+	request, hasRequest := current.Requests[corev1.ResourceMemory]
+	if !hasLimit && !hasRequest {
+		recordEvent(ctx, client, item, corev1.EventTypeWarning, "AutoTuneSkipped", "Pod was OOMKilled but has no memory requests or limits to tune")
+		return
+	}
+	// what/from - הערך שנבדק מול התקרה: ה-limit, או ה-request כשאין limit
+	what, field, from := "limit", "memoryLimit", limit
+	if !hasLimit {
+		what, field, from = "request", "memoryRequest", request
+	}
+
+	if from.Cmp(policy.maxMemory) >= 0 {
+		slog.Warn("Auto-tune ceiling reached", "name", item.GetName(), "memory", what, "value", from.String(), "maxMemory", policy.maxMemory.String())
+		recordEvent(ctx, client, item, corev1.EventTypeWarning, "AutoTuneCeilingReached",
+			fmt.Sprintf("Pod was OOMKilled with memory %s %s, already at spec.autoTune.maxMemory", what, from.String()))
+		return
+	}
+
+	to := scaleMemory(from, policy.factor, policy.maxMemory)
+	tuned := map[string]interface{}{
+		field:                to.String(),
+		"observedGeneration": item.GetGeneration(),
+		"lastOOMKilledPod":   pod.Name,
+		"tunedAt":            time.Now().UTC().Format(time.RFC3339),
+	}
+	if hasLimit && hasRequest {
+		newRequest := scaleMemory(request, policy.factor, to)
+		tuned["memoryRequest"] = newRequest.String()
+	}
+
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"autoTune": tuned}); err != nil {
+		slog.Error("Failed to record auto-tuned resources", "name", item.GetName(), "error", err)
+		return
+	}
+
+	slog.Info("Pod was OOMKilled, raising memory", "name", item.GetName(), "memory", what, "from", from.String(), "to", to.String())
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "AutoTuned",
+		fmt.Sprintf("Pod %s was OOMKilled, raising memory %s from %s to %s", pod.Name, what, from.String(), to.String()))
+}
+
+// scaleMemory מכפילה כמות זיכרון בפקטור, מעגלת למעלה ל-Mi ולא עוברת את התקרה
+func scaleMemory(q resource.Quantity, factor float64, ceiling resource.Quantity) resource.Quantity {
+	const mi = 1024 * 1024
+	scaled := int64(math.Ceil(float64(q.Value())*factor/mi)) * mi
+	if scaled > ceiling.Value() {
+		return ceiling.DeepCopy()
+	}
+	return *resource.NewQuantity(scaled, resource.BinarySI)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTuneAfterOOM(t *testing.T) {
+	memory := func(value string) corev1.ResourceList {
+		if value == "" {
+			return nil
+		}
+		return corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(value)}
+	}
+
+	cases := []struct {
+		name           string
+		request, limit string
+
+		wantRequest, wantLimit string
+		wantEvent              string
+	}{
+		{name: "request and limit", request: "256Mi", limit: "512Mi", wantRequest: "384Mi", wantLimit: "768Mi", wantEvent: "AutoTuned"},
+		// בלי limit ב-spec לא מוסיפים limit, רק מגדילים את ה-request
+		{name: "request only", request: "256Mi", wantRequest: "384Mi", wantEvent: "AutoTuned"},
+		{name: "limit only", limit: "512Mi", wantLimit: "768Mi", wantEvent: "AutoTuned"},
+		{name: "request only, up to the ceiling", request: "800Mi", wantRequest: "1Gi", wantEvent: "AutoTuned"},
+		{name: "request already at the ceiling", request: "1Gi", wantEvent: "AutoTuneCeilingReached"},
+		{name: "nothing to tune", wantEvent: "AutoTuneSkipped"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := map[string]interface{}{"image": "sunday-app:v1", "autoTune": map[string]interface{}{"maxMemory": "1Gi"}}
+			c := newTestCluster(t, spec)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "real-ghost-oom", Namespace: "default"},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:      "main-container",
+					Resources: corev1.ResourceRequirements{Requests: memory(tc.request), Limits: memory(tc.limit)},
+				}}},
+			}
+
+			tuneAfterOOM(context.Background(), c.client, c.dyn, c.item(t), spec, pod)
+
+			item := c.item(t)
+			request, _, _ := unstructured.NestedString(item.Object, "status", "autoTune", "memoryRequest")
+			limit, _, _ := unstructured.NestedString(item.Object, "status", "autoTune", "memoryLimit")
+			if request != tc.wantRequest || limit != tc.wantLimit {
+				t.Errorf("status.autoTune request %q limit %q, want %q and %q", request, limit, tc.wantRequest, tc.wantLimit)
+			}
+			resources := tunedResources(item, podResources(spec))
+			if _, found := resources.Limits[corev1.ResourceMemory]; found != (tc.limit != "") {
+				t.Errorf("next pod has a memory limit: %v, spec has one: %v", found, tc.limit != "")
+			}
+
+			events, err := c.client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events.Items) != 1 || events.Items[0].Reason != tc.wantEvent {
+				t.Errorf("events %v, want one %s", events.Items, tc.wantEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// שלבי ה-canary כפי שנשמרים ב-status.canary.phase
+const (
+	canaryPending   = "Pending"
+	canaryAnalyzing = "Analyzing"
+	canaryPromoted  = "Promoted"
+	canaryAborted   = "Aborted"
+)
+
+// הפרש latency קטן מזה הוא רעש (במיוחד בבדיקות /health שעוברות דרך ה-API server)
+const canaryLatencyNoise = 10 * time.Millisecond
+
+// canarySettings היא spec.strategy.canary, כשה-strategy הוא מסוג Canary
+type canarySettings struct {
+	analysis           time.Duration
+	maxErrorRate       float64 // נקודות אחוז מעל שיעור השגיאות של הגרסה היציבה
+	maxLatencyIncrease float64 // אחוזים מעל ה-latency הממוצע של הגרסה היציבה
+	minRequests        int64
+}
+
+func canaryStrategy(spec map[string]interface{}) *canarySettings {
+	if typ, _, _ := unstructured.NestedString(spec, "strategy", "type"); typ != "Canary" {
+		return nil
+	}
+	c := &canarySettings{analysis: 5 * time.Minute, maxErrorRate: 1, maxLatencyIncrease: 50, minRequests: 20}
+	if v, found, _ := unstructured.NestedInt64(spec, "strategy", "canary", "analysisSeconds"); found && v > 0 {
+		c.analysis = time.Duration(v) * time.Second
+	}
+	if v, found := numberField(spec, "strategy", "canary", "maxErrorRatePercent"); found && v >= 0 {
+		c.maxErrorRate = v
+	}
+	if v, found := numberField(spec, "strategy", "canary", "maxLatencyIncreasePercent"); found && v >= 0 {
+		c.maxLatencyIncrease = v
+	}
+	if v, found, _ := unstructured.NestedInt64(spec, "strategy", "canary", "minRequests"); found && v > 0 {
+		c.minRequests = v
+	}
+	return c
+}
+
+// requestStats הם מונים מצטברים של בקשות: מ-/metrics של SundayApp, או מבדיקות /health של האופרטור
+type requestStats struct {
+	requests int64
+	errors   int64
+	latency  float64 // סך השניות
+}
+
+func (s requestStats) add(o requestStats) requestStats {
+	return requestStats{s.requests + o.requests, s.errors + o.errors, s.latency + o.latency}
+}
+
+// since מחזירה את ההפרש מ-baseline. אם המונים ירדו הפוד הופעל מחדש, וכל המונים החדשים נספרים
+func (s requestStats) since(base requestStats) requestStats {
+	if s.requests < base.requests {
+		return s
+	}
+	return requestStats{s.requests - base.requests, s.errors - base.errors, s.latency - base.latency}
+}
+
+func (s requestStats) errorRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.errors) / float64(s.requests)
+}
+
+func (s requestStats) avgLatency() time.Duration {
+	if s.requests == 0 {
+		return 0
+	}
+	return time.Duration(s.latency / float64(s.requests) * float64(time.Second))
+}
+
+func (s requestStats) toStatus() map[string]interface{} {
+	return map[string]interface{}{"requests": s.requests, "errors": s.errors, "latencySeconds": s.latency}
+}
+
+func statsFromStatus(obj map[string]interface{}, fields ...string) requestStats {
+	var s requestStats
+	s.requests, _, _ = unstructured.NestedInt64(obj, append(fields, "requests")...)
+	s.errors, _, _ = unstructured.NestedInt64(obj, append(fields, "errors")...)
+	s.latency, _ = numberField(obj, append(fields, "latencySeconds")...)
+	return s
+}
+
+// scrapeRequestStats קוראת את /metrics של SundayApp דרך ה-proxy של ה-API server,
+// כך שזה עובד גם כשהאופרטור רץ מחוץ לקלאסטר
+func scrapeRequestStats(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) (requestStats, error) {
+	raw, err := client.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, "8080", "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		return requestStats{}, err
+	}
+
+	var s requestStats
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch name := fields[0]; {
+		case strings.HasPrefix(name, "sunday_http_requests_total"):
+			s.requests += int64(value)
+			if strings.Contains(name, `status="5xx"`) {
+				s.errors += int64(value)
+			}
+		case name == "sunday_http_request_duration_seconds_sum":
+			s.latency = value
+		}
+	}
+	return s, scanner.Err()
+}
+
+// probeHealth מבצעת בדיקת /health אחת ומחזירה אותה כבקשה בודדת
+func probeHealth(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) requestStats {
+	start := time.Now()
+	_, err := client.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, "8080", "/health", nil).DoRaw(ctx)
+	s := requestStats{requests: 1, latency: time.Since(start).Seconds()}
+	if err != nil {
+		s.errors = 1
+	}
+	return s
+}
+
+// runCanary מנהלת rollout של image חדש במצב Canary: פוד אחד של הגרסה החדשה עולה לצד היציבים,
+// ואחרי חלון הניתוח הוא מקודם (וה-rollout ממשיך כרגיל) או שה-rollout מבוטל.
+// מחזירה כמה פודים להקים, ו-hold=true כל עוד אסור להתקדם מעבר ל-canary
+func runCanary(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, set podSet, tmpl podTemplate, settings *canarySettings, strategy rolloutStrategy, now time.Time) (create int, hold bool) {
+	revision := tmpl.hash()
+	stable, _, _ := unstructured.NestedString(item.Object, "status", "stableRevision")
+	stableImage, _, _ := unstructured.NestedString(item.Object, "status", "stableImage")
+	// canary רק לשדרוג image: לא לחזרה לגרסה שכבר עבדה, לשינוי קונפיגורציה או ל-restart מתוזמן
+	if revision == stable || tmpl.image == stableImage || set.driftReason != reasonSpecChanged {
+		return 0, false
+	}
+
+	canary, _, _ := unstructured.NestedMap(item.Object, "status", "canary")
+	phase, _ := canary["phase"].(string)
+	if canary["revision"] != revision {
+		startCanary(ctx, client, dyn, item, revision, tmpl.image)
+		phase = canaryPending
+	}
+
+	switch phase {
+	case canaryPromoted:
+		return 0, false
+	case canaryAborted:
+		return 0, true
+	case canaryAnalyzing:
+		podName, _ := canary["pod"].(string)
+		for _, pod := range set.current {
+			if pod.Name == podName && podAvailable(pod, strategy.minReady, now) {
+				analyzeCanary(ctx, client, dyn, item, pod, stablePods(set.old, strategy, now), settings, now)
+				return 0, true
+			}
+		}
+		// ה-canary נעלם או הפסיק להיות זמין - מתחילים את הניתוח מחדש על פוד חדש
+		slog.Warn("Canary pod lost, restarting analysis", "name", item.GetName(), "pod", podName)
+		startCanary(ctx, client, dyn, item, revision, tmpl.image)
+	}
+
+	if len(set.current) == 0 {
+		return 1, true
+	}
+	if pod := set.current[0]; podAvailable(pod, strategy.minReady, now) {
+		beginAnalysis(ctx, client, dyn, item, pod, stablePods(set.old, strategy, now), settings, now)
+	}
+	return 0, true
+}
+
+func stablePods(old []*corev1.Pod, strategy rolloutStrategy, now time.Time) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for _, pod := range old {
+		if podAvailable(pod, strategy.minReady, now) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+func startCanary(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, revision, image string) {
+	// קודם מוחקים את ה-canary הקודם, כדי ש-merge patch לא ישאיר baseline של פודים ישנים
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"canary": nil}); err != nil {
+		slog.Warn("Failed to reset canary status", "name", item.GetName(), "error", err)
+		return
+	}
+	status := map[string]interface{}{"canary": map[string]interface{}{"revision": revision, "image": image, "phase": canaryPending}}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to record canary", "name", item.GetName(), "error", err)
+		return
+	}
+	slog.Info("Starting canary", "name", item.GetName(), "revision", revision, "image", image)
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "CanaryStarted", fmt.Sprintf("Starting canary pod with image %s", image))
+}
+
+// beginAnalysis שומרת את המונים של כל הפודים ברגע שה-canary זמין, כדי שהניתוח יספור רק מה שקרה אחריו
+func beginAnalysis(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, canary *corev1.Pod, stable []*corev1.Pod, settings *canarySettings, now time.Time) {
+	baseline := map[string]interface{}{}
+	for _, pod := range append([]*corev1.Pod{canary}, stable...) {
+		if s, err := scrapeRequestStats(ctx, client, pod); err == nil {
+			baseline[pod.Name] = s.toStatus()
+		}
+	}
+
+	status := map[string]interface{}{"canary": map[string]interface{}{
+		"phase":     canaryAnalyzing,
+		"pod":       canary.Name,
+		"startedAt": now.UTC().Format(time.RFC3339),
+		"baseline":  baseline,
+	}}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to start canary analysis", "name", item.GetName(), "error", err)
+		return
+	}
+	slog.Info("Canary is available, analyzing", "name", item.GetName(), "pod", canary.Name, "window", settings.analysis)
+}
+
+// analyzeCanary אוספת את המונים של הסבב הנוכחי, כותבת את הניתוח ל-status ומחליטה בסוף החלון
+func analyzeCanary(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, canary *corev1.Pod, stable []*corev1.Pod, settings *canarySettings, now time.Time) {
+	status, _, _ := unstructured.NestedMap(item.Object, "status", "canary")
+	startedAt, _ := time.Parse(time.RFC3339, fmt.Sprint(status["startedAt"]))
+
+	// תנועה אמיתית מ-/metrics, לפי ההפרש מה-baseline
+	traffic := func(pods []*corev1.Pod) requestStats {
+		var total requestStats
+		for _, pod := range pods {
+			s, err := scrapeRequestStats(ctx, client, pod)
+			if err != nil {
+				continue
+			}
+			total = total.add(s.since(statsFromStatus(status, "baseline", pod.Name)))
+		}
+		return total
+	}
+	canaryTraffic, stableTraffic := traffic([]*corev1.Pod{canary}), traffic(stable)
+
+	// בדיקות /health מצטברות לאורך החלון, לשימוש כשאין מספיק תנועה
+	canaryProbes := statsFromStatus(status, "probes", "canary").add(probeHealth(ctx, client, canary))
+	stableProbes := statsFromStatus(status, "probes", "stable")
+	for _, pod := range stable {
+		stableProbes = stableProbes.add(probeHealth(ctx, client, pod))
+	}
+
+	source, c, s := canaryEvidence(canaryTraffic, stableTraffic, canaryProbes, stableProbes, settings)
+
+	analysis := map[string]interface{}{
+		"source": source,
+		"canary": map[string]interface{}{"requests": c.requests, "errorRatePercent": c.errorRate() * 100, "latencyMs": c.avgLatency().Milliseconds()},
+		"stable": map[string]interface{}{"requests": s.requests, "errorRatePercent": s.errorRate() * 100, "latencyMs": s.avgLatency().Milliseconds()},
+	}
+	update := map[string]interface{}{
+		"probes":   map[string]interface{}{"canary": canaryProbes.toStatus(), "stable": stableProbes.toStatus()},
+		"analysis": analysis,
+	}
+
+	if now.Sub(startedAt) < settings.analysis {
+		if err := patchStatus(ctx, dyn, item, map[string]interface{}{"canary": update}); err != nil {
+			slog.Warn("Failed to record canary analysis", "name", item.GetName(), "error", err)
+		}
+		return
+	}
+
+	passed, verdict := judgeCanary(c, s, settings)
+	update["message"] = verdict
+	update["completedAt"] = now.UTC().Format(time.RFC3339)
+	if passed {
+		update["phase"] = canaryPromoted
+	} else {
+		update["phase"] = canaryAborted
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"canary": update}); err != nil {
+		slog.Warn("Failed to record canary result", "name", item.GetName(), "error", err)
+		return
+	}
+
+	if passed {
+		slog.Info("Canary promoted", "name", item.GetName(), "pod", canary.Name, "source", source, "verdict", verdict)
+		recordEvent(ctx, client, item, corev1.EventTypeNormal, "CanaryPromoted", verdict)
+		return
+	}
+
+	state, inProgress := readRolloutState(item)
+	if !inProgress {
+		state = rolloutState{revision: canary.Annotations[annotationTemplateHash], image: fmt.Sprint(status["image"])}
+	}
+	failRollout(ctx, client, dyn, item, state, "CanaryAnalysisFailed", "canary analysis failed: "+verdict, now)
+}
+
+// canaryEvidence בוחרת על מה לשפוט: תנועה אמיתית אם הגיעו ל-canary לפחות minRequests בקשות, אחרת בדיקות /health
+func canaryEvidence(canaryTraffic, stableTraffic, canaryProbes, stableProbes requestStats, settings *canarySettings) (string, requestStats, requestStats) {
+	if canaryTraffic.requests >= settings.minRequests {
+		return "metrics", canaryTraffic, stableTraffic
+	}
+	return "health", canaryProbes, stableProbes
+}
+
+// judgeCanary משווה את ה-canary לגרסה היציבה: שיעור שגיאות בנקודות אחוז, ו-latency ממוצע באחוזים
+func judgeCanary(canary, stable requestStats, settings *canarySettings) (bool, string) {
+	if canary.requests == 0 {
+		return false, "no requests reached the canary"
+	}
+
+	canaryRate, stableRate := canary.errorRate()*100, stable.errorRate()*100
+	if canaryRate-stableRate > settings.maxErrorRate {
+		return false, fmt.Sprintf("error rate %.1f%% vs %.1f%% on stable pods (max +%.1f)", canaryRate, stableRate, settings.maxErrorRate)
+	}
+
+	canaryLatency, stableLatency := canary.avgLatency(), stable.avgLatency()
+	limit := time.Duration(float64(stableLatency) * (1 + settings.maxLatencyIncrease/100))
+	if stable.requests > 0 && canaryLatency > limit && canaryLatency-stableLatency > canaryLatencyNoise {
+		return false, fmt.Sprintf("average latency %s vs %s on stable pods (max +%.0f%%)", canaryLatency, stableLatency, settings.maxLatencyIncrease)
+	}
+
+	return true, fmt.Sprintf("error rate %.1f%% vs %.1f%%, average latency %s vs %s over %d requests",
+		canaryRate, stableRate, canaryLatency, stableLatency, canary.requests)
+}
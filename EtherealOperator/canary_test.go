@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJudgeCanary(t *testing.T) {
+	settings := &canarySettings{maxErrorRate: 1, maxLatencyIncrease: 50, minRequests: 20}
+	// latency הוא סך השניות: 100 בקשות ו-10 שניות הן 100ms בממוצע
+	stable := requestStats{requests: 1000, errors: 5, latency: 100}
+
+	cases := []struct {
+		name       string
+		canary     requestStats
+		stable     requestStats
+		wantPass   bool
+		wantReason string
+	}{
+		{name: "healthy canary", canary: requestStats{requests: 100, errors: 1, latency: 11}, stable: stable, wantPass: true},
+		{name: "error rate over the limit", canary: requestStats{requests: 100, errors: 3, latency: 10}, stable: stable, wantReason: "error rate 3.0% vs 0.5%"},
+		{name: "error rate compared to stable, not to zero", canary: requestStats{requests: 100, errors: 5, latency: 10}, stable: requestStats{requests: 1000, errors: 45, latency: 100}, wantPass: true},
+		{name: "latency over the limit", canary: requestStats{requests: 100, latency: 20}, stable: stable, wantReason: "average latency 200ms vs 100ms"},
+		{name: "latency within the limit", canary: requestStats{requests: 100, latency: 14}, stable: stable, wantPass: true},
+		// 2ms מול 5ms זה +150%, אבל מתחת ל-canaryLatencyNoise
+		{name: "latency increase below the noise floor", canary: requestStats{requests: 100, latency: 0.5}, stable: requestStats{requests: 100, latency: 0.2}, wantPass: true},
+		{name: "no requests reached the canary", stable: stable, wantReason: "no requests reached the canary"},
+		// בלי baseline יציב אין ל-latency עם מה להשוות, ושיעור השגיאות נמדד מול אפס
+		{name: "empty stable baseline, slow canary", canary: requestStats{requests: 100, latency: 50}, wantPass: true},
+		{name: "empty stable baseline, failing canary", canary: requestStats{requests: 100, errors: 2, latency: 10}, wantReason: "error rate 2.0% vs 0.0%"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			passed, verdict := judgeCanary(tc.canary, tc.stable, settings)
+			if passed != tc.wantPass {
+				t.Fatalf("passed = %v, want %v (%s)", passed, tc.wantPass, verdict)
+			}
+			if !strings.Contains(verdict, tc.wantReason) {
+				t.Errorf("verdict = %q, want it to mention %q", verdict, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestCanaryEvidence(t *testing.T) {
+	settings := &canarySettings{maxErrorRate: 1, maxLatencyIncrease: 50, minRequests: 20}
+	probes := requestStats{requests: 10, latency: 0.1}
+
+	cases := []struct {
+		name       string
+		traffic    requestStats
+		wantSource string
+		wantPass   bool
+	}{
+		// מעט מדי בקשות: השגיאות ב-/metrics הן רעש, והשיפוט לפי בדיקות /health
+		{name: "below minRequests", traffic: requestStats{requests: 19, errors: 10, latency: 1}, wantSource: "health", wantPass: true},
+		{name: "at minRequests", traffic: requestStats{requests: 20, errors: 10, latency: 1}, wantSource: "metrics"},
+		{name: "no traffic", wantSource: "health", wantPass: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, c, s := canaryEvidence(tc.traffic, requestStats{requests: 200, latency: 10}, probes, probes, settings)
+			if source != tc.wantSource {
+				t.Fatalf("source = %s, want %s", source, tc.wantSource)
+			}
+			if passed, verdict := judgeCanary(c, s, settings); passed != tc.wantPass {
+				t.Errorf("passed = %v, want %v (%s)", passed, tc.wantPass, verdict)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// על ה-EtherealPod: "true" (או שם של פעולה) מפעיל chaos עם ברירות המחדל, גם בלי spec.chaos
+const annotationChaos = "sunday.com/chaos"
+
+// פעולות chaos
+const (
+	chaosDelete = "Delete" // מחיקה רגילה, עם grace period
+	chaosKill   = "Kill"   // מחיקה עם grace 0 - SIGKILL מיידי
+	chaosFail   = "Fail"   // מדמה כישלון: עובר במסלול הריפוי המלא (post-mortem, מדיניות) כאילו הפוד קרס
+)
+
+// כמה תקלות אחרונות נשמרות ב-status.chaos.faults
+const maxChaosFaults = 10
+
+// chaosSettings היא spec.chaos אחרי פענוח
+type chaosSettings struct {
+	actions     []string
+	ratePerHour float64
+	window      *pauseWindow // nil - בכל שעה
+}
+
+func readChaosSettings(item unstructured.Unstructured) (*chaosSettings, error) {
+	spec, found, _ := unstructured.NestedMap(item.Object, "spec", "chaos")
+	annotation := item.GetAnnotations()[annotationChaos]
+	enabled, _, _ := unstructured.NestedBool(spec, "enabled")
+	if !enabled && (annotation == "" || annotation == "false") {
+		return nil, nil
+	}
+
+	s := &chaosSettings{actions: []string{chaosDelete}, ratePerHour: 1}
+	if annotation != "" && annotation != "true" && annotation != "false" {
+		s.actions = strings.Split(annotation, ",")
+		for i := range s.actions {
+			s.actions[i] = strings.TrimSpace(s.actions[i])
+		}
+	}
+	if actions, _, _ := unstructured.NestedStringSlice(spec, "actions"); len(actions) > 0 {
+		s.actions = actions
+	}
+	// גם פעולות שבאות רק מה-annotation: טעות הקלדה לא הופכת למחיקה רגילה
+	for _, a := range s.actions {
+		if a != chaosDelete && a != chaosKill && a != chaosFail {
+			return nil, fmt.Errorf("unknown chaos action %q", a)
+		}
+	}
+	if !found {
+		return s, nil
+	}
+
+	if v, found := numberField(spec, "ratePerHour"); found && v > 0 {
+		s.ratePerHour = v
+	}
+	if w, ok := spec["window"].(map[string]interface{}); ok {
+		// אותו מבנה כמו pauseWindows של HealingPolicy, רק שכאן החלון הוא מתי מותר להזריק
+		window, err := parsePauseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("window: %w", err)
+		}
+		s.window = &window
+	}
+	return s, nil
+}
+
+// chaosController מזריק תקלות לפודים של EtherealPods שביקשו זאת, ומודד כמה זמן לקח לרפא אותן
+type chaosController struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	lastCheck map[types.UID]time.Time
+}
+
+func newChaosController() *chaosController {
+	return &chaosController{rand: rand.New(rand.NewSource(time.Now().UnixNano())), lastCheck: map[types.UID]time.Time{}}
+}
+
+func init() {
+	metrics.describe("ethereal_chaos_faults_total", "counter", "Faults injected by the chaos controller.")
+	metrics.describe("ethereal_chaos_time_to_heal_seconds_sum", "counter", "Total time from an injected fault until the EtherealPod was available again.")
+	metrics.describe("ethereal_chaos_time_to_heal_seconds_count", "counter", "Injected faults that were healed.")
+}
+
+// fire מחליטה אם להזריק עכשיו: תהליך פואסון לפי ratePerHour והזמן שעבר מהבדיקה הקודמת
+func (c *chaosController) fire(uid types.UID, rate float64, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.lastCheck[uid]
+	c.lastCheck[uid] = now
+	if !ok {
+		return false
+	}
+	p := 1 - math.Exp(-rate*now.Sub(last).Hours())
+	return c.rand.Float64() < p
+}
+
+// run מודדת ריפוי של התקלה האחרונה, ואם אין תקלה פתוחה - אולי מזריקה חדשה
+func (c *chaosController) run(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, policy *healingPolicy, now time.Time) {
+	settings, err := readChaosSettings(item)
+	if err != nil {
+		slog.Warn("Ignoring invalid chaos settings", "name", item.GetName(), "error", err)
+		return
+	}
+
+	faults, _, _ := unstructured.NestedSlice(item.Object, "status", "chaos", "faults")
+	if open := openFault(faults); open != nil {
+		c.measureHeal(ctx, client, dyn, item, faults, open, now)
+		return
+	}
+	if settings == nil {
+		c.mu.Lock()
+		delete(c.lastCheck, item.GetUID())
+		c.mu.Unlock()
+		return
+	}
+
+	// מזריקים רק למערכת תקינה ולא מושהית, בתוך החלון, ולא תוך כדי rollout
+	if conditionStatus(item, conditionAvailable) != metav1.ConditionTrue || (settings.window != nil && !settings.window.active(now)) {
+		return
+	}
+	if paused, _, _ := unstructured.NestedBool(item.Object, "spec", "paused"); paused {
+		return
+	}
+	if _, rolling := readRolloutState(item); rolling {
+		return
+	}
+	if !c.fire(item.GetUID(), settings.ratePerHour, now) {
+		return
+	}
+
+	pods, err := listManagedPods(ctx, client, item)
+	if err != nil {
+		slog.Warn("Chaos could not list pods", "name", item.GetName(), "error", err)
+		return
+	}
+	var victims []*corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && pods[i].Status.Phase == corev1.PodRunning {
+			victims = append(victims, &pods[i])
+		}
+	}
+	if len(victims) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	victim := victims[c.rand.Intn(len(victims))]
+	action := settings.actions[c.rand.Intn(len(settings.actions))]
+	c.mu.Unlock()
+
+	if err := c.inject(ctx, client, dyn, item, victim, action, policy); err != nil {
+		slog.Error("Chaos injection failed", "name", item.GetName(), "pod", victim.Name, "action", action, "error", err)
+		return
+	}
+
+	fault := map[string]interface{}{
+		"id":     fmt.Sprintf("%s-%d", victim.Name, now.Unix()),
+		"pod":    victim.Name,
+		"action": action,
+		"at":     now.UTC().Format(time.RFC3339),
+	}
+	faults = append([]interface{}{fault}, faults...)
+	if len(faults) > maxChaosFaults {
+		faults = faults[:maxChaosFaults]
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"chaos": map[string]interface{}{"faults": faults}}); err != nil {
+		slog.Warn("Failed to record chaos fault", "name", item.GetName(), "error", err)
+	}
+
+	metrics.add("ethereal_chaos_faults_total", map[string]string{"namespace": item.GetNamespace(), "action": action}, 1)
+	slog.Warn("Chaos fault injected", "name", item.GetName(), "pod", victim.Name, "action", action)
+	recordEvent(ctx, client, item, corev1.EventTypeWarning, "ChaosInjected", fmt.Sprintf("Chaos %s on pod %s", action, victim.Name))
+}
+
+func (c *chaosController) inject(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, pod *corev1.Pod, action string, policy *healingPolicy) error {
+	switch action {
+	case chaosFail:
+		spec, _, _ := unstructured.NestedMap(item.Object, "spec")
+		healFailedPod(ctx, client, dyn, item, spec, pod, policy, "ChaosFailure")
+		return nil
+	case chaosKill:
+		healingRecords.removing(item, pod, "Chaos"+action, true, time.Now())
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: ptr(int64(0)), DryRun: planned("delete", "pods", pod.Namespace, pod.Name, "reason", "Chaos"+action)})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	case chaosDelete:
+		healingRecords.removing(item, pod, "Chaos"+action, true, time.Now())
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{DryRun: planned("delete", "pods", pod.Namespace, pod.Name, "reason", "Chaos"+action)})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown chaos action %q", action)
+	}
+}
+
+// openFault מחזירה את התקלה האחרונה אם היא עדיין לא רופאה
+func openFault(faults []interface{}) map[string]interface{} {
+	if len(faults) == 0 {
+		return nil
+	}
+	f, ok := faults[0].(map[string]interface{})
+	if !ok || f["healedAt"] != nil {
+		return nil
+	}
+	return f
+}
+
+// measureHeal סוגרת את התקלה כשה-EtherealPod שוב Available וכל הרפליקות מוכנות, והפוד שנפגע כבר לא קיים.
+// ה-status של item נקרא בתחילת הסבב, לפני ההזרקה או הריפוי, אז את הרפליקות המוכנות סופרים מהפודים עצמם
+func (c *chaosController) measureHeal(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, faults []interface{}, fault map[string]interface{}, now time.Time) {
+	if conditionStatus(item, conditionAvailable) != metav1.ConditionTrue {
+		return
+	}
+	pods, err := listManagedPods(ctx, client, item)
+	if err != nil {
+		slog.Warn("Chaos could not list pods", "name", item.GetName(), "error", err)
+		return
+	}
+	ready := 0
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && podReady(&pods[i]) {
+			ready++
+		}
+	}
+	spec, _, _ := unstructured.NestedMap(item.Object, "spec")
+	if ready < desiredReplicas(spec) {
+		return
+	}
+	victim, _ := fault["pod"].(string)
+	if pod, err := client.CoreV1().Pods(item.GetNamespace()).Get(ctx, victim, metav1.GetOptions{}); err == nil && pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+		// הפוד עוד לא נמחק (למשל Fail שהמדיניות עיכבה)
+		return
+	}
+
+	at, _ := time.Parse(time.RFC3339, fmt.Sprint(fault["at"]))
+	heal := now.Sub(at)
+	fault["healedAt"] = now.UTC().Format(time.RFC3339)
+	fault["timeToHealSeconds"] = int64(heal.Seconds())
+
+	var total, healed int64
+	for _, f := range faults {
+		if m, ok := f.(map[string]interface{}); ok {
+			if v, found, _ := unstructured.NestedInt64(m, "timeToHealSeconds"); found {
+				total += v
+				healed++
+			}
+		}
+	}
+	status := map[string]interface{}{"faults": faults}
+	if healed > 0 {
+		status["meanTimeToHealSeconds"] = total / healed
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"chaos": status}); err != nil {
+		slog.Warn("Failed to record chaos heal", "name", item.GetName(), "error", err)
+		return
+	}
+
+	metrics.add("ethereal_chaos_time_to_heal_seconds_sum", map[string]string{"namespace": item.GetNamespace()}, heal.Seconds())
+	metrics.add("ethereal_chaos_time_to_heal_seconds_count", map[string]string{"namespace": item.GetNamespace()}, 1)
+	slog.Info("Chaos fault healed", "name", item.GetName(), "fault", fault["id"], "timeToHeal", heal)
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "ChaosHealed", fmt.Sprintf("Recovered from chaos %s on pod %s in %s", fault["action"], victim, heal.Round(time.Second)))
+}
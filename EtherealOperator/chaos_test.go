@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReadChaosSettings(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotation  string
+		spec        map[string]interface{}
+		wantActions []string
+		wantErr     bool
+	}{
+		{name: "off"},
+		{name: "annotation with defaults", annotation: "true", wantActions: []string{chaosDelete}},
+		{name: "actions from the annotation", annotation: "Kill, Fail", wantActions: []string{chaosKill, chaosFail}},
+		{name: "typo in the annotation", annotation: "kil", wantErr: true},
+		{name: "spec.actions", spec: map[string]interface{}{"enabled": true, "actions": []interface{}{chaosKill}}, wantActions: []string{chaosKill}},
+		{name: "typo in spec.actions", spec: map[string]interface{}{"enabled": true, "actions": []interface{}{"Evict"}}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			item := unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+			if tc.annotation != "" {
+				item.SetAnnotations(map[string]string{annotationChaos: tc.annotation})
+			}
+			if tc.spec != nil {
+				_ = unstructured.SetNestedMap(item.Object, tc.spec, "spec", "chaos")
+			}
+			s, err := readChaosSettings(item)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("accepted invalid actions %v", s.actions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantActions == nil {
+				if s != nil {
+					t.Errorf("chaos is on: %+v", s)
+				}
+				return
+			}
+			if s == nil || len(s.actions) != len(tc.wantActions) {
+				t.Fatalf("settings = %+v, want actions %v", s, tc.wantActions)
+			}
+			for i := range s.actions {
+				if s.actions[i] != tc.wantActions[i] {
+					t.Errorf("actions = %v, want %v", s.actions, tc.wantActions)
+				}
+			}
+		})
+	}
+}
+
+// ה-readyReplicas ב-status של ה-item הוא מלפני ההזרקה. תקלה נסגרת רק כשהפודים עצמם מוכנים
+func TestChaosHealCountsLivePods(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "replicas": int64(2)})
+	c.settle(t)
+	at := time.Now().Add(-time.Minute)
+	c.edit(t, []interface{}{map[string]interface{}{
+		"id": "victim-1", "pod": "victim", "action": chaosDelete, "at": at.UTC().Format(time.RFC3339),
+	}}, "status", "chaos", "faults")
+
+	// החלופה של הפוד שנמחק עוד עולה, אבל ב-status שנקרא בתחילת הסבב עדיין כתוב 2
+	replacement := c.pods(t)[0]
+	for i := range replacement.Status.Conditions {
+		if replacement.Status.Conditions[i].Type == corev1.PodReady {
+			replacement.Status.Conditions[i].Status = corev1.ConditionFalse
+		}
+	}
+	if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &replacement, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if ready, _, _ := unstructured.NestedInt64(c.item(t).Object, "status", "readyReplicas"); ready != 2 {
+		t.Fatalf("status.readyReplicas = %d, want the stale 2", ready)
+	}
+	chaos := newChaosController()
+	chaos.run(context.Background(), c.client, c.dyn, c.item(t), nil, time.Now())
+	if healed, found, _ := unstructured.NestedFieldNoCopy(c.item(t).Object, "status", "chaos", "faults"); found {
+		if f := openFault(healed.([]interface{})); f == nil {
+			t.Fatal("fault closed while a replica is not ready")
+		}
+	}
+
+	for i := range replacement.Status.Conditions {
+		if replacement.Status.Conditions[i].Type == corev1.PodReady {
+			replacement.Status.Conditions[i].Status = corev1.ConditionTrue
+		}
+	}
+	if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &replacement, "default"); err != nil {
+		t.Fatal(err)
+	}
+	chaos.run(context.Background(), c.client, c.dyn, c.item(t), nil, time.Now())
+	faults, _, _ := unstructured.NestedSlice(c.item(t).Object, "status", "chaos", "faults")
+	if openFault(faults) != nil {
+		t.Fatalf("fault still open once all replicas are ready: %v", faults)
+	}
+}
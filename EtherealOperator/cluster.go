@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var clusterTargetGVR = schema.GroupVersionResource{
+	Group:    "sunday.com",
+	Version:  "v1",
+	Resource: "clustertargets",
+}
+
+// clusterLocal - השם השמור ב-spec.clusters לקלאסטר שבו האופרטור עצמו רץ
+const clusterLocal = "local"
+
+// labelHomeCluster - הקלאסטר של האופרטור שיצר את האובייקט. קלאסטר מרוחק יכול להיות משותף
+// לכמה אופרטורים, וכל אחד מנקה בו רק את מה שנושא את הזהות שלו
+const labelHomeCluster = "sunday.com/home-cluster"
+
+// homeCluster - הזהות של הקלאסטר של האופרטור (--cluster-id, או ה-UID של kube-system).
+// ריק כשאין זהות, ואז האופרטור לא מוחק כלום בקלאסטרים מרוחקים
+var homeCluster string
+
+// כמה זמן קלאסטר פעיל יכול לא לענות לפני שעוברים ממנו, אם spec.failoverAfterSeconds לא נקבע.
+// אותו זמן הוא גם כמה קלאסטר מועדף צריך לענות ברציפות לפני שחוזרים אליו
+const defaultFailoverAfter = time.Minute
+
+func init() {
+	metrics.describe("ethereal_cluster_reachable", "gauge", "1 when the last probe of the ClusterTarget succeeded.")
+	metrics.describe("ethereal_cluster_etherealpods", "gauge", "EtherealPods whose pods run in the cluster.")
+	metrics.describe("ethereal_cluster_failovers_total", "counter", "EtherealPods moved from one cluster to another.")
+}
+
+// clusters - ה-ClusterTargets המוכרים והחיבורים אליהם. בלי ClusterTargets הכל רץ בקלאסטר המקומי כמו קודם
+var clusters = &clusterRegistry{targets: map[string]*clusterTarget{}}
+
+type clusterRegistry struct {
+	mu      sync.Mutex
+	targets map[string]*clusterTarget
+}
+
+// clusterTarget הוא קלאסטר מרוחק לפי kubeconfig ב-Secret. client הוא nil כשה-Secret חסר או לא תקין
+type clusterTarget struct {
+	name          string
+	client        kubernetes.Interface
+	secretVersion string
+
+	reachable        bool
+	message          string
+	serverVersion    string
+	connectedSince   time.Time
+	unreachableSince time.Time
+	placed           int
+	// reported - ה-status שכבר כתוב על ה-ClusterTarget
+	reported string
+
+	// probing נסגר כשהבדיקה שרצה ברקע מסתיימת; nil כשאין בדיקה כזו. probed - הייתה לפחות בדיקה אחת
+	probing chan struct{}
+	probed  bool
+}
+
+// sync קוראת את ה-ClusterTargets ומפעילה ברקע בדיקה לכל אחד: בניית client מה-Secret שלו ו-ServerVersion.
+// הסבב משתמש בתוצאה האחרונה שנשמרה, כדי שקלאסטר שלא עונה (עד timeout של 10 שניות) לא יעכב אותו.
+// מחכים רק לבדיקה הראשונה של קלאסטר חדש, אחרת הסבב הראשון היה מעביר את כולם לקלאסטר הבא ברשימה.
+// כמו שאר האופרטור זה polling בכל סבב ולא informers
+func (r *clusterRegistry) sync(ctx context.Context, home kubernetes.Interface, dyn dynamic.Interface) {
+	list, err := dyn.Resource(clusterTargetGVR).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		// ה-CRD לא מותקן - אין ריבוי קלאסטרים
+		list, err = &unstructured.UnstructuredList{}, nil
+	}
+	if err != nil {
+		slog.Warn("Failed to list ClusterTargets, keeping the known ones", "error", err)
+		return
+	}
+
+	seen := map[string]bool{}
+	var first []chan struct{}
+	r.mu.Lock()
+	for _, item := range list.Items {
+		seen[item.GetName()] = true
+		t := r.targets[item.GetName()]
+		if t == nil {
+			t = &clusterTarget{name: item.GetName()}
+			r.targets[t.name] = t
+		}
+		// בדיקה קודמת שעוד לא חזרה לא מתחילה שוב
+		if t.probing == nil {
+			t.probing = make(chan struct{})
+			go r.refresh(home, t, item, t.probing)
+		}
+		if !t.probed {
+			first = append(first, t.probing)
+		}
+	}
+	for name := range r.targets {
+		if !seen[name] {
+			delete(r.targets, name)
+			metrics.set("ethereal_cluster_reachable", map[string]string{"cluster": name}, 0)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, done := range first {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh רצה ברקע ולא מחזיקה את r.mu בזמן הקריאות לרשת; רק התוצאה נכתבת תחת הנעילה
+func (r *clusterRegistry) refresh(home kubernetes.Interface, t *clusterTarget, item unstructured.Unstructured, done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), clusterProbeTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	client, secretVersion := t.client, t.secretVersion
+	r.mu.Unlock()
+
+	client, secretVersion, message := connect(ctx, home, item, client, secretVersion)
+	reachable, serverVersion := false, ""
+	if client != nil {
+		version, err := client.Discovery().ServerVersion()
+		if err == nil {
+			reachable, serverVersion = true, version.GitVersion
+		} else {
+			message = err.Error()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.probing, t.probed = nil, true
+	t.client, t.secretVersion = client, secretVersion
+	// ה-ClusterTarget נמחק בזמן הבדיקה - לא מחזירים את המטריקה שלו
+	if r.targets[t.name] != t {
+		return
+	}
+	t.record(reachable, message, serverVersion, time.Now())
+}
+
+// clusterProbeTimeout - כמה זמן בדיקה של קלאסטר אחד יכולה לקחת (קריאת ה-Secret וה-ServerVersion)
+const clusterProbeTimeout = 10 * time.Second
+
+// connect בונה מחדש את ה-client רק כשה-Secret השתנה. client הוא nil, עם הודעה, כשה-Secret חסר או לא תקין
+func connect(ctx context.Context, home kubernetes.Interface, item unstructured.Unstructured, client kubernetes.Interface, secretVersion string) (kubernetes.Interface, string, string) {
+	ref, _, _ := unstructured.NestedStringMap(item.Object, "spec", "kubeconfigSecretRef")
+	namespace, key := ref["namespace"], ref["key"]
+	if namespace == "" {
+		namespace = operatorNamespace()
+	}
+	if key == "" {
+		key = "kubeconfig"
+	}
+
+	secret, err := home.CoreV1().Secrets(namespace).Get(ctx, ref["name"], metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Sprintf("kubeconfig Secret %s/%s: %v", namespace, ref["name"], err)
+	}
+	if client != nil && secret.ResourceVersion == secretVersion {
+		return client, secretVersion, ""
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[key])
+	if err == nil {
+		config.Timeout = clusterProbeTimeout
+		client, err = kubernetes.NewForConfig(config)
+	}
+	if err != nil {
+		return nil, "", fmt.Sprintf("invalid kubeconfig in Secret %s/%s key %s: %v", namespace, ref["name"], key, err)
+	}
+	return targetClient{Interface: client, home: home}, secret.ResourceVersion, ""
+}
+
+// record שומרת את תוצאת הבדיקה ואת זמני המעבר בין עונה ללא עונה. נקראת תחת r.mu
+func (t *clusterTarget) record(reachable bool, message, serverVersion string, now time.Time) {
+	was := t.reachable
+	t.reachable, t.message = reachable, message
+	if reachable {
+		t.serverVersion = serverVersion
+	}
+
+	switch {
+	case t.reachable && (!was || t.connectedSince.IsZero()):
+		t.connectedSince = now
+		slog.Info("Cluster is reachable", "cluster", t.name, "version", t.serverVersion)
+	case !t.reachable && (was || t.unreachableSince.IsZero()):
+		t.unreachableSince, t.connectedSince = now, time.Time{}
+		slog.Warn("Cluster is unreachable", "cluster", t.name, "error", t.message)
+	}
+	value := 0.0
+	if t.reachable {
+		value = 1
+	}
+	metrics.set("ethereal_cluster_reachable", map[string]string{"cluster": t.name}, value)
+}
+
+// placement - הקלאסטר שבו רצים הפודים של ה-EtherealPod, לפי status.cluster
+func placement(item unstructured.Unstructured) string {
+	cluster, _, _ := unstructured.NestedString(item.Object, "status", "cluster")
+	return clusterOrLocal(cluster)
+}
+
+func clusterOrLocal(name string) string {
+	if name == "" {
+		return clusterLocal
+	}
+	return name
+}
+
+// place בוחרת את הקלאסטר של ה-EtherealPod ומחזירה client אליו. הבחירה היא הקלאסטר הראשון ב-spec.clusters
+// שאפשר להשתמש בו: הקלאסטר הנוכחי כל עוד הוא לא שותק יותר מ-failoverAfter, ואחר רק אחרי שהוא עונה
+// ברציפות failoverAfter - כדי שקלאסטר שעולה ויורד לא יגרור את הפודים הלוך ושוב.
+// false כשאין קלאסטר זמין; אז אין reconcile בסבב הזה
+func (r *clusterRegistry) place(ctx context.Context, home kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured, now time.Time) (kubernetes.Interface, bool) {
+	wanted, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "clusters")
+	current, _, _ := unstructured.NestedString(item.Object, "status", "cluster")
+	if len(wanted) == 0 {
+		if current != "" {
+			r.move(ctx, home, dyn, item, current, "")
+		}
+		return home, true
+	}
+
+	failoverAfter := defaultFailoverAfter
+	if seconds, found, _ := unstructured.NestedInt64(item.Object, "spec", "failoverAfterSeconds"); found && seconds > 0 {
+		failoverAfter = time.Duration(seconds) * time.Second
+	}
+
+	r.mu.Lock()
+	chosen := ""
+	for _, name := range wanted {
+		if r.usable(name, current, failoverAfter, now) {
+			chosen = name
+			break
+		}
+	}
+	var client kubernetes.Interface = home
+	reachable := true
+	if t := r.targets[chosen]; chosen != clusterLocal && t != nil {
+		client, reachable = t.client, t.reachable
+	}
+	r.mu.Unlock()
+
+	if chosen == "" {
+		setWaitingReason(ctx, dyn, *item, "NoClusterAvailable")
+		return nil, false
+	}
+	if chosen != current {
+		r.move(ctx, home, dyn, item, current, chosen)
+	}
+	// הקלאסטר הנוכחי לא עונה אבל עוד לא עבר failoverAfter - מחכים לו
+	if !reachable {
+		setWaitingReason(ctx, dyn, *item, "ClusterUnreachable")
+		return nil, false
+	}
+	return client, true
+}
+
+func (r *clusterRegistry) usable(name, current string, failoverAfter time.Duration, now time.Time) bool {
+	if name == clusterLocal {
+		return true
+	}
+	t := r.targets[name]
+	switch {
+	case t == nil:
+		return false
+	case name == current:
+		return t.reachable || now.Sub(t.unreachableSince) < failoverAfter
+	case current == "":
+		return t.reachable
+	default:
+		return t.reachable && now.Sub(t.connectedSince) >= failoverAfter
+	}
+}
+
+// move רושמת את הקלאסטר החדש ב-status. הפודים בקלאסטר החדש חסרים ומוקמים בסבב הזה;
+// את הפודים שנשארו בקלאסטר הקודם collect מוחקת כשהוא עונה שוב
+func (r *clusterRegistry) move(ctx context.Context, home kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured, from, to string) {
+	// בלי status.cluster הפודים רצים מקומית, אז "" ו-"local" הם אותו קלאסטר
+	same := clusterOrLocal(from) == clusterOrLocal(to)
+	failover := from != "" && !same
+
+	status := map[string]interface{}{"cluster": nilIfEmpty(to)}
+	if failover {
+		status["healing"] = map[string]interface{}{"pendingReason": reasonClusterFailover}
+	}
+	if err := patchStatus(ctx, dyn, *item, status); err != nil {
+		slog.Warn("Failed to record cluster placement", "name", item.GetName(), "cluster", to, "error", err)
+		return
+	}
+	if to == "" {
+		unstructured.RemoveNestedField(item.Object, "status", "cluster")
+	} else {
+		_ = unstructured.SetNestedField(item.Object, to, "status", "cluster")
+	}
+	if same {
+		return
+	}
+	if !failover {
+		recordEvent(ctx, home, *item, corev1.EventTypeNormal, "ClusterPlaced", fmt.Sprintf("Running pods in cluster %s", to))
+		return
+	}
+	_ = unstructured.SetNestedField(item.Object, reasonClusterFailover, "status", "healing", "pendingReason")
+	to = clusterOrLocal(to)
+
+	why := "no longer listed in spec.clusters"
+	wanted, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "clusters")
+	for _, name := range wanted {
+		if name == from {
+			why = "a preferred cluster is available"
+		}
+	}
+	r.mu.Lock()
+	if t := r.targets[from]; t != nil && !t.reachable {
+		why = fmt.Sprintf("unreachable since %s: %s", t.unreachableSince.UTC().Format(time.RFC3339), t.message)
+	}
+	r.mu.Unlock()
+
+	slog.Warn("Moving EtherealPod to another cluster", "name", item.GetName(), "from", from, "to", to, "why", why)
+	metrics.add("ethereal_cluster_failovers_total", map[string]string{"from": from, "to": to}, 1)
+	recordEvent(ctx, home, *item, corev1.EventTypeWarning, "ClusterFailover", fmt.Sprintf("Moving pods from cluster %s to %s: %s", from, to, why))
+}
+
+// collect מוחקת פודים שנשארו בקלאסטר שה-EtherealPod כבר לא רץ בו (אחרי failover), ובקלאסטרים
+// מרוחקים גם פודים של EtherealPods שנמחקו - שם אין ownerReference שה-garbage collector ינקה לפיו
+func (r *clusterRegistry) collect(ctx context.Context, home kubernetes.Interface, items []unstructured.Unstructured) {
+	r.mu.Lock()
+	if len(r.targets) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	clients := map[string]kubernetes.Interface{clusterLocal: home}
+	for name, t := range r.targets {
+		t.placed = 0
+		if t.reachable {
+			clients[name] = t.client
+		}
+	}
+	placed := map[string]string{}
+	for _, item := range items {
+		cluster := placement(item)
+		placed[item.GetNamespace()+"/"+item.GetName()] = cluster
+		if t := r.targets[cluster]; t != nil {
+			t.placed++
+		}
+	}
+	for name, t := range r.targets {
+		metrics.set("ethereal_cluster_etherealpods", map[string]string{"cluster": name}, float64(t.placed))
+	}
+	r.mu.Unlock()
+
+	uids := map[types.UID]bool{}
+	for _, item := range items {
+		uids[item.GetUID()] = true
+	}
+	// ours - רק מה שהאופרטור הזה יצר: לפי labelHomeCluster, או בקלאסטר המקומי לפי ה-owner
+	// (פודים מלפני ה-label). פודים של אופרטור אחר בקלאסטר משותף לא נוגעים בהם
+	ours := func(cluster string, obj metav1.Object) bool {
+		if homeCluster != "" && obj.GetLabels()[labelHomeCluster] == homeCluster {
+			return true
+		}
+		ref := metav1.GetControllerOfNoCopy(obj)
+		return cluster == clusterLocal && ref != nil && uids[ref.UID]
+	}
+
+	for name, client := range clients {
+		pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: "managed-by=ethereal-operator"})
+		if err != nil {
+			slog.Warn("Failed to list pods for cluster cleanup", "cluster", name, "error", err)
+			continue
+		}
+		for _, pod := range pods.Items {
+			cluster, exists := placed[pod.Namespace+"/"+pod.Labels[labelEtherealPod]]
+			if cluster == name || (!exists && name == clusterLocal) || pod.DeletionTimestamp != nil || !ours(name, &pod) {
+				continue
+			}
+			opts := metav1.DeleteOptions{DryRun: planned("delete", "pods", pod.Namespace, pod.Name, "cluster", name, "reason", "StaleCluster")}
+			if err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, opts); err != nil && !apierrors.IsNotFound(err) {
+				slog.Warn("Failed to delete pod left in another cluster", "cluster", name, "pod", pod.Name, "error", err)
+				continue
+			}
+			slog.Info("Deleted pod left in another cluster", "cluster", name, "pod", pod.Namespace+"/"+pod.Name, "runsIn", cluster)
+		}
+
+		// ל-PDB בקלאסטר מרוחק אין owner, אז הוא נמחק לפי אותו כלל כמו הפודים
+		pdbs, err := client.PolicyV1().PodDisruptionBudgets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: "managed-by=ethereal-operator"})
+		if err != nil {
+			slog.Warn("Failed to list PodDisruptionBudgets for cluster cleanup", "cluster", name, "error", err)
+			continue
+		}
+		for _, pdb := range pdbs.Items {
+			cluster, exists := placed[pdb.Namespace+"/"+pdb.Labels[labelEtherealPod]]
+			if cluster == name || (!exists && name == clusterLocal) || !ours(name, &pdb) {
+				continue
+			}
+			opts := metav1.DeleteOptions{DryRun: planned("delete", "poddisruptionbudgets", pdb.Namespace, pdb.Name, "cluster", name, "reason", "StaleCluster")}
+			if err := client.PolicyV1().PodDisruptionBudgets(pdb.Namespace).Delete(ctx, pdb.Name, opts); err != nil && !apierrors.IsNotFound(err) {
+				slog.Warn("Failed to delete PodDisruptionBudget left in another cluster", "cluster", name, "pdb", pdb.Name, "error", err)
+			}
+		}
+	}
+}
+
+// inFlight - פודים שעולים בקלאסטרים המרוחקים, בשביל --max-concurrent-resurrections
+func (r *clusterRegistry) inFlight(ctx context.Context) int {
+	r.mu.Lock()
+	var clients []kubernetes.Interface
+	for _, t := range r.targets {
+		if t.reachable {
+			clients = append(clients, t.client)
+		}
+	}
+	r.mu.Unlock()
+
+	total := 0
+	for _, client := range clients {
+		if n, err := inFlight(ctx, client); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// updateStatuses כותבת את מצב החיבור לכל ClusterTarget, רק כשהוא השתנה
+func (r *clusterRegistry) updateStatuses(ctx context.Context, dyn dynamic.Interface, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.targets {
+		phase := "Unreachable"
+		switch {
+		case t.client == nil:
+			phase = "Invalid"
+		case t.reachable:
+			phase = "Connected"
+		}
+		status := map[string]interface{}{
+			"phase":         phase,
+			"message":       nilIfEmpty(t.message),
+			"serverVersion": nilIfEmpty(t.serverVersion),
+			"etherealPods":  int64(t.placed),
+		}
+		if !t.connectedSince.IsZero() {
+			status["connectedSince"] = t.connectedSince.UTC().Format(time.RFC3339)
+		} else if !t.unreachableSince.IsZero() {
+			status["unreachableSince"] = t.unreachableSince.UTC().Format(time.RFC3339)
+		}
+		for k, v := range status {
+			if v == nil {
+				delete(status, k)
+			}
+		}
+		key := fmt.Sprint(status)
+		if key == t.reported {
+			continue
+		}
+
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(clusterTargetGVR.GroupVersion().String())
+		obj.SetKind("ClusterTarget")
+		obj.SetName(t.name)
+		if err := applyStatusOf(ctx, dyn.Resource(clusterTargetGVR), obj, status); err != nil {
+			slog.Warn("Failed to update ClusterTarget status", "cluster", t.name, "error", err)
+			continue
+		}
+		t.reported = key
+	}
+}
+
+// ownerReferences - ה-EtherealPod קיים רק בקלאסטר של האופרטור. בקלאסטר אחר ה-garbage collector
+// היה מוחק מיד כל אובייקט שמפנה אליו, אז שם האובייקטים נשארים בלי owner
+func ownerReferences(item unstructured.Unstructured, controller bool) []metav1.OwnerReference {
+	if placement(item) != clusterLocal {
+		return nil
+	}
+	ref := ownerReference(item)
+	if controller {
+		ref.Controller = ptr(true)
+		ref.BlockOwnerDeletion = ptr(true)
+	}
+	return []metav1.OwnerReference{ref}
+}
+
+// managedLabels - ה-labels שכל אובייקט שהאופרטור יוצר עבור EtherealPod נושא
+func managedLabels(item unstructured.Unstructured) map[string]string {
+	labels := map[string]string{"managed-by": "ethereal-operator", labelEtherealPod: item.GetName()}
+	if homeCluster != "" {
+		labels[labelHomeCluster] = homeCluster
+	}
+	return labels
+}
+
+// clusterIdentity - ה-UID של kube-system קבוע לאורך חיי הקלאסטר, ולכן משמש כזהות שלו
+func clusterIdentity(ctx context.Context, client kubernetes.Interface) (string, error) {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(ns.UID), nil
+}
+
+func operatorNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return metav1.NamespaceDefault
+}
+
+// targetClient - client לקלאסטר מרוחק, חוץ מ-Events שנכתבים ליד ה-EtherealPod בקלאסטר של האופרטור
+type targetClient struct {
+	kubernetes.Interface
+	home kubernetes.Interface
+}
+
+func (c targetClient) CoreV1() corev1client.CoreV1Interface {
+	return targetCoreV1{CoreV1Interface: c.Interface.CoreV1(), home: c.home.CoreV1()}
+}
+
+type targetCoreV1 struct {
+	corev1client.CoreV1Interface
+	home corev1client.CoreV1Interface
+}
+
+func (c targetCoreV1) Events(namespace string) corev1client.EventInterface {
+	return c.home.Events(namespace)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterFailover(t *testing.T) {
+	now := time.Now()
+	a := &clusterTarget{name: "a", client: kubefake.NewSimpleClientset()}
+	b := &clusterTarget{name: "b", client: kubefake.NewSimpleClientset(), reachable: true, connectedSince: now.Add(-time.Hour)}
+
+	cases := []struct {
+		name string
+		// a - מצב הקלאסטר המועדף; current - איפה הפודים רצים עכשיו
+		reachable bool
+		since     time.Duration
+		current   string
+
+		want        string
+		wantOK      bool
+		wantPending string
+	}{
+		{name: "first placement prefers the first cluster", reachable: true, since: time.Second, want: "a", wantOK: true},
+		{name: "first placement skips an unreachable cluster", since: time.Second, want: "b", wantOK: true},
+		{name: "short outage waits for the current cluster", since: 10 * time.Second, current: "a", want: "a"},
+		{name: "long outage fails over", since: 2 * time.Minute, current: "a", want: "b", wantOK: true, wantPending: reasonClusterFailover},
+		{name: "no failback while the preferred cluster is just back", reachable: true, since: 10 * time.Second, current: "b", want: "b", wantOK: true},
+		{name: "failback once the preferred cluster is stable", reachable: true, since: 2 * time.Minute, current: "b", want: "a", wantOK: true, wantPending: reasonClusterFailover},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "clusters": []interface{}{"a", "b"}})
+			a.reachable, a.connectedSince, a.unreachableSince = tc.reachable, time.Time{}, now.Add(-tc.since)
+			if tc.reachable {
+				a.connectedSince, a.unreachableSince = now.Add(-tc.since), time.Time{}
+			}
+			clusters.targets = map[string]*clusterTarget{"a": a, "b": b}
+			if tc.current != "" {
+				c.edit(t, tc.current, "status", "cluster")
+			}
+
+			item := c.item(t)
+			client, ok := clusters.place(context.Background(), c.client, c.dyn, &item, now)
+			if ok != tc.wantOK {
+				t.Fatalf("place ok = %v, want %v", ok, tc.wantOK)
+			}
+			if got := placement(c.item(t)); got != tc.want {
+				t.Errorf("placed in %s, want %s", got, tc.want)
+			}
+			if ok && client != clusters.targets[tc.want].client {
+				t.Errorf("got the client of another cluster")
+			}
+			pending, _, _ := unstructured.NestedString(item.Object, "status", "healing", "pendingReason")
+			if pending != tc.wantPending {
+				t.Errorf("pendingReason = %q, want %q", pending, tc.wantPending)
+			}
+		})
+	}
+}
+
+// קלאסטר מרוחק משותף לשני אופרטורים: כל אחד מנקה בו רק את מה שנושא את הזהות שלו
+func TestClusterCleanupKeepsOtherOperatorsPods(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "clusters": []interface{}{"a"}})
+	homeCluster = "home"
+	shared := kubefake.NewSimpleClientset()
+	clusters.targets = map[string]*clusterTarget{"a": {name: "a", client: shared, reachable: true}}
+	c.edit(t, "a", "status", "cluster")
+
+	stray := func(name, ethereal, home string) *corev1.Pod {
+		labels := map[string]string{"managed-by": "ethereal-operator", labelEtherealPod: ethereal}
+		if home != "" {
+			labels[labelHomeCluster] = home
+		}
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}
+	}
+	for _, pod := range []*corev1.Pod{
+		stray("ours", "deleted-ghost", "home"),              // EtherealPod שנמחק אצלנו
+		stray("placed-here", "ghost", "home"),               // ה-EtherealPod רץ בקלאסטר הזה
+		stray("other-operator", "other-ghost", "elsewhere"), // של אופרטור בקלאסטר אחר
+		stray("unlabeled", "legacy-ghost", ""),              // מלפני ה-label, אי אפשר לדעת של מי
+	} {
+		if err := shared.Tracker().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters.collect(context.Background(), c.client, []unstructured.Unstructured{c.item(t)})
+
+	left := map[string]bool{}
+	pods, err := shared.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range pods.Items {
+		left[pod.Name] = true
+	}
+	if left["ours"] || !left["placed-here"] || !left["other-operator"] || !left["unlabeled"] {
+		t.Errorf("pods left in the shared cluster: %v, want all but ours", left)
+	}
+}
+
+// קלאסטר שמפסיק לענות לא מעכב את הסבב: הבדיקה שלו ממשיכה ברקע, והסבב משתמש בתוצאה האחרונה
+func TestClusterProbeDoesNotBlockThePass(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1"})
+
+	var hang atomic.Bool
+	var probes atomic.Int32
+	release := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if hang.Load() {
+			<-release
+			http.Error(w, "gone", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"gitVersion":"v1.29.0"}`)
+	}))
+	defer dead.Close()
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters: [{name: c, cluster: {server: %q}}]
+contexts: [{name: c, context: {cluster: c, user: u}}]
+current-context: c
+users: [{name: u, user: {}}]
+`, dead.URL)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "dead-kubeconfig", Namespace: operatorNamespace()}, Data: map[string][]byte{"kubeconfig": []byte(kubeconfig)}}
+	if err := c.client.Tracker().Add(secret); err != nil {
+		t.Fatal(err)
+	}
+	target := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sunday.com/v1",
+		"kind":       "ClusterTarget",
+		"metadata":   map[string]interface{}{"name": "dead"},
+		"spec":       map[string]interface{}{"kubeconfigSecretRef": map[string]interface{}{"name": "dead-kubeconfig"}},
+	}}
+	if err := c.dyn.Tracker().Create(clusterTargetGVR, target, ""); err != nil {
+		t.Fatal(err)
+	}
+	state := func() (reachable, probing bool) {
+		clusters.mu.Lock()
+		defer clusters.mu.Unlock()
+		tg := clusters.targets["dead"]
+		return tg.reachable, tg.probing != nil
+	}
+
+	// הבדיקה הראשונה של קלאסטר חדש היא היחידה שהסבב מחכה לה
+	clusters.sync(context.Background(), c.client, c.dyn)
+	if reachable, _ := state(); !reachable {
+		t.Fatal("the first sync did not wait for the first probe")
+	}
+
+	hang.Store(true)
+	defer close(release)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		clusters.sync(context.Background(), c.client, c.dyn)
+		if took := time.Since(start); took > time.Second {
+			t.Fatalf("sync %d took %s while the cluster hangs", i, took)
+		}
+	}
+	reachable, probing := state()
+	if !reachable || !probing {
+		t.Errorf("while the probe hangs: reachable %v, probing %v; want the last result and one probe in flight", reachable, probing)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for probes.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := probes.Load(); n != 2 {
+		t.Errorf("%d probes reached the cluster, want one per sync that found no probe in flight (2)", n)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule הוא ביטוי cron רגיל בן 5 שדות (דקה, שעה, יום בחודש, חודש, יום בשבוע).
+// אין ספריית cron ב-vendor, וצריך רק את החישוב של ההרצה הקודמת והבאה
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bitset של ערכים מותרים
+	domAny, dowAny                bool
+	location                      *time.Location
+}
+
+// כמה ימים אחורה/קדימה מחפשים הרצה (ביטוי כמו 29 בפברואר רץ פעם ב-4 שנים)
+const cronSearchDays = 5 * 366
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func parseCron(expr string, location *time.Location) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	c := &cronSchedule{location: location}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	days := map[string]int{}
+	for name, d := range weekdays {
+		days[name] = int(d)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, days); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 הוא גם יום ראשון
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField מפרש רשימה של ערכים, טווחים (1-5) וצעדים (*/15, 10-50/10)
+func parseCronField(field string, low, high int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		if n < low || n > high {
+			return 0, fmt.Errorf("%d out of range %d-%d", n, low, high)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		from, to := low, high
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if to, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			from = n
+			if step == 1 {
+				to = n
+			}
+		}
+
+		for n := from; n <= to; n += step {
+			bits |= 1 << n
+		}
+	}
+	return bits, nil
+}
+
+// matchDay - כמו ב-cron רגיל: אם גם היום בחודש וגם היום בשבוע מוגבלים, מספיק שאחד מהם מתאים
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	if c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := c.dom&(1<<t.Day()) != 0, c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// next מחזירה את ההרצה הראשונה אחרי after
+func (c *cronSchedule) next(after time.Time) (time.Time, bool) {
+	return c.search(after, 1, func(t time.Time) bool { return t.After(after) })
+}
+
+// prev מחזירה את ההרצה האחרונה שלא אחרי at
+func (c *cronSchedule) prev(at time.Time) (time.Time, bool) {
+	return c.search(at, -1, func(t time.Time) bool { return !t.After(at) })
+}
+
+// search עוברת יום אחרי יום בכיוון dir, ובכל יום מתאים על השעות והדקות לפי הסדר
+func (c *cronSchedule) search(from time.Time, dir int, ok func(time.Time) bool) (time.Time, bool) {
+	local := from.In(c.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.location)
+
+	for i := 0; i < cronSearchDays; i++ {
+		if c.matchDay(day) {
+			for h := 0; h < 24; h++ {
+				hour := h
+				if dir < 0 {
+					hour = 23 - h
+				}
+				if c.hour&(1<<hour) == 0 {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					minute := m
+					if dir < 0 {
+						minute = 59 - m
+					}
+					if c.minute&(1<<minute) == 0 {
+						continue
+					}
+					if t := c.at(day, hour, minute); ok(t) {
+						return t, true
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, dir)
+	}
+	return time.Time{}, false
+}
+
+// at - השעה hour:minute ב-day. שעה שלא קיימת כי השעון קפץ קדימה (DST) עוברת לאותו מרחק אחרי
+// הקפיצה, כמו שהייתה יוצאת בשעון של לפני הקפיצה (02:30 הופך ל-03:30). time.Date לבדה לא מבטיחה
+// לאיזה צד היא תעבור, ולפעמים מחזירה שעה לפני הקפיצה - הרצה מוקדמת בשעה
+func (c *cronSchedule) at(day time.Time, hour, minute int) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, c.location)
+	if t.Hour() == hour && t.Minute() == minute {
+		return t
+	}
+	_, offset := day.Zone()
+	before := time.FixedZone("", offset)
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, before).In(c.location)
+}
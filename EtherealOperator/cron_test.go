@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	bits := func(values ...int) uint64 {
+		var b uint64
+		for _, v := range values {
+			b |= 1 << v
+		}
+		return b
+	}
+
+	cases := []struct {
+		name    string
+		expr    string
+		minute  uint64
+		hour    uint64
+		dow     uint64
+		month   uint64
+		wantErr bool
+	}{
+		{name: "step over everything", expr: "*/15 * * * *", minute: bits(0, 15, 30, 45)},
+		{name: "step over a range", expr: "10-50/20 * * * *", minute: bits(10, 30, 50)},
+		{name: "step from a value", expr: "50/5 * * * *", minute: bits(50, 55)},
+		{name: "list of values and ranges", expr: "0 1,3,20-22 * * *", minute: bits(0), hour: bits(1, 3, 20, 21, 22)},
+		{name: "day names", expr: "0 0 * * mon-wed,FRI", minute: bits(0), hour: bits(0), dow: bits(1, 2, 3, 5)},
+		{name: "month names", expr: "0 0 1 jan,Jul-aug *", minute: bits(0), hour: bits(0), month: bits(1, 7, 8)},
+		{name: "sunday as 0", expr: "0 0 * * 0", minute: bits(0), hour: bits(0), dow: bits(0)},
+		{name: "sunday as 7", expr: "0 0 * * 7", minute: bits(0), hour: bits(0), dow: bits(0, 7)},
+		{name: "sunday to saturday through 7", expr: "0 0 * * 5-7", minute: bits(0), hour: bits(0), dow: bits(0, 5, 6, 7)},
+		{name: "macro", expr: "@hourly", minute: bits(0)},
+		{name: "too few fields", expr: "0 0 * *", wantErr: true},
+		{name: "out of range", expr: "60 * * * *", wantErr: true},
+		{name: "reversed range", expr: "0 5-1 * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "unknown name", expr: "0 0 * * funday", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseCron(tc.expr, time.UTC)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseCron(%q) accepted an invalid expression", tc.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.minute != tc.minute {
+				t.Errorf("minute = %b, want %b", c.minute, tc.minute)
+			}
+			if tc.hour != 0 && c.hour != tc.hour {
+				t.Errorf("hour = %b, want %b", c.hour, tc.hour)
+			}
+			if tc.dow != 0 && c.dow != tc.dow {
+				t.Errorf("day of week = %b, want %b", c.dow, tc.dow)
+			}
+			if tc.month != 0 && c.month != tc.month {
+				t.Errorf("month = %b, want %b", c.month, tc.month)
+			}
+		})
+	}
+}
+
+func TestCronNextPrev(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	at := func(loc *time.Location, value string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		name     string
+		expr     string
+		loc      *time.Location
+		from     string
+		wantNext string
+		wantPrev string
+	}{
+		{name: "every 15 minutes", expr: "*/15 * * * *", loc: time.UTC, from: "2026-03-10 10:07", wantNext: "2026-03-10 10:15", wantPrev: "2026-03-10 10:00"},
+		{name: "an exact run is its own prev but not its next", expr: "0 3 * * *", loc: time.UTC, from: "2026-03-10 03:00", wantNext: "2026-03-11 03:00", wantPrev: "2026-03-10 03:00"},
+		{name: "across the year boundary", expr: "30 23 31 12 *", loc: time.UTC, from: "2026-12-31 23:45", wantNext: "2027-12-31 23:30", wantPrev: "2026-12-31 23:30"},
+		{name: "new year backwards", expr: "0 0 1 1 *", loc: time.UTC, from: "2026-01-01 00:00", wantNext: "2027-01-01 00:00", wantPrev: "2026-01-01 00:00"},
+		{name: "february 29th", expr: "0 12 29 2 *", loc: time.UTC, from: "2026-03-01 00:00", wantNext: "2028-02-29 12:00", wantPrev: "2024-02-29 12:00"},
+		// dom וגם dow מוגבלים: מספיק שאחד מהם מתאים. 13 במרץ 2026 הוא יום שישי
+		{name: "day of month or day of week", expr: "0 9 13 * 1", loc: time.UTC, from: "2026-03-10 10:00", wantNext: "2026-03-13 09:00", wantPrev: "2026-03-09 09:00"},
+		{name: "only day of week restricted", expr: "0 9 * * 1", loc: time.UTC, from: "2026-03-10 10:00", wantNext: "2026-03-16 09:00", wantPrev: "2026-03-09 09:00"},
+		{name: "sunday as 7", expr: "0 9 * * 7", loc: time.UTC, from: "2026-03-10 10:00", wantNext: "2026-03-15 09:00", wantPrev: "2026-03-08 09:00"},
+		// ב-8 במרץ 2026 השעון בניו יורק קופץ מ-02:00 ל-03:00. הרצה ב-02:30 לא קיימת ועוברת ל-03:30
+		{name: "spring forward skips the missing hour", expr: "30 2 * * *", loc: newYork, from: "2026-03-08 01:00", wantNext: "2026-03-08 03:30", wantPrev: "2026-03-07 02:30"},
+		{name: "spring forward hourly", expr: "0 * * * *", loc: newYork, from: "2026-03-08 01:30", wantNext: "2026-03-08 03:00", wantPrev: "2026-03-08 01:00"},
+		// ב-1 בנובמבר 2026 השעה 01:00-02:00 חוזרת פעמיים. ההרצה היא פעם אחת, בראשונה
+		{name: "fall back runs once", expr: "30 1 * * *", loc: newYork, from: "2026-11-01 01:45", wantNext: "2026-11-02 01:30", wantPrev: "2026-11-01 01:30"},
+		{name: "daily in local time across DST", expr: "0 6 * * *", loc: newYork, from: "2026-03-07 12:00", wantNext: "2026-03-08 06:00", wantPrev: "2026-03-07 06:00"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseCron(tc.expr, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := at(tc.loc, tc.from)
+			next, found := c.next(from)
+			if want := at(tc.loc, tc.wantNext); !found || !next.Equal(want) {
+				t.Errorf("next(%s) = %s, want %s", from, next, want)
+			}
+			prev, found := c.prev(from)
+			if want := at(tc.loc, tc.wantPrev); !found || !prev.Equal(want) {
+				t.Errorf("prev(%s) = %s, want %s", from, prev, want)
+			}
+		})
+	}
+
+	t.Run("expression that never runs", func(t *testing.T) {
+		c, err := parseCron("0 0 31 2 *", time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next, found := c.next(time.Now()); found {
+			t.Errorf("next = %s for February 31st", next)
+		}
+	})
+}
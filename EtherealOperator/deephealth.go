@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	conditionDegraded = "Degraded"
+	reasonDegraded    = "Degraded"
+)
+
+// deepHealthSettings היא spec.healthCheck.deep: בדיקה תקופתית של /status של SundayApp
+type deepHealthSettings struct {
+	path          string
+	port          int
+	period        time.Duration
+	maxDBLatency  time.Duration
+	maxLatency    time.Duration
+	maxErrorRatio float64 // אחוזים
+	historySize   int
+}
+
+func readDeepHealthSettings(spec map[string]interface{}) *deepHealthSettings {
+	m, found, _ := unstructured.NestedMap(spec, "healthCheck", "deep")
+	if !found {
+		return nil
+	}
+	s := &deepHealthSettings{
+		path: "/status", port: 8080, period: 30 * time.Second,
+		maxDBLatency: 500 * time.Millisecond, maxLatency: time.Second, maxErrorRatio: 5, historySize: 10,
+	}
+	if v, _, _ := unstructured.NestedString(m, "path"); v != "" {
+		s.path = v
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "port"); found && v > 0 {
+		s.port = int(v)
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "periodSeconds"); found && v > 0 {
+		s.period = time.Duration(v) * time.Second
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "maxDBLatencyMs"); found && v > 0 {
+		s.maxDBLatency = time.Duration(v) * time.Millisecond
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "maxLatencyMs"); found && v > 0 {
+		s.maxLatency = time.Duration(v) * time.Millisecond
+	}
+	if v, found := numberField(m, "maxErrorRatioPercent"); found && v >= 0 {
+		s.maxErrorRatio = v
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "historySize"); found && v > 0 {
+		s.historySize = int(min(v, 20))
+	}
+	return s
+}
+
+// appStatus היא התשובה של /status ב-SundayApp
+type appStatus struct {
+	Status string `json:"status"`
+	DB     struct {
+		Reachable bool   `json:"reachable"`
+		LatencyMs int64  `json:"latencyMs"`
+		Error     string `json:"error"`
+	} `json:"db"`
+	Requests struct {
+		Window       int64   `json:"window"`
+		ErrorRatio   float64 `json:"errorRatio"`
+		AvgLatencyMs int64   `json:"avgLatencyMs"`
+	} `json:"requests"`
+}
+
+// probeResult היא תוצאה של בדיקה אחת של פוד
+type probeResult struct {
+	pod          string
+	at           time.Time
+	healthy      bool
+	problems     []string
+	dbLatencyMs  int64
+	latencyMs    int64
+	errorPercent float64
+}
+
+func (r probeResult) toStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"time":              r.at.UTC().Format(time.RFC3339),
+		"pod":               r.pod,
+		"healthy":           r.healthy,
+		"problems":          strings.Join(r.problems, "; "),
+		"dbLatencyMs":       r.dbLatencyMs,
+		"latencyMs":         r.latencyMs,
+		"errorRatioPercent": r.errorPercent,
+	}
+}
+
+// statusFetcher מחזירה את גוף התשובה של path בפוד. בקלאסטר זה דרך ה-proxy של ה-API server,
+// ובבדיקות אפשר להחליף אותה בשרת httptest
+type statusFetcher func(ctx context.Context, pod *corev1.Pod, path string, port int) ([]byte, error)
+
+func proxyFetcher(client kubernetes.Interface) statusFetcher {
+	return func(ctx context.Context, pod *corev1.Pod, path string, port int) ([]byte, error) {
+		result := client.CoreV1().RESTClient().Get().Namespace(pod.Namespace).Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, port)).SubResource("proxy").Suffix(path).Do(ctx)
+		// /status מחזיר 503 כשהוא degraded, אבל עם גוף שצריך לנתח
+		var code int
+		body, err := result.StatusCode(&code).Raw()
+		if code == 0 {
+			return nil, err
+		}
+		return body, nil
+	}
+}
+
+// probePods בודקת כל פוד רץ ומחזירה את התוצאות; לא נוגעת ב-API של Kubernetes
+func probePods(ctx context.Context, fetch statusFetcher, pods []*corev1.Pod, s *deepHealthSettings, now time.Time) []probeResult {
+	var results []probeResult
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		body, err := fetch(ctx, pod, s.path, s.port)
+		if err != nil {
+			results = append(results, probeResult{pod: pod.Name, at: now, problems: []string{"unreachable: " + err.Error()}})
+			continue
+		}
+		results = append(results, s.evaluate(pod.Name, body, now))
+	}
+	return results
+}
+
+// evaluate מנתחת את התשובה של /status מול הספים
+func (s *deepHealthSettings) evaluate(pod string, body []byte, now time.Time) probeResult {
+	r := probeResult{pod: pod, at: now}
+	var st appStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		r.problems = append(r.problems, "invalid status response: "+err.Error())
+		return r
+	}
+
+	r.dbLatencyMs, r.latencyMs, r.errorPercent = st.DB.LatencyMs, st.Requests.AvgLatencyMs, st.Requests.ErrorRatio*100
+	if !st.DB.Reachable {
+		r.problems = append(r.problems, "database unreachable: "+st.DB.Error)
+	} else if time.Duration(st.DB.LatencyMs)*time.Millisecond > s.maxDBLatency {
+		r.problems = append(r.problems, fmt.Sprintf("database latency %dms > %s", st.DB.LatencyMs, s.maxDBLatency))
+	}
+	if r.errorPercent > s.maxErrorRatio {
+		r.problems = append(r.problems, fmt.Sprintf("error ratio %.1f%% > %.1f%%", r.errorPercent, s.maxErrorRatio))
+	}
+	if time.Duration(st.Requests.AvgLatencyMs)*time.Millisecond > s.maxLatency {
+		r.problems = append(r.problems, fmt.Sprintf("request latency %dms > %s", st.Requests.AvgLatencyMs, s.maxLatency))
+	}
+	if len(r.problems) == 0 && st.Status != "" && st.Status != "ok" {
+		r.problems = append(r.problems, "app reports "+st.Status)
+	}
+	r.healthy = len(r.problems) == 0
+	return r
+}
+
+// degradedSince מעדכנת ממתי כל פוד degraded ברציפות; פוד תקין יוצא מהמפה
+func degradedSince(previous map[string]time.Time, results []probeResult) map[string]time.Time {
+	since := map[string]time.Time{}
+	for _, r := range results {
+		if r.healthy {
+			continue
+		}
+		if t, ok := previous[r.pod]; ok {
+			since[r.pod] = t
+		} else {
+			since[r.pod] = r.at
+		}
+	}
+	return since
+}
+
+// recycleDue - המדיניות מחליטה אם להחליף פוד degraded, ואחרי כמה זמן. בלי מדיניות רק מדווחים
+func (p *healingPolicy) recycleDue(since, now time.Time) bool {
+	return p != nil && p.recycleDegraded && now.Sub(since) >= p.degradedFor
+}
+
+// runDeepHealth בודקת את הפודים כל period, שומרת היסטוריה קצרה ב-status.deepHealth,
+// מעדכנת את ה-condition Degraded ומחזירה את הפודים שהמדיניות אומרת להחליף
+func runDeepHealth(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, s *deepHealthSettings, fetch statusFetcher, pods []*corev1.Pod, policy *healingPolicy, now time.Time) []*corev1.Pod {
+	status, _, _ := unstructured.NestedMap(item.Object, "status", "deepHealth")
+	if last := latestTime(status, "lastProbe"); now.Sub(last) < s.period {
+		return nil
+	}
+
+	results := probePods(ctx, fetch, pods, s, now)
+
+	previous := map[string]time.Time{}
+	if m, ok := status["degradedSince"].(map[string]interface{}); ok {
+		for pod, v := range m {
+			if t, err := time.Parse(time.RFC3339, fmt.Sprint(v)); err == nil {
+				previous[pod] = t
+			}
+		}
+	}
+	since := degradedSince(previous, results)
+
+	history, _ := status["history"].([]interface{})
+	for _, r := range results {
+		history = append([]interface{}{r.toStatus()}, history...)
+	}
+	if len(history) > s.historySize {
+		history = history[:s.historySize]
+	}
+	sinceStatus := map[string]interface{}{}
+	for pod, t := range since {
+		sinceStatus[pod] = t.UTC().Format(time.RFC3339)
+	}
+
+	// קודם מוחקים את degradedSince, כדי ש-merge patch לא ישאיר פודים שכבר תקינים
+	err := patchStatus(ctx, dyn, item, map[string]interface{}{"deepHealth": map[string]interface{}{"degradedSince": nil}})
+	if err == nil {
+		err = patchStatus(ctx, dyn, item, map[string]interface{}{"deepHealth": map[string]interface{}{
+			"lastProbe":     now.UTC().Format(time.RFC3339),
+			"history":       history,
+			"degradedSince": sinceStatus,
+		}})
+	}
+	if err != nil {
+		slog.Warn("Failed to record deep health probe", "name", item.GetName(), "error", err)
+	}
+
+	cond := metav1.Condition{Type: conditionDegraded, Status: metav1.ConditionFalse, Reason: "Healthy", Message: "All pods pass the deep health probe"}
+	var unhealthy []string
+	for _, r := range results {
+		if !r.healthy {
+			unhealthy = append(unhealthy, r.pod+": "+strings.Join(r.problems, ", "))
+		}
+	}
+	if len(unhealthy) > 0 {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionTrue, "ProbeFailed", strings.Join(unhealthy, "; ")
+	}
+	if err := setConditions(ctx, dyn, item, cond); err != nil {
+		slog.Warn("Failed to update degraded condition", "name", item.GetName(), "error", err)
+	}
+
+	var recycle []*corev1.Pod
+	for _, pod := range pods {
+		if t, ok := since[pod.Name]; ok && policy.recycleDue(t, now) {
+			recycle = append(recycle, pod)
+		}
+	}
+	return recycle
+}
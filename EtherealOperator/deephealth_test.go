@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// statusServer מדמה את /status של SundayApp; כל פוד מקבל את התשובה שמוגדרת עבורו
+func statusServer(t *testing.T, responses map[string]string) statusFetcher {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Query().Get("pod")]
+		if !ok {
+			http.Error(w, "unknown pod", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(body, `"degraded"`) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return func(ctx context.Context, pod *corev1.Pod, path string, port int) ([]byte, error) {
+		resp, err := http.Get(srv.URL + path + "?pod=" + pod.Name)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+func runningPod(name string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+}
+
+func TestProbePods(t *testing.T) {
+	fetch := statusServer(t, map[string]string{
+		"healthy":  `{"status":"ok","db":{"reachable":true,"latencyMs":3},"requests":{"window":200,"errorRatio":0.01,"avgLatencyMs":20}}`,
+		"no-db":    `{"status":"degraded","db":{"reachable":false,"latencyMs":2000,"error":"database is locked"},"requests":{}}`,
+		"slow-db":  `{"status":"ok","db":{"reachable":true,"latencyMs":900},"requests":{"window":10,"avgLatencyMs":20}}`,
+		"errors":   `{"status":"ok","db":{"reachable":true,"latencyMs":3},"requests":{"window":200,"errorRatio":0.25,"avgLatencyMs":20}}`,
+		"slow-app": `{"status":"ok","db":{"reachable":true,"latencyMs":3},"requests":{"window":200,"avgLatencyMs":1500}}`,
+		"garbage":  `not json`,
+	})
+	settings := readDeepHealthSettings(map[string]interface{}{"healthCheck": map[string]interface{}{"deep": map[string]interface{}{}}})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	pending := runningPod("pending")
+	pending.Status.Phase = corev1.PodPending
+	pods := []*corev1.Pod{runningPod("healthy"), runningPod("no-db"), runningPod("slow-db"), runningPod("errors"),
+		runningPod("slow-app"), runningPod("garbage"), runningPod("gone"), pending}
+
+	want := map[string]string{
+		"healthy":  "",
+		"no-db":    "database unreachable: database is locked",
+		"slow-db":  "database latency 900ms",
+		"errors":   "error ratio 25.0%",
+		"slow-app": "request latency 1500ms",
+		"garbage":  "invalid status response",
+		"gone":     "unreachable",
+	}
+
+	results := probePods(context.Background(), fetch, pods, settings, now)
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d (pending pods are skipped)", len(results), len(want))
+	}
+	for _, r := range results {
+		problem := want[r.pod]
+		if r.healthy != (problem == "") {
+			t.Errorf("%s: healthy = %v, problems %q", r.pod, r.healthy, r.problems)
+		}
+		if problem != "" && !strings.Contains(strings.Join(r.problems, "; "), problem) {
+			t.Errorf("%s: problems %q, want %q", r.pod, r.problems, problem)
+		}
+	}
+}
+
+func TestDegradedRecycle(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := &healingPolicy{recycleDegraded: true, degradedFor: time.Minute}
+
+	// פוד degraded נשאר עם זמן ההתחלה המקורי, ופוד שהבריא יוצא מהמפה
+	since := degradedSince(nil, []probeResult{{pod: "a", at: start}, {pod: "b", at: start, healthy: true}})
+	later := start.Add(90 * time.Second)
+	since = degradedSince(since, []probeResult{{pod: "a", at: later}, {pod: "b", at: later}})
+
+	if !since["a"].Equal(start) {
+		t.Errorf("a degraded since %v, want %v", since["a"], start)
+	}
+	if !since["b"].Equal(later) {
+		t.Errorf("b degraded since %v, want %v", since["b"], later)
+	}
+
+	if !policy.recycleDue(since["a"], later) {
+		t.Error("a should be recycled after 90s of degradation")
+	}
+	if policy.recycleDue(since["b"], later) {
+		t.Error("b was just degraded and should not be recycled yet")
+	}
+
+	var none *healingPolicy
+	if none.recycleDue(since["a"], later) {
+		t.Error("without a policy degraded pods are only reported")
+	}
+	if (&healingPolicy{}).recycleDue(since["a"], later) {
+		t.Error("a policy without degradation.action: Recycle should not recycle")
+	}
+}
+
+// כל הלולאה: בדיקה כל period, היסטוריה ב-status, ה-condition Degraded, ומחזור אחרי degradedFor
+func TestRunDeepHealth(t *testing.T) {
+	healthy := `{"status":"ok","db":{"reachable":true,"latencyMs":3},"requests":{"window":200,"avgLatencyMs":20}}`
+	degraded := `{"status":"degraded","db":{"reachable":false,"error":"database is locked"},"requests":{}}`
+	responses := map[string]string{"a": degraded, "b": healthy}
+	fetch := statusServer(t, responses)
+
+	spec := map[string]interface{}{"image": "sunday-app:v1", "healthCheck": map[string]interface{}{"deep": map[string]interface{}{"periodSeconds": int64(30), "historySize": int64(5)}}}
+	c := newTestCluster(t, spec)
+	settings := readDeepHealthSettings(spec)
+	policy := &healingPolicy{recycleDegraded: true, degradedFor: time.Minute}
+	pods := []*corev1.Pod{runningPod("a"), runningPod("b")}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	probe := func(now time.Time) []*corev1.Pod {
+		t.Helper()
+		return runDeepHealth(context.Background(), c.client, c.dyn, c.item(t), settings, fetch, pods, policy, now)
+	}
+	history := func() []interface{} {
+		t.Helper()
+		h, _, _ := unstructured.NestedSlice(c.item(t).Object, "status", "deepHealth", "history")
+		return h
+	}
+
+	if recycle := probe(start); len(recycle) != 0 {
+		t.Fatalf("recycled %d pods on the first failed probe", len(recycle))
+	}
+	if h := history(); len(h) != 2 {
+		t.Fatalf("history has %d entries after one probe of two pods, want 2", len(h))
+	}
+	item := c.item(t)
+	if conditionStatus(item, conditionDegraded) != metav1.ConditionTrue {
+		t.Errorf("Degraded condition is not True with pod a failing: %v", item.Object["status"])
+	}
+	if since, _, _ := unstructured.NestedString(item.Object, "status", "deepHealth", "degradedSince", "a"); since != start.Format(time.RFC3339) {
+		t.Errorf("degradedSince.a = %q, want %s", since, start.Format(time.RFC3339))
+	}
+
+	// בתוך ה-period לא בודקים שוב
+	probe(start.Add(10 * time.Second))
+	if h := history(); len(h) != 2 {
+		t.Errorf("probed again within periodSeconds: %d history entries", len(h))
+	}
+
+	recycle := probe(start.Add(90 * time.Second))
+	if len(recycle) != 1 || recycle[0].Name != "a" {
+		t.Fatalf("recycle = %v, want pod a after degradedFor", recycle)
+	}
+	if h := history(); len(h) != 4 {
+		t.Errorf("history has %d entries after two probes, want 4", len(h))
+	}
+
+	// ההיסטוריה נחתכת ב-historySize, והפוד שהבריא יוצא מ-degradedSince
+	responses["a"] = healthy
+	if recycle := probe(start.Add(2 * time.Minute)); len(recycle) != 0 {
+		t.Errorf("recycled a healthy pod: %v", recycle)
+	}
+	item = c.item(t)
+	if h := history(); len(h) != 5 {
+		t.Errorf("history has %d entries, want historySize 5", len(h))
+	}
+	if conditionStatus(item, conditionDegraded) != metav1.ConditionFalse {
+		t.Error("Degraded condition is still True after all pods recovered")
+	}
+	if since, _, _ := unstructured.NestedMap(item.Object, "status", "deepHealth", "degradedSince"); len(since) != 0 {
+		t.Errorf("degradedSince = %v after all pods recovered", since)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	conditionAvailable            = "Available"
+	conditionDependenciesResolved = "DependenciesResolved"
+)
+
+// dependencyGraph מחזיק את כל ה-EtherealPods של הסבב הנוכחי, לפי namespace/name
+type dependencyGraph struct {
+	items map[string]unstructured.Unstructured
+	// cyclic - EtherealPods שנמצאים על מעגל תלויות
+	cyclic map[string]bool
+	// blockedBy - לכל EtherealPod שנמצא על מעגל או תלוי בו (גם בעקיפין): EtherealPod מהמעגל
+	blockedBy map[string]string
+}
+
+func newDependencyGraph(items []unstructured.Unstructured) *dependencyGraph {
+	g := &dependencyGraph{items: map[string]unstructured.Unstructured{}, cyclic: map[string]bool{}, blockedBy: map[string]string{}}
+	for _, item := range items {
+		g.items[item.GetNamespace()+"/"+item.GetName()] = item
+	}
+	g.findCycles()
+	return g
+}
+
+// edges - התלויות של key שקיימות בגרף, כמפתחות namespace/name
+func (g *dependencyGraph) edges(key string) []string {
+	ns, _, _ := strings.Cut(key, "/")
+	var out []string
+	for _, name := range dependsOn(g.items[key]) {
+		if _, ok := g.items[ns+"/"+name]; ok {
+			out = append(out, ns+"/"+name)
+		}
+	}
+	return out
+}
+
+// findCycles מוצאת את כל המעגלים בגרף בבת אחת (רכיבים קשירים היטב, Tarjan), ואז מסמנת כל
+// EtherealPod שמגיע למעגל: גם מי שרק תלוי במעגל לא יקום לעולם, ולא רק מי שנמצא עליו
+func (g *dependencyGraph) findCycles() {
+	keys := make([]string, 0, len(g.items))
+	for key := range g.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	index, low, onStack := map[string]int{}, map[string]int{}, map[string]bool{}
+	var stack []string
+	var connect func(v string)
+	connect = func(v string) {
+		index[v], low[v] = len(index), len(index)
+		stack = append(stack, v)
+		onStack[v] = true
+		selfLoop := false
+		for _, w := range g.edges(v) {
+			if _, seen := index[w]; !seen {
+				connect(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+			selfLoop = selfLoop || w == v
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			for _, w := range component {
+				g.cyclic[w] = true
+				g.blockedBy[w] = w
+			}
+		}
+	}
+	for _, key := range keys {
+		if _, seen := index[key]; !seen {
+			connect(key)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, key := range keys {
+			if g.blockedBy[key] != "" {
+				continue
+			}
+			for _, dep := range g.edges(key) {
+				if member := g.blockedBy[dep]; member != "" {
+					g.blockedBy[key], changed = member, true
+					break
+				}
+			}
+		}
+	}
+}
+
+// dependsOn מחזירה את spec.dependsOn; התלויות תמיד באותו namespace
+func dependsOn(item unstructured.Unstructured) []string {
+	deps, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "dependsOn")
+	return deps
+}
+
+// cycle מחפשת (DFS) מסלול תלויות שחוזר ל-item, ומחזירה אותו כרשימת שמות
+func (g *dependencyGraph) cycle(item unstructured.Unstructured) []string {
+	ns := item.GetNamespace()
+	visited := map[string]bool{}
+
+	var walk func(name string, path []string) []string
+	walk = func(name string, path []string) []string {
+		dep, ok := g.items[ns+"/"+name]
+		if !ok {
+			return nil
+		}
+		for _, next := range dependsOn(dep) {
+			if next == item.GetName() {
+				return append(path, next)
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if found := walk(next, append(path, next)); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return walk(item.GetName(), []string{item.GetName()})
+}
+
+// blockingCycle - המעגל ש-item נמצא עליו או תלוי בו, ו-true אם item עצמו על המעגל
+func (g *dependencyGraph) blockingCycle(item unstructured.Unstructured) ([]string, bool) {
+	key := item.GetNamespace() + "/" + item.GetName()
+	member, ok := g.items[g.blockedBy[key]]
+	if !ok {
+		return nil, false
+	}
+	return g.cycle(member), g.cyclic[key]
+}
+
+// waitingFor מחזירה את התלויות שעדיין לא מדווחות Available (או לא קיימות בכלל)
+func (g *dependencyGraph) waitingFor(item unstructured.Unstructured) []string {
+	var waiting []string
+	for _, name := range dependsOn(item) {
+		dep, ok := g.items[item.GetNamespace()+"/"+name]
+		if !ok {
+			waiting = append(waiting, name+" (not found)")
+			continue
+		}
+		if conditionStatus(dep, conditionAvailable) != metav1.ConditionTrue {
+			waiting = append(waiting, name)
+		}
+	}
+	return waiting
+}
+
+// checkDependencies מעדכנת את ה-condition DependenciesResolved (גם כשהפוד רץ, כדי שמעגל יתגלה מיד)
+// ומחזירה false והודעה אם אסור להקים את הפוד עדיין
+func checkDependencies(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, g *dependencyGraph) (bool, string) {
+	if len(dependsOn(item)) == 0 {
+		return true, ""
+	}
+
+	cond := metav1.Condition{Type: conditionDependenciesResolved, Status: metav1.ConditionTrue, Reason: "DependenciesAvailable", Message: "All dependencies are available"}
+	if cycle, onCycle := g.blockingCycle(item); cycle != nil {
+		cond.Status, cond.Reason = metav1.ConditionFalse, "DependencyCycle"
+		cond.Message = "Dependency cycle: " + strings.Join(cycle, " -> ")
+		if !onCycle {
+			cond.Message = "Depends on a dependency cycle: " + strings.Join(cycle, " -> ")
+		}
+	} else if waiting := g.waitingFor(item); len(waiting) > 0 {
+		cond.Status, cond.Reason = metav1.ConditionFalse, "WaitingForDependencies"
+		cond.Message = "Waiting for " + strings.Join(waiting, ", ")
+	}
+
+	if err := setConditions(ctx, dyn, item, cond); err != nil {
+		slog.Warn("Failed to update dependency condition", "name", item.GetName(), "error", err)
+	}
+	return cond.Status == metav1.ConditionTrue, cond.Message
+}
+
+// setWaitingReason כותבת את status.waitingReason (עמודה ב-kubectl get ep), רק כשהוא משתנה
+func setWaitingReason(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, reason string) {
+	current, _, _ := unstructured.NestedString(item.Object, "status", "waitingReason")
+	if current == reason {
+		return
+	}
+
+	var value interface{}
+	if reason != "" {
+		value = reason
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"waitingReason": value}); err != nil {
+		slog.Warn("Failed to update waiting reason", "name", item.GetName(), "error", err)
+	}
+}
+
+// availability מחשבת את ה-condition Available: מספיק רפליקות זמינות לפי maxUnavailable, כמו ב-Deployment
+func availability(set podSet, replicas int, strategy rolloutStrategy, now time.Time) metav1.Condition {
+	available := countAvailable(set.current, strategy.minReady, now) + countAvailable(set.old, strategy.minReady, now)
+	required := replicas - strategy.maxUnavailable
+	if required < 1 {
+		required = 1
+	}
+
+	cond := metav1.Condition{Type: conditionAvailable, Status: metav1.ConditionFalse}
+	switch {
+	case replicas == 0:
+		cond.Reason, cond.Message = "ScaledToZero", "spec.replicas is 0"
+	case available >= required:
+		cond.Status, cond.Reason = metav1.ConditionTrue, "MinimumReplicasAvailable"
+		cond.Message = fmt.Sprintf("%d of %d replicas available", available, replicas)
+	case set.alive() == 0 && len(set.terminated) > 0:
+		cond.Reason = "PodFailed"
+		cond.Message = fmt.Sprintf("Pod %s failed: %s", set.terminated[0].Name, failureReason(set.terminated[0]))
+	case set.alive() == 0:
+		cond.Reason, cond.Message = "PodMissing", "No managed pods exist"
+	default:
+		cond.Reason = "MinimumReplicasUnavailable"
+		cond.Message = fmt.Sprintf("%d of %d replicas available, %d required", available, replicas, required)
+	}
+	return cond
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func dependentItem(namespace, name string, deps ...string) unstructured.Unstructured {
+	spec := map[string]interface{}{"image": "sunday-app:v1"}
+	if len(deps) > 0 {
+		list := make([]interface{}, len(deps))
+		for i, d := range deps {
+			list[i] = d
+		}
+		spec["dependsOn"] = list
+	}
+	item := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sunday.com/v1",
+		"kind":       "EtherealPod",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}}
+	return item
+}
+
+func TestDependencyCycles(t *testing.T) {
+	items := []unstructured.Unstructured{
+		dependentItem("default", "a", "b"),
+		dependentItem("default", "b", "a"),
+		dependentItem("default", "c", "a"), // תלוי במעגל
+		dependentItem("default", "d", "c"), // תלוי במעגל בעקיפין
+		dependentItem("default", "e", "f"), // שרשרת רגילה
+		dependentItem("default", "f"),
+		dependentItem("default", "g", "g"),      // תלוי בעצמו
+		dependentItem("default", "h", "ghost"),  // תלות שלא קיימת
+		dependentItem("other", "c", "a"),        // אותו שם ב-namespace אחר, ו-other/a לא קיים
+		dependentItem("default", "w", "x", "y"), // מעגל שה-DFS מגיע לחלק ממנו דרך קשת רוחבית
+		dependentItem("default", "x", "w"),
+		dependentItem("default", "y", "x"),
+	}
+	g := newDependencyGraph(items)
+
+	cases := []struct {
+		namespace, name string
+		wantCycle       bool
+		wantOnCycle     bool
+	}{
+		{"default", "a", true, true},
+		{"default", "b", true, true},
+		{"default", "c", true, false},
+		{"default", "d", true, false},
+		{"default", "e", false, false},
+		{"default", "f", false, false},
+		{"default", "g", true, true},
+		{"default", "h", false, false},
+		{"other", "c", false, false},
+		{"default", "w", true, true},
+		{"default", "x", true, true},
+		{"default", "y", true, true},
+	}
+	for _, tc := range cases {
+		item := g.items[tc.namespace+"/"+tc.name]
+		cycle, onCycle := g.blockingCycle(item)
+		if (cycle != nil) != tc.wantCycle || onCycle != tc.wantOnCycle {
+			t.Errorf("%s/%s: cycle %v, on it %v; want a cycle %v, on it %v", tc.namespace, tc.name, cycle, onCycle, tc.wantCycle, tc.wantOnCycle)
+			continue
+		}
+		if onCycle && (cycle[0] != tc.name || cycle[len(cycle)-1] != tc.name) {
+			t.Errorf("%s/%s: cycle %v does not start and end with the item", tc.namespace, tc.name, cycle)
+		}
+	}
+}
+
+// כל מי שנמצא על מעגל או תלוי בו מקבל waitingReason, גם לפני שיש לו פודים וגם כשהם רצים
+func TestDependencyCycleWaitingReason(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "dependsOn": []interface{}{"a"}})
+	for _, item := range []unstructured.Unstructured{dependentItem("default", "a", "b"), dependentItem("default", "b", "a"), dependentItem("default", "solo")} {
+		item := item
+		fillMeta(&item)
+		if err := c.dyn.Tracker().Create(gvr, &item, "default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.settle(t)
+
+	want := map[string]string{
+		"ghost": "Depends on a dependency cycle: a -> b -> a",
+		"a":     "Dependency cycle: a -> b -> a",
+		"b":     "Dependency cycle: b -> a -> b",
+		"solo":  "",
+	}
+	for name, reason := range want {
+		item, err := c.dyn.Resource(gvr).Namespace("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ := unstructured.NestedString(item.Object, "status", "waitingReason")
+		if got != reason {
+			t.Errorf("%s: waitingReason = %q, want %q", name, got, reason)
+		}
+	}
+}
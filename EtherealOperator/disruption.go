@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	policyv1ac "k8s.io/client-go/applyconfigurations/policy/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	metrics.describe("ethereal_drain_handoffs_total", "counter", "Single-replica pods replaced on another node ahead of a node drain.")
+}
+
+// disruptionBudgets - ה-PDB האחרון שנשלח לכל EtherealPod (ולאיזה קלאסטר), כדי לא לשלוח apply בכל סבב
+var disruptionBudgets = &appliedBudgets{byUID: map[types.UID]string{}}
+
+type appliedBudgets struct {
+	mu    sync.Mutex
+	byUID map[types.UID]string
+}
+
+// forget - כמו statuses.forget: EtherealPod שנמחק או עבר ל-replica אחרת
+func (b *appliedBudgets) forget(items []unstructured.Unstructured) {
+	live := map[types.UID]bool{}
+	for _, item := range items {
+		live[item.GetUID()] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for uid := range b.byUID {
+		if !live[uid] {
+			delete(b.byUID, uid)
+		}
+	}
+}
+
+// desiredDisruptionBudget - ה-PDB לפי spec.disruptionBudget. ברירת המחדל היא maxUnavailable 1 עם רפליקות.
+// רפליקה יחידה מקבלת PDB רק כש-spec.disruptionBudget קיים, ואז maxUnavailable 0: הפינוי נחסם עד שהאופרטור
+// מקים חלופה (ראו coordinateDrain). כשהאופרטור למטה, או שאף replica לא מחזיקה את ה-shard, PDB כזה
+// חוסם את ה-drain לתמיד - אז זו בחירה של מי שכותב את ה-EtherealPod. nil כשאין מה להגן עליו
+func desiredDisruptionBudget(item unstructured.Unstructured, spec map[string]interface{}, replicas int) (*policyv1.PodDisruptionBudget, error) {
+	budget, found, _ := unstructured.NestedMap(spec, "disruptionBudget")
+	if replicas == 0 || budget["enabled"] == false || (replicas == 1 && !found) {
+		return nil, nil
+	}
+
+	value := func(field string) (*intstr.IntOrString, error) {
+		switch v := budget[field].(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			return ptr(intstr.FromInt32(int32(v))), nil
+		case string:
+			return ptr(intstr.FromString(v)), nil
+		default:
+			return nil, fmt.Errorf("%s must be an integer or a percentage", field)
+		}
+	}
+	minAvailable, err := value("minAvailable")
+	if err != nil {
+		return nil, err
+	}
+	maxUnavailable, err := value("maxUnavailable")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case minAvailable != nil && maxUnavailable != nil:
+		return nil, fmt.Errorf("set either minAvailable or maxUnavailable, not both")
+	case minAvailable == nil && maxUnavailable == nil && replicas > 1:
+		maxUnavailable = ptr(intstr.FromInt32(1))
+	case minAvailable == nil && maxUnavailable == nil:
+		maxUnavailable = ptr(intstr.FromInt32(0))
+	}
+
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            item.GetName(),
+			Namespace:       item.GetNamespace(),
+			Labels:          managedLabels(item),
+			OwnerReferences: ownerReferences(item, true),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   minAvailable,
+			MaxUnavailable: maxUnavailable,
+			Selector:       replicaSelector(item),
+			// פוד שלא מוכן ממילא לא תורם לזמינות, והאופרטור ירפא אותו - אין סיבה לתקוע בגללו drain
+			UnhealthyPodEvictionPolicy: ptr(policyv1.AlwaysAllow),
+		},
+	}, nil
+}
+
+// reconcileDisruptionBudget יוצרת, מעדכנת או מוחקת את ה-PDB של ה-EtherealPod, רק כשהרצוי השתנה
+func reconcileDisruptionBudget(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, spec map[string]interface{}, replicas int) {
+	desired, err := desiredDisruptionBudget(item, spec, replicas)
+	if err != nil {
+		slog.Warn("Ignoring invalid spec.disruptionBudget", "name", item.GetName(), "error", err)
+		return
+	}
+	// אחרי מעבר קלאסטר ה-PDB צריך להיווצר מחדש גם כשהוא לא השתנה
+	key := placement(item)
+	if desired != nil {
+		data, _ := json.Marshal(desired)
+		key += string(data)
+	}
+	disruptionBudgets.mu.Lock()
+	applied, known := disruptionBudgets.byUID[item.GetUID()]
+	disruptionBudgets.mu.Unlock()
+	if known && applied == key {
+		return
+	}
+
+	pdbs := client.PolicyV1().PodDisruptionBudgets(item.GetNamespace())
+	if desired == nil {
+		// PDB באותו שם שמישהו אחר יצר לא שייך לנו
+		existing, err := pdbs.Get(ctx, item.GetName(), metav1.GetOptions{})
+		if err == nil && existing.Labels[labelEtherealPod] == item.GetName() {
+			opts := metav1.DeleteOptions{DryRun: planned("delete", "poddisruptionbudgets", item.GetNamespace(), item.GetName())}
+			err = pdbs.Delete(ctx, item.GetName(), opts)
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			slog.Warn("Failed to delete PodDisruptionBudget", "name", item.GetName(), "error", err)
+			return
+		}
+	} else {
+		ac := policyv1ac.PodDisruptionBudget(desired.Name, desired.Namespace)
+		if err := toApplyConfiguration(desired, ac); err != nil {
+			slog.Error("Failed to build PodDisruptionBudget", "name", item.GetName(), "error", err)
+			return
+		}
+		if _, err := pdbs.Apply(ctx, ac, applyOptions("poddisruptionbudgets", desired.Namespace, desired.Name)); err != nil {
+			if !reportApplyConflict(ctx, client, item, "poddisruptionbudgets", desired.Name, err) {
+				slog.Warn("Failed to apply PodDisruptionBudget", "name", item.GetName(), "error", err)
+			}
+			return
+		}
+		slog.Info("Applied PodDisruptionBudget", "name", item.GetName(), "minAvailable", desired.Spec.MinAvailable, "maxUnavailable", desired.Spec.MaxUnavailable)
+	}
+
+	disruptionBudgets.mu.Lock()
+	disruptionBudgets.byUID[item.GetUID()] = key
+	disruptionBudgets.mu.Unlock()
+}
+
+// coordinateDrain - רפליקה יחידה עם PDB על node שעושים לו drain (cordon). ה-PDB חוסם את הפינוי, אז האופרטור
+// מקים קודם חלופה על node אחר, ומוחק את הפוד הישן רק כשהחלופה זמינה - ואז ה-drain ממשיך.
+// כשה-storage לא מאפשר שני פודים במקביל, הפוד הישן נמחק מיד כמו פינוי רגיל.
+// true כשיש drain בטיפול, ואז שאר ה-reconcile של הרפליקות מחכה
+func coordinateDrain(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, set podSet, replicas int, request resurrection, strategy rolloutStrategy, now time.Time) ([]resurrection, bool) {
+	if replicas != 1 {
+		return nil, false
+	}
+	// בלי PDB הפינוי לא מחכה לחלופה, והפוד נרפא כמו בכל פינוי
+	if budget, found, _ := unstructured.NestedMap(item.Object, "spec", "disruptionBudget"); !found || budget["enabled"] == false {
+		return nil, false
+	}
+
+	var draining, others []*corev1.Pod
+	for _, pod := range set.current {
+		if nodeDraining(ctx, client, pod.Spec.NodeName) {
+			draining = append(draining, pod)
+		} else {
+			others = append(others, pod)
+		}
+	}
+	if len(draining) == 0 {
+		return nil, false
+	}
+	old := draining[0]
+
+	if !storageAllowsSurge(ctx, client, old) {
+		slog.Info("Node is draining and the pod's storage cannot be shared, releasing it", "name", item.GetName(), "pod", old.Name, "node", old.Spec.NodeName)
+		for _, pod := range draining {
+			retirePod(ctx, client, item, pod, request.policy, reasonNodeDrain)
+		}
+		return nil, true
+	}
+
+	for _, pod := range others {
+		if !podAvailable(pod, strategy.minReady, now) {
+			continue
+		}
+		for _, d := range draining {
+			retirePod(ctx, client, item, d, request.policy, reasonNodeDrain)
+		}
+		metrics.add("ethereal_drain_handoffs_total", map[string]string{"namespace": item.GetNamespace()}, 1)
+		recordEvent(ctx, client, item, corev1.EventTypeNormal, "DrainHandoff",
+			fmt.Sprintf("Pod %s is available, releasing pod %s on draining node %s", pod.Name, old.Name, old.Spec.NodeName))
+		return nil, true
+	}
+	if len(others) > 0 {
+		// החלופה כבר קיימת ועוד לא זמינה
+		return nil, true
+	}
+
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "NodeDrain",
+		fmt.Sprintf("Node %s is draining, starting a replacement for pod %s on another node", old.Spec.NodeName, old.Name))
+	r := request
+	r.reason, r.rollout = reasonNodeDrain, true
+	r.template.avoidNode = old.Spec.NodeName
+	return []resurrection{r}, true
+}
+
+// nodeDraining - kubectl drain מסמן את ה-node כ-unschedulable לפני שהוא מתחיל לפנות
+func nodeDraining(ctx context.Context, client kubernetes.Interface, name string) bool {
+	if name == "" {
+		return false
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			slog.Warn("Failed to read node", "node", name, "error", err)
+		}
+		return false
+	}
+	return node.Spec.Unschedulable
+}
+
+// storageAllowsSurge - שני פודים יכולים לרוץ במקביל רק אם כל ה-PVCs שלהם ניתנים לחיבור מכמה nodes
+func storageAllowsSurge(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, v.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+		if err != nil {
+			slog.Warn("Failed to read PersistentVolumeClaim", "pod", pod.Name, "claim", v.PersistentVolumeClaim.ClaimName, "error", err)
+			return false
+		}
+		shared := false
+		for _, mode := range pvc.Spec.AccessModes {
+			shared = shared || mode == corev1.ReadWriteMany || mode == corev1.ReadOnlyMany
+		}
+		if !shared {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDisruptionBudget(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   map[string]interface{}
+		want   *intstr.IntOrString
+		wantOK bool // יש PDB
+		minAv  bool // want הוא minAvailable ולא maxUnavailable
+	}{
+		{name: "single replica has no budget by default", spec: map[string]interface{}{}},
+		{name: "single replica opts in to blocking eviction", spec: map[string]interface{}{"disruptionBudget": map[string]interface{}{}}, want: ptr(intstr.FromInt32(0)), wantOK: true},
+		{name: "replicas allow one at a time", spec: map[string]interface{}{"replicas": int64(3)}, want: ptr(intstr.FromInt32(1)), wantOK: true},
+		{name: "minAvailable from spec", spec: map[string]interface{}{"replicas": int64(3), "disruptionBudget": map[string]interface{}{"minAvailable": "50%"}}, want: ptr(intstr.FromString("50%")), wantOK: true, minAv: true},
+		{name: "disabled", spec: map[string]interface{}{"disruptionBudget": map[string]interface{}{"enabled": false}}},
+		{name: "scaled to zero", spec: map[string]interface{}{"replicas": int64(0)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.spec["image"] = "sunday-app:v1"
+			c := newTestCluster(t, tc.spec)
+			c.settle(t)
+
+			pdb, err := c.client.PolicyV1().PodDisruptionBudgets("default").Get(context.Background(), "ghost", metav1.GetOptions{})
+			if !tc.wantOK {
+				if err == nil {
+					t.Fatalf("unexpected PodDisruptionBudget %+v", pdb.Spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := pdb.Spec.MaxUnavailable
+			if tc.minAv {
+				got = pdb.Spec.MinAvailable
+			}
+			if got == nil || *got != *tc.want {
+				t.Errorf("budget = %+v, want %v", pdb.Spec, tc.want)
+			}
+			if pdb.Spec.Selector.MatchLabels[labelEtherealPod] != "ghost" || len(pdb.OwnerReferences) != 1 {
+				t.Errorf("PodDisruptionBudget is not tied to the EtherealPod: %+v", pdb.ObjectMeta)
+			}
+		})
+	}
+}
+
+func TestDrainReplacesTheSingleReplicaFirst(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "disruptionBudget": map[string]interface{}{"maxUnavailable": int64(0)}})
+	c.settle(t)
+
+	// kubectl drain node-1: קודם cordon, ואז הפינוי שה-PDB חוסם
+	old := c.pods(t)[0]
+	old.Spec.NodeName = "node-1"
+	if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &old, "default"); err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}, Spec: corev1.NodeSpec{Unschedulable: true}}
+	if _, err := c.client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	item := c.item(t)
+	queue := reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+	if len(queue) != 1 || queue[0].reason != reasonNodeDrain || queue[0].template.avoidNode != "node-1" {
+		t.Fatalf("queue = %+v, want one NodeDrain replacement away from node-1", queue)
+	}
+	if deleted := c.deleted(); len(deleted) != 0 {
+		t.Fatalf("deleted %v before the replacement was up", deleted)
+	}
+
+	c.settle(t)
+	pods := c.pods(t)
+	if len(pods) != 1 || pods[0].Name == old.Name {
+		t.Fatalf("after the handoff got %d pods, want only the replacement of %s", len(pods), old.Name)
+	}
+}
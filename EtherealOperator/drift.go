@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// סיבות להחלפה יזומה של פוד תקין; הן לא כישלון ולכן healOn לא חל עליהן
+const (
+	reasonSpecChanged      = "SpecChanged"
+	reasonConfigChanged    = "ConfigChanged"
+	reasonManualRestart    = "ManualRestart"
+	reasonScheduledRestart = "ScheduledRestart"
+	reasonClusterFailover  = "ClusterFailover"
+	reasonNodeDrain        = "NodeDrain"
+	reasonTTLExpired       = "TTLExpired"
+)
+
+func isReplacementReason(reason string) bool {
+	switch reason {
+	case reasonSpecChanged, reasonConfigChanged, reasonManualRestart, reasonScheduledRestart, reasonClusterFailover, reasonNodeDrain, reasonTTLExpired:
+		return true
+	}
+	return false
+}
+
+// detectDrift משווה את הפוד החי לתבנית הרצויה ומחזירה את סיבת ההחלפה, או "" אם אין סטייה.
+// פוד בלי annotation של hash נוצר לפני שהמנגנון קיים - לא מחליפים אותו רק בגלל זה
+func detectDrift(item unstructured.Unstructured, pod *corev1.Pod, tmpl podTemplate) string {
+	live, ok := pod.Annotations[annotationTemplateHash]
+	if !ok {
+		return ""
+	}
+	if live != tmpl.hash() {
+		if reason := restartReason(item, pod, tmpl); reason != "" {
+			return reason
+		}
+		return reasonSpecChanged
+	}
+	if item.GetAnnotations()[annotationIgnoreConfigChanges] == "true" {
+		return ""
+	}
+	if pod.Annotations[annotationConfigHash] != tmpl.configHash {
+		return reasonConfigChanged
+	}
+	return ""
+}
+
+// retirePod מוחקת פוד תקין (גרסה ישנה או רפליקה עודפת) בלי לסמן אותו כדורש ריפוי
+func retirePod(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, pod *corev1.Pod, policy *healingPolicy, reason string) {
+	healingRecords.removing(item, pod, reason, isReplacementReason(reason), time.Now())
+	opts := metav1.DeleteOptions{DryRun: planned("delete", "pods", pod.Namespace, pod.Name, "reason", reason)}
+	if policy != nil {
+		opts.GracePeriodSeconds = policy.gracePeriod
+	}
+	err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, opts)
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Error("Failed to delete pod", "pod", pod.Name, "reason", reason, "error", err)
+		return
+	}
+
+	slog.Info("Retired pod", "pod", pod.Name, "reason", reason)
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "Retiring", fmt.Sprintf("Deleting pod %s: %s", pod.Name, reason))
+}
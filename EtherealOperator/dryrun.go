@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dryRun מופעל ב---dry-run: הסבב מחשב הכל כרגיל, אבל כל כתיבה נשלחת עם dryRun=All -
+// ה-API server מאמת אותה ולא שומר כלום - ונכתבת ללוג. המטריקות ממשיכות להתעדכן
+var dryRun bool
+
+func init() {
+	metrics.describe("ethereal_dry_run_actions_total", "counter", "Writes skipped in dry-run mode, by verb and resource.")
+}
+
+// planned מחזירה את הערך של DryRun לאפשרויות של כתיבה. ב-dry-run היא גם רושמת ללוג מה היה נכתב
+func planned(verb, resource, namespace, name string, attrs ...any) []string {
+	if !dryRun {
+		return nil
+	}
+	slog.Info("Dry run: would "+verb+" "+resource, append([]any{"namespace", namespace, "name", name}, attrs...)...)
+	metrics.add("ethereal_dry_run_actions_total", map[string]string{"verb": verb, "resource": resource}, 1)
+	return []string{metav1.DryRunAll}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// recordEvent יוצרת Event על ה-EtherealPod, כך שהוא מופיע ב-kubectl describe
+func recordEvent(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, eventType, reason, message string) {
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", item.GetName(), now.UnixNano()),
+			Namespace: item.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      item.GetAPIVersion(),
+			Kind:            item.GetKind(),
+			Name:            item.GetName(),
+			Namespace:       item.GetNamespace(),
+			UID:             item.GetUID(),
+			ResourceVersion: item.GetResourceVersion(),
+		},
+		Type:                eventType,
+		Reason:              reason,
+		Message:             message,
+		Source:              corev1.EventSource{Component: "ethereal-operator"},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: "sunday.com/ethereal-operator",
+	}
+
+	opts := metav1.CreateOptions{DryRun: planned("create", "events", item.GetNamespace(), item.GetName(), "reason", reason, "message", message)}
+	if _, err := client.CoreV1().Events(item.GetNamespace()).Create(ctx, event, opts); err != nil {
+		slog.Warn("Failed to record event", "name", item.GetName(), "reason", reason, "error", err)
+	}
+	notifications.publish(item, eventType, reason, message)
+}
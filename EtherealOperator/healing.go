@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// סיבות ריפוי כלליות; שאר הסיבות הן ה-reason של סיום הקונטיינר או של הפוד (OOMKilled, Error, Evicted...)
+const (
+	reasonDeleted = "Deleted"
+	reasonFailed  = "Failed"
+)
+
+// אחרי כמה זמן של ריצה תקינה מאפסים את ה-backoff, אם המדיניות לא קובעת אחרת
+const defaultStableAfter = 5 * time.Minute
+
+// healingState הוא המעקב אחרי התחיות שנשמר ב-status.healing
+type healingState struct {
+	consecutive      int64
+	lastResurrection time.Time
+	recent           []time.Time
+	pendingReason    string
+	blockedReason    string
+	failedNode       string
+}
+
+func readHealingState(item unstructured.Unstructured) healingState {
+	var s healingState
+	s.consecutive, _, _ = unstructured.NestedInt64(item.Object, "status", "healing", "consecutive")
+	s.pendingReason, _, _ = unstructured.NestedString(item.Object, "status", "healing", "pendingReason")
+	s.blockedReason, _, _ = unstructured.NestedString(item.Object, "status", "healing", "blockedReason")
+	s.failedNode, _, _ = unstructured.NestedString(item.Object, "status", "healing", "failedNode")
+
+	if v, found, _ := unstructured.NestedString(item.Object, "status", "healing", "lastResurrection"); found {
+		s.lastResurrection, _ = time.Parse(time.RFC3339, v)
+	}
+	recent, _, _ := unstructured.NestedStringSlice(item.Object, "status", "healing", "recent")
+	for _, v := range recent {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			s.recent = append(s.recent, t)
+		}
+	}
+	return s
+}
+
+// failureReason מחזירה את הסיבה הספציפית ביותר לכישלון הפוד
+func failureReason(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if term := terminationState(cs); term != nil && term.Reason != "" {
+			return term.Reason
+		}
+	}
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+	return reasonFailed
+}
+
+// allows מחליטה אם מותר לרפא עכשיו. כשאסור, מחזירה את הסיבה (שנכתבת ל-status.healing.blockedReason)
+func (p *healingPolicy) allows(state healingState, reason string, now time.Time) (bool, string) {
+	if p == nil {
+		return true, ""
+	}
+
+	if len(p.healOn) > 0 && !isReplacementReason(reason) && !p.healsReason(reason) {
+		return false, "ReasonNotHealed"
+	}
+
+	for _, w := range p.pauseWindows {
+		if w.active(now) {
+			return false, "PauseWindow"
+		}
+	}
+
+	if p.budgetMax > 0 && len(recentWithin(state.recent, now, p.budgetWindow)) >= p.budgetMax {
+		return false, "BudgetExhausted"
+	}
+
+	if p.backoffInitial > 0 && state.consecutive > 0 && now.Before(state.lastResurrection.Add(p.backoffDelay(state.consecutive))) {
+		return false, "BackingOff"
+	}
+
+	return true, ""
+}
+
+// healsReason - "Failed" ב-healOn תופס כל סוג כישלון, אבל לא פוד שנמחק
+func (p *healingPolicy) healsReason(reason string) bool {
+	for _, r := range p.healOn {
+		if r == reason || (r == reasonFailed && reason != reasonDeleted) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoffDelay מכפילה את ההמתנה בכל התחייה רצופה, עד backoff.maxSeconds
+func (p *healingPolicy) backoffDelay(consecutive int64) time.Duration {
+	delay := p.backoffInitial
+	for i := int64(1); i < consecutive && delay < p.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > p.backoffMax {
+		delay = p.backoffMax
+	}
+	return delay
+}
+
+// stableAfter - אחרי כמה זמן של ריצה תקינה הפוד נחשב יציב וה-backoff מתאפס
+func (p *healingPolicy) stableAfter() time.Duration {
+	if p != nil && p.backoffMax > defaultStableAfter {
+		return p.backoffMax
+	}
+	return defaultStableAfter
+}
+
+func recentWithin(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	var kept []time.Time
+	for _, t := range times {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// reportBlocked כותבת ל-status ול-Events למה הריפוי מעוכב, רק כשהסיבה משתנה
+// by מתאר מי עיכב: המדיניות או המגביל הגלובלי
+func reportBlocked(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, state healingState, by, reason, blocked string) {
+	if state.blockedReason == blocked {
+		return
+	}
+
+	slog.Info("Healing deferred", "name", item.GetName(), "by", by, "reason", reason, "blockedReason", blocked)
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"healing": map[string]interface{}{"blockedReason": blocked}}); err != nil {
+		slog.Warn("Failed to record blocked healing", "name", item.GetName(), "error", err)
+	}
+	recordEvent(ctx, client, item, corev1.EventTypeWarning, "HealingBlocked",
+		fmt.Sprintf("Healing (%s) deferred by %s: %s", reason, by, blocked))
+}
+
+// recordResurrection מעדכנת את המונים ב-status אחרי ש-count פודים חדשים נוצרו
+func recordResurrection(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, state healingState, policy *healingPolicy, now time.Time, count int) {
+	window := time.Hour
+	if policy != nil && policy.budgetWindow > 0 {
+		window = policy.budgetWindow
+	}
+
+	recent := []interface{}{}
+	for _, t := range recentWithin(state.recent, now, window) {
+		recent = append(recent, t.UTC().Format(time.RFC3339))
+	}
+	for i := 0; i < count; i++ {
+		recent = append(recent, now.UTC().Format(time.RFC3339))
+	}
+
+	resurrections, _, _ := unstructured.NestedInt64(item.Object, "status", "resurrections")
+	status := map[string]interface{}{
+		"resurrections": resurrections + int64(count),
+		"healing": map[string]interface{}{
+			"consecutive":      state.consecutive + 1,
+			"lastResurrection": now.UTC().Format(time.RFC3339),
+			"recent":           recent,
+			"pendingReason":    nil,
+			"blockedReason":    nil,
+			"failedNode":       nil,
+		},
+	}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to record resurrection in status", "name", item.GetName(), "error", err)
+	}
+}
+
+// markStable מאפסת את מונה ההתחיות הרצופות כשכל הפודים רצים ומוכנים מספיק זמן
+func markStable(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, state healingState, policy *healingPolicy, pods []*corev1.Pod, now time.Time) {
+	if state.consecutive == 0 || len(pods) == 0 {
+		return
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.StartTime == nil || !podReady(pod) {
+			return
+		}
+		if now.Sub(pod.Status.StartTime.Time) < policy.stableAfter() {
+			return
+		}
+	}
+
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"healing": map[string]interface{}{"consecutive": int64(0)}}); err != nil {
+		slog.Warn("Failed to reset healing backoff", "name", item.GetName(), "error", err)
+	}
+}
+
+// recordPolicyRef שומרת ב-status איזו מדיניות חלה על ה-EtherealPod
+func recordPolicyRef(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, policy *healingPolicy) {
+	current, _, _ := unstructured.NestedString(item.Object, "status", "healingPolicy")
+	var ref interface{}
+	if policy != nil {
+		ref = policy.ref()
+		if current == policy.ref() {
+			return
+		}
+	} else if current == "" {
+		return
+	}
+
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"healingPolicy": ref}); err != nil {
+		slog.Warn("Failed to record healing policy in status", "name", item.GetName(), "error", err)
+	}
+}
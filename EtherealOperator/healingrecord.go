@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+var healingRecordGVR = schema.GroupVersionResource{
+	Group:    "sunday.com",
+	Version:  "v1",
+	Resource: "healingrecords",
+}
+
+// label על HealingRecord, בשביל סינון לפי סוג (kubectl get hrec -l sunday.com/trigger=NodeLost)
+const labelHealingTrigger = "sunday.com/trigger"
+
+// מה גרם לפעולת הריפוי
+const (
+	triggerDeleted  = "Deleted"
+	triggerFailed   = "Failed"
+	triggerNodeLost = "NodeLost"
+	triggerDrift    = "Drift"
+	triggerTTL      = "TTL"
+	triggerChaos    = "Chaos"
+	triggerManual   = "Manual"
+	triggerCluster  = "ClusterFailover"
+)
+
+// איך הפעולה נגמרה
+const (
+	outcomeResurrected = "Resurrected" // הוקם פוד חלופי
+	outcomeReplaced    = "Replaced"    // פוד של גרסה חדשה החליף פוד ישן
+	outcomeFailed      = "Failed"      // הקמת הפוד החלופי נכשלה
+	outcomeAbandoned   = "Abandoned"   // הפוד הוסר ולא הוחלף תוך pendingRecordTimeout
+)
+
+// אחרי כמה זמן פוד שהוסר ולא הוחלף נרשם כ-Abandoned
+const pendingRecordTimeout = time.Hour
+
+// כמה רשומות שנכשלו בכתיבה נשמרות לניסיון חוזר
+const maxUnwrittenRecords = 200
+
+// healingTrigger ממפה סיבת ריפוי (כמו ב-status.healing.pendingReason) לסוג ה-trigger ברשומה
+func healingTrigger(reason string) string {
+	switch {
+	case reason == reasonDeleted:
+		return triggerDeleted
+	case reason == "NodeLost":
+		return triggerNodeLost
+	case reason == reasonManualRestart:
+		return triggerManual
+	case reason == reasonClusterFailover:
+		return triggerCluster
+	case reason == reasonTTLExpired:
+		return triggerTTL
+	case isReplacementReason(reason):
+		return triggerDrift
+	case strings.HasPrefix(reason, "Chaos"):
+		return triggerChaos
+	default:
+		return triggerFailed
+	}
+}
+
+// lostWithNode - הפוד נמחק כי ה-node שלו נפל (taint manager או pod GC של node שנעלם)
+func lostWithNode(pod *corev1.Pod) bool {
+	if pod.Status.Reason == "NodeLost" {
+		return true
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.DisruptionTarget && c.Status == corev1.ConditionTrue {
+			return c.Reason == "DeletionByTaintManager" || c.Reason == "DeletionByPodGC"
+		}
+	}
+	return false
+}
+
+type podRef struct {
+	name string
+	uid  types.UID
+}
+
+// removal הוא פוד שהוסר ומחכה לפוד שיחליף אותו
+type removal struct {
+	pod    podRef
+	reason string
+	at     time.Time
+	drift  bool
+	failed bool // כבר נכתבה עליו רשומת Failed
+}
+
+// creation הוא פוד של rollout שהוקם לפני שהפוד הישן שהוא מחליף הוסר (maxSurge)
+type creation struct {
+	pod podRef
+	at  time.Time
+}
+
+// healingAction היא רשומה מוכנה לכתיבה
+type healingAction struct {
+	item        unstructured.Unstructured
+	trigger     string
+	reason      string
+	oldPod      *podRef
+	newPod      *podRef
+	startedAt   time.Time
+	completedAt time.Time
+	outcome     string
+	message     string
+}
+
+// healingRecorder מצמידה כל פוד שהוסר לפוד שהחליף אותו וכותבת HealingRecord לכל פעולה.
+// הזיווג נשמר בזיכרון; אחרי restart של האופרטור רשומה עלולה לצאת בלי הפוד הישן
+type healingRecorder struct {
+	mu          sync.Mutex
+	seen        map[types.UID]map[types.UID]*corev1.Pod // EtherealPod -> הפודים מהסבב הקודם
+	handled     map[types.UID]bool                      // פודים שההסרה שלהם כבר נרשמה
+	removed     map[types.UID][]removal
+	created     map[types.UID][]creation
+	done        []healingAction
+	lastCollect time.Time
+}
+
+var healingRecords = newHealingRecorder()
+
+func newHealingRecorder() *healingRecorder {
+	return &healingRecorder{
+		seen:    map[types.UID]map[types.UID]*corev1.Pod{},
+		handled: map[types.UID]bool{},
+		removed: map[types.UID][]removal{},
+		created: map[types.UID][]creation{},
+	}
+}
+
+func init() {
+	metrics.describe("ethereal_healing_records_total", "counter", "HealingRecords written, by trigger and outcome.")
+}
+
+// observe משווה את הפודים לסבב הקודם ורושמת פודים שנמחקו מבחוץ (kubectl delete, node שנפל).
+// מחזירה את ה-nodes של פודים שנעלמו יחד עם ה-node שלהם
+func (r *healingRecorder) observe(item unstructured.Unstructured, pods []corev1.Pod, now time.Time) (lostNodes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := map[types.UID]*corev1.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		current[pod.UID] = pod
+		if pod.DeletionTimestamp != nil && !r.handled[pod.UID] {
+			lostNodes = append(lostNodes, r.externalRemoval(item, pod, now)...)
+		}
+	}
+	for uid, pod := range r.seen[item.GetUID()] {
+		if _, ok := current[uid]; ok {
+			continue
+		}
+		if !r.handled[uid] {
+			lostNodes = append(lostNodes, r.externalRemoval(item, pod, now)...)
+		}
+		delete(r.handled, uid)
+	}
+	r.seen[item.GetUID()] = current
+	return lostNodes
+}
+
+func (r *healingRecorder) externalRemoval(item unstructured.Unstructured, pod *corev1.Pod, now time.Time) (lostNode []string) {
+	reason := reasonDeleted
+	if lostWithNode(pod) {
+		reason = "NodeLost"
+		if pod.Spec.NodeName != "" {
+			lostNode = []string{pod.Spec.NodeName}
+		}
+	}
+	r.handled[pod.UID] = true
+	r.removed[item.GetUID()] = append(r.removed[item.GetUID()], removal{pod: podRef{pod.Name, pod.UID}, reason: reason, at: now})
+	return lostNode
+}
+
+// removing נקראת לפני שהאופרטור עצמו מוחק פוד. מחיקה שלא דורשת פוד חלופי (scale down, שינה)
+// רק מסומנת, כדי ש-observe לא תרשום אותה כמחיקה מבחוץ
+func (r *healingRecorder) removing(item unstructured.Unstructured, pod *corev1.Pod, reason string, replaced bool, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handled[pod.UID] = true
+	if !replaced {
+		return
+	}
+	uid := item.GetUID()
+	ref := podRef{pod.Name, pod.UID}
+	drift := isReplacementReason(reason)
+	// ב-rollout עם maxSurge הפוד החדש כבר קיים
+	if created := r.created[uid]; drift && len(created) > 0 {
+		r.created[uid] = created[1:]
+		r.done = append(r.done, healingAction{
+			item: item, trigger: healingTrigger(reason), reason: reason, oldPod: &ref, newPod: &created[0].pod,
+			startedAt: created[0].at, completedAt: now, outcome: outcomeReplaced,
+		})
+		return
+	}
+	r.removed[uid] = append(r.removed[uid], removal{pod: ref, reason: reason, at: now, drift: drift})
+}
+
+// resurrected מצמידה פוד חדש לפוד הוותיק ביותר שמחכה להחלפה
+func (r *healingRecorder) resurrected(item unstructured.Unstructured, reason string, rollout bool, pod *corev1.Pod, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	uid := item.GetUID()
+	ref := podRef{pod.Name, pod.UID}
+	// פוד חדש נרשם כבר עכשיו, כדי שהמחיקה שלו מאוחר יותר תיראה ב-observe. ב-dry-run הוא לא באמת קיים
+	if !dryRun {
+		if r.seen[uid] == nil {
+			r.seen[uid] = map[types.UID]*corev1.Pod{}
+		}
+		r.seen[uid][pod.UID] = pod
+	}
+
+	removed := r.removed[uid]
+	if len(removed) == 0 {
+		if rollout {
+			r.created[uid] = append(r.created[uid], creation{pod: ref, at: now})
+			return
+		}
+		// פוד ראשון, scale up או יציאה משינה - לא פעולת ריפוי
+		if reason == reasonDeleted {
+			return
+		}
+		// כישלון שנשמר ב-status אבל הפוד הישן לא ידוע (למשל אחרי restart של האופרטור)
+		r.done = append(r.done, healingAction{
+			item: item, trigger: healingTrigger(reason), reason: reason, newPod: &ref,
+			startedAt: now, completedAt: now, outcome: outcomeResurrected,
+		})
+		return
+	}
+
+	old := removed[0]
+	r.removed[uid] = removed[1:]
+	outcome := outcomeResurrected
+	if old.drift {
+		outcome = outcomeReplaced
+	}
+	r.done = append(r.done, healingAction{
+		item: item, trigger: healingTrigger(old.reason), reason: old.reason, oldPod: &old.pod, newPod: &ref,
+		startedAt: old.at, completedAt: now, outcome: outcome,
+	})
+}
+
+// failedResurrection רושמת הקמה שנכשלה. הפוד הישן נשאר בתור לניסיון הבא, ונרשם כ-Failed רק פעם אחת
+func (r *healingRecorder) failedResurrection(item unstructured.Unstructured, err error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// בלי פוד ישן ידוע אין למה לקשר את הכישלון, והוא גם היה נרשם מחדש בכל סבב
+	removed := r.removed[item.GetUID()]
+	if len(removed) == 0 || removed[0].failed {
+		return
+	}
+	removed[0].failed = true
+	old := removed[0]
+	r.done = append(r.done, healingAction{
+		item: item, trigger: healingTrigger(old.reason), reason: old.reason, oldPod: &old.pod,
+		startedAt: old.at, completedAt: now, outcome: outcomeFailed, message: err.Error(),
+	})
+}
+
+// expire סוגרת פודים שהוסרו ולא הוחלפו, ושוכחת EtherealPods שכבר לא קיימים
+func (r *healingRecorder) expire(items []unstructured.Unstructured, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exists := map[types.UID]bool{}
+	for _, item := range items {
+		uid := item.GetUID()
+		exists[uid] = true
+
+		var kept []removal
+		for _, old := range r.removed[uid] {
+			if now.Sub(old.at) < pendingRecordTimeout {
+				kept = append(kept, old)
+				continue
+			}
+			ref := old.pod
+			r.done = append(r.done, healingAction{
+				item: item, trigger: healingTrigger(old.reason), reason: old.reason, oldPod: &ref,
+				startedAt: old.at, completedAt: now, outcome: outcomeAbandoned,
+				message: "no replacement was created within " + pendingRecordTimeout.String(),
+			})
+		}
+		r.removed[uid] = kept
+
+		var created []creation
+		for _, c := range r.created[uid] {
+			if now.Sub(c.at) < pendingRecordTimeout {
+				created = append(created, c)
+			}
+		}
+		r.created[uid] = created
+	}
+
+	for uid, pods := range r.seen {
+		if exists[uid] {
+			continue
+		}
+		for podUID := range pods {
+			delete(r.handled, podUID)
+		}
+		delete(r.seen, uid)
+		delete(r.removed, uid)
+		delete(r.created, uid)
+	}
+}
+
+// flush כותבת את הרשומות שהצטברו בסבב. רשומה שנכשלה בכתיבה תנוסה שוב בסבב הבא
+func (r *healingRecorder) flush(ctx context.Context, dyn dynamic.Interface) {
+	r.mu.Lock()
+	pending := r.done
+	r.done = nil
+	r.mu.Unlock()
+
+	var failed []healingAction
+	for _, a := range pending {
+		if err := writeHealingRecord(ctx, dyn, a); err != nil {
+			slog.Warn("Failed to write healing record", "name", a.item.GetName(), "trigger", a.trigger, "error", err)
+			failed = append(failed, a)
+			continue
+		}
+		metrics.add("ethereal_healing_records_total", map[string]string{"trigger": a.trigger, "outcome": a.outcome}, 1)
+	}
+
+	if len(failed) > 0 {
+		r.mu.Lock()
+		r.done = append(failed, r.done...)
+		if len(r.done) > maxUnwrittenRecords {
+			r.done = r.done[len(r.done)-maxUnwrittenRecords:]
+		}
+		r.mu.Unlock()
+	}
+}
+
+// writeHealingRecord יוצרת HealingRecord ב-namespace של ה-EtherealPod. אין owner reference,
+// כדי שההיסטוריה תישאר גם אחרי שה-EtherealPod נמחק; collect מנקה לפי גיל וכמות
+func writeHealingRecord(ctx context.Context, dyn dynamic.Interface, a healingAction) error {
+	spec := map[string]interface{}{
+		"etherealPod":     map[string]interface{}{"name": a.item.GetName(), "uid": string(a.item.GetUID())},
+		"trigger":         a.trigger,
+		"reason":          a.reason,
+		"outcome":         a.outcome,
+		"startedAt":       a.startedAt.UTC().Format(time.RFC3339),
+		"completedAt":     a.completedAt.UTC().Format(time.RFC3339),
+		"durationSeconds": a.completedAt.Sub(a.startedAt).Seconds(),
+	}
+	if a.oldPod != nil {
+		spec["oldPod"] = map[string]interface{}{"name": a.oldPod.name, "uid": string(a.oldPod.uid)}
+	}
+	if a.newPod != nil {
+		spec["newPod"] = map[string]interface{}{"name": a.newPod.name, "uid": string(a.newPod.uid)}
+	}
+	if a.message != "" {
+		spec["message"] = a.message
+	}
+
+	record := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sunday.com/v1",
+		"kind":       "HealingRecord",
+		"metadata": map[string]interface{}{
+			"generateName": a.item.GetName() + "-",
+			"namespace":    a.item.GetNamespace(),
+			"labels": map[string]interface{}{
+				labelEtherealPod:    a.item.GetName(),
+				labelHealingTrigger: a.trigger,
+			},
+		},
+		"spec": spec,
+	}}
+	opts := metav1.CreateOptions{DryRun: planned("create", "healingrecords", a.item.GetNamespace(), a.item.GetName(), "trigger", a.trigger, "outcome", a.outcome)}
+	_, err := dyn.Resource(healingRecordGVR).Namespace(a.item.GetNamespace()).Create(ctx, record, opts)
+	return err
+}
+
+// collect מוחקת רשומות ישנות מ-maxAge, ושומרת לכל EtherealPod רק את maxCount האחרונות.
+// רצה פעם ב-interval, לא בכל סבב
+func (r *healingRecorder) collect(ctx context.Context, dyn dynamic.Interface, maxAge time.Duration, maxCount int, interval time.Duration, now time.Time) {
+	if (maxAge <= 0 && maxCount <= 0) || now.Sub(r.lastCollect) < interval {
+		return
+	}
+	r.lastCollect = now
+
+	list, err := dyn.Resource(healingRecordGVR).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		slog.Warn("Failed to list healing records", "error", err)
+		return
+	}
+
+	byOwner := map[string][]unstructured.Unstructured{}
+	for _, rec := range list.Items {
+		key := rec.GetNamespace() + "/" + rec.GetLabels()[labelEtherealPod]
+		byOwner[key] = append(byOwner[key], rec)
+	}
+
+	deleted := 0
+	for _, records := range byOwner {
+		// החדשות קודם
+		sort.Slice(records, func(i, j int) bool {
+			a, b := records[i].GetCreationTimestamp(), records[j].GetCreationTimestamp()
+			return b.Before(&a)
+		})
+		for i, rec := range records {
+			tooMany := maxCount > 0 && i >= maxCount
+			tooOld := maxAge > 0 && now.Sub(rec.GetCreationTimestamp().Time) > maxAge
+			if !tooMany && !tooOld {
+				continue
+			}
+			opts := metav1.DeleteOptions{DryRun: planned("delete", "healingrecords", rec.GetNamespace(), rec.GetName())}
+			err := dyn.Resource(healingRecordGVR).Namespace(rec.GetNamespace()).Delete(ctx, rec.GetName(), opts)
+			if err != nil && !apierrors.IsNotFound(err) {
+				slog.Warn("Failed to delete healing record", "record", rec.GetName(), "error", err)
+				continue
+			}
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		slog.Info("Garbage-collected healing records", "deleted", deleted)
+	}
+}
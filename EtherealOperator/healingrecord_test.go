@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHealingTrigger(t *testing.T) {
+	cases := map[string]string{
+		reasonDeleted:          triggerDeleted,
+		"NodeLost":             triggerNodeLost,
+		"OOMKilled":            triggerFailed,
+		reasonSpecChanged:      triggerDrift,
+		reasonConfigChanged:    triggerDrift,
+		reasonNodeDrain:        triggerDrift,
+		reasonTTLExpired:       triggerTTL,
+		reasonManualRestart:    triggerManual,
+		reasonClusterFailover:  triggerCluster,
+		"ChaosKill":            triggerChaos,
+		reasonScheduledRestart: triggerDrift,
+	}
+	for reason, want := range cases {
+		if got := healingTrigger(reason); got != want {
+			t.Errorf("healingTrigger(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+// מחזור של spec.ttl עובר דרך ה-rollout (קודם חלופה, אחר כך מחיקה) ונרשם כ-TTL ולא כ-Drift
+func TestTTLRecyclingIsRecorded(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "ttl": int64(60)})
+	c.settle(t)
+
+	old := c.pods(t)[0]
+	old.Status.StartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+	if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &old, "default"); err != nil {
+		t.Fatal(err)
+	}
+	c.settle(t)
+	c.settle(t)
+
+	list, err := c.dyn.Resource(healingRecordGVR).Namespace("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var triggers []string
+	for _, rec := range list.Items {
+		trigger, _, _ := unstructured.NestedString(rec.Object, "spec", "trigger")
+		oldPod, _, _ := unstructured.NestedString(rec.Object, "spec", "oldPod", "name")
+		triggers = append(triggers, trigger)
+		if oldPod != old.Name {
+			continue
+		}
+		outcome, _, _ := unstructured.NestedString(rec.Object, "spec", "outcome")
+		if trigger != triggerTTL || outcome != outcomeReplaced || rec.GetLabels()[labelHealingTrigger] != triggerTTL {
+			t.Errorf("record for the expired pod: trigger %q, outcome %q, labels %v", trigger, outcome, rec.GetLabels())
+		}
+		return
+	}
+	t.Fatalf("no HealingRecord for the expired pod %s, got triggers %v", old.Name, triggers)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// סיבת הריפוי כשהבדיקה האקטיבית של האופרטור נכשלת
+const reasonUnhealthy = "Unhealthy"
+
+// probeSet הן ה-probes של הקונטיינר לפי spec.healthCheck (השדות מיוצאים בשביל ה-hash של התבנית)
+type probeSet struct {
+	Liveness  *corev1.Probe `json:"liveness,omitempty"`
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+	Startup   *corev1.Probe `json:"startup,omitempty"`
+}
+
+// defaultLivenessProbe היא ה-probe הקבוע שהיה לפני spec.healthCheck
+func defaultLivenessProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/health",
+				Port: intstr.FromInt(8080),
+			},
+		},
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       15,
+	}
+}
+
+// httpCheck היא בדיקת HTTP כפי שנכתבה ב-spec. ה-kubelet יודע לבדוק רק סטטוס 200-399,
+// אז expectedStatus ו-expectedBody נאכפים רק בבדיקה האקטיבית של האופרטור
+type httpCheck struct {
+	path           string
+	port           int
+	scheme         corev1.URIScheme
+	headers        []corev1.HTTPHeader
+	expectedStatus int
+	expectedBody   string
+}
+
+// activeCheck היא spec.healthCheck.active: האופרטור עצמו בודק את הפוד ומרפא אותו כשהוא לא תקין,
+// גם אם ה-kubelet חושב שהכל בסדר
+type activeCheck struct {
+	http             httpCheck
+	period           time.Duration
+	failureThreshold int64
+}
+
+// parseHealthCheck קוראת את spec.healthCheck. כשהוא לא מוגדר מחזירה nil, והפוד מקבל את ה-liveness הקבוע
+func parseHealthCheck(spec map[string]interface{}) (*probeSet, *activeCheck, error) {
+	hc, found, _ := unstructured.NestedMap(spec, "healthCheck")
+	if !found {
+		return nil, nil, nil
+	}
+
+	probes := &probeSet{}
+	var livenessHTTP *httpCheck
+	for _, kind := range []string{"liveness", "readiness", "startup"} {
+		m, ok := hc[kind].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		probe, check, err := parseProbe(m)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		switch kind {
+		case "liveness":
+			probes.Liveness, livenessHTTP = probe, check
+		case "readiness":
+			probes.Readiness = probe
+		case "startup":
+			probes.Startup = probe
+		}
+	}
+	// הגדרה של readiness בלבד לא מבטלת את ה-liveness
+	if probes.Liveness == nil {
+		probes.Liveness = defaultLivenessProbe()
+	}
+
+	m, ok := hc["active"].(map[string]interface{})
+	if !ok {
+		return probes, nil, nil
+	}
+	active := &activeCheck{http: httpCheck{path: "/health", port: 8080, scheme: corev1.URISchemeHTTP}, period: 30 * time.Second, failureThreshold: 3}
+	if h, ok := m["http"].(map[string]interface{}); ok {
+		check, err := parseHTTPCheck(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("active: %w", err)
+		}
+		active.http = check
+	} else if livenessHTTP != nil {
+		active.http = *livenessHTTP
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "periodSeconds"); found && v > 0 {
+		active.period = time.Duration(v) * time.Second
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "failureThreshold"); found && v > 0 {
+		active.failureThreshold = v
+	}
+	return probes, active, nil
+}
+
+// parseProbe בונה corev1.Probe מאחד מ-http, tcp או exec, ומחזירה גם את בדיקת ה-HTTP אם יש
+func parseProbe(m map[string]interface{}) (*corev1.Probe, *httpCheck, error) {
+	probe := &corev1.Probe{}
+	var check *httpCheck
+
+	switch {
+	case m["http"] != nil:
+		h, _ := m["http"].(map[string]interface{})
+		c, err := parseHTTPCheck(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		check = &c
+		probe.HTTPGet = &corev1.HTTPGetAction{Path: c.path, Port: intstr.FromInt(c.port), Scheme: c.scheme, HTTPHeaders: c.headers}
+	case m["tcp"] != nil:
+		port, _, _ := unstructured.NestedInt64(m, "tcp", "port")
+		if port <= 0 {
+			return nil, nil, fmt.Errorf("tcp.port is required")
+		}
+		probe.TCPSocket = &corev1.TCPSocketAction{Port: intstr.FromInt(int(port))}
+	case m["exec"] != nil:
+		command, _, _ := unstructured.NestedStringSlice(m, "exec", "command")
+		if len(command) == 0 {
+			return nil, nil, fmt.Errorf("exec.command is required")
+		}
+		probe.Exec = &corev1.ExecAction{Command: command}
+	default:
+		return nil, nil, fmt.Errorf("one of http, tcp or exec is required")
+	}
+
+	for field, target := range map[string]*int32{
+		"initialDelaySeconds": &probe.InitialDelaySeconds,
+		"periodSeconds":       &probe.PeriodSeconds,
+		"timeoutSeconds":      &probe.TimeoutSeconds,
+		"failureThreshold":    &probe.FailureThreshold,
+		"successThreshold":    &probe.SuccessThreshold,
+	} {
+		if v, found, _ := unstructured.NestedInt64(m, field); found {
+			*target = int32(v)
+		}
+	}
+	return probe, check, nil
+}
+
+func parseHTTPCheck(m map[string]interface{}) (httpCheck, error) {
+	c := httpCheck{path: "/health", port: 8080, scheme: corev1.URISchemeHTTP}
+	if v, _, _ := unstructured.NestedString(m, "path"); v != "" {
+		c.path = v
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "port"); found {
+		c.port = int(v)
+	}
+	if v, _, _ := unstructured.NestedString(m, "scheme"); v != "" {
+		c.scheme = corev1.URIScheme(strings.ToUpper(v))
+	}
+	headers, _, _ := unstructured.NestedSlice(m, "headers")
+	for _, h := range headers {
+		header, _ := h.(map[string]interface{})
+		name, _, _ := unstructured.NestedString(header, "name")
+		value, _, _ := unstructured.NestedString(header, "value")
+		if name == "" {
+			return c, fmt.Errorf("header name is required")
+		}
+		c.headers = append(c.headers, corev1.HTTPHeader{Name: name, Value: value})
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "expectedStatus"); found {
+		c.expectedStatus = int(v)
+	}
+	c.expectedBody, _, _ = unstructured.NestedString(m, "expectedBody")
+	return c, nil
+}
+
+// probe מבצעת את בדיקת ה-HTTP דרך ה-proxy של ה-API server ומחזירה שגיאה אם הפוד לא תקין
+func (c httpCheck) probe(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) error {
+	name := fmt.Sprintf("%s:%d", pod.Name, c.port)
+	if c.scheme == corev1.URISchemeHTTPS {
+		name = "https:" + name
+	}
+	req := client.CoreV1().RESTClient().Get().Namespace(pod.Namespace).Resource("pods").Name(name).SubResource("proxy").Suffix(c.path)
+	for _, h := range c.headers {
+		req.SetHeader(h.Name, h.Value)
+	}
+
+	result := req.Do(ctx)
+	var code int
+	result.StatusCode(&code)
+	body, err := result.Raw()
+	if code == 0 {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	if c.expectedStatus != 0 && code != c.expectedStatus {
+		return fmt.Errorf("status %d, expected %d", code, c.expectedStatus)
+	}
+	if c.expectedStatus == 0 && (code < 200 || code >= 400) {
+		return fmt.Errorf("status %d", code)
+	}
+	if c.expectedBody != "" && !strings.Contains(string(body), c.expectedBody) {
+		return fmt.Errorf("response body does not contain %q", c.expectedBody)
+	}
+	return nil
+}
+
+// runActiveCheck בודקת את הפודים הרצים כל period, סופרת כישלונות רצופים ב-status.activeHealth,
+// ומחזירה את הפודים שעברו את failureThreshold ויש לרפא
+func runActiveCheck(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, check *activeCheck, pods []*corev1.Pod, now time.Time) []*corev1.Pod {
+	existing, _, _ := unstructured.NestedMap(item.Object, "status", "activeHealth")
+	update := map[string]interface{}{}
+	var unhealthy []*corev1.Pod
+
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		seen[pod.Name] = true
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		previous, _ := existing[pod.Name].(map[string]interface{})
+		if last := latestTime(previous, "lastCheck"); now.Sub(last) < check.period {
+			continue
+		}
+
+		failures, _, _ := unstructured.NestedInt64(previous, "consecutiveFailures")
+		entry := map[string]interface{}{"lastCheck": now.UTC().Format(time.RFC3339), "lastError": nil, "consecutiveFailures": int64(0)}
+		if err := check.http.probe(ctx, client, pod); err != nil {
+			failures++
+			entry["lastError"], entry["consecutiveFailures"] = err.Error(), failures
+			slog.Warn("Active health check failed", "name", item.GetName(), "pod", pod.Name, "failures", failures, "error", err)
+			if failures >= check.failureThreshold {
+				unhealthy = append(unhealthy, pod)
+			}
+		}
+		update[pod.Name] = entry
+	}
+	for name := range existing {
+		if !seen[name] {
+			update[name] = nil
+		}
+	}
+
+	if len(update) > 0 {
+		if err := patchStatus(ctx, dyn, item, map[string]interface{}{"activeHealth": update}); err != nil {
+			slog.Warn("Failed to record active health check", "name", item.GetName(), "error", err)
+		}
+	}
+	return unhealthy
+}
@@ -2,19 +2,23 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"  // הנה ה-Import שהיה חסר לך!
+	"k8s.io/client-go/rest" // הנה ה-Import שהיה חסר לך!
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
@@ -26,32 +30,51 @@ var gvr = schema.GroupVersionResource{
 }
 
 func main() {
+	// אותו בינארי הוא גם ה-plugin של kubectl, לפי השם שבו הוא הורץ
+	if strings.HasPrefix(filepath.Base(os.Args[0]), pluginName) {
+		os.Exit(runPlugin(os.Args[1:]))
+	}
+
+	metricsAddr := flag.String("metrics-addr", ":8081", "address to serve /metrics on, empty to disable")
+	maxConcurrent := flag.Int("max-concurrent-resurrections", 10, "maximum managed pods starting at the same time, 0 for no limit")
+	resurrectionRate := flag.Float64("resurrection-rate", 2, "resurrections per second allowed cluster-wide, 0 for no limit")
+	flag.BoolVar(&dryRun, "dry-run", false, "compute and log every action without changing the cluster (server-side dry run)")
+	resurrectionBurst := flag.Int("resurrection-burst", 10, "resurrections allowed in a single burst")
+	recordMaxAge := flag.Duration("healing-record-max-age", 30*24*time.Hour, "delete HealingRecords older than this, 0 to keep them")
+	notificationsConfig := flag.String("notifications-config", "", "YAML or JSON file with global notification sinks")
+	webhookAllow := flag.String("webhook-allowlist", "", "comma-separated URL prefixes that webhooks in namespaced HealingPolicies may post to")
+	recordMaxCount := flag.Int("healing-record-max-count", 100, "HealingRecords kept per EtherealPod, 0 for no limit")
+	clusterID := flag.String("cluster-id", "", "identity of this cluster on objects in remote clusters, default the UID of kube-system")
+	shardCount := flag.Int("shards", 0, "split EtherealPods into this many Lease-owned shards across active replicas, 0 or 1 to disable")
+	shardGroup := flag.String("shard-group", "ethereal-operator", "name prefix of the shard Leases; replicas with the same group share the shards")
+	shardLease := flag.Duration("shard-lease-duration", 30*time.Second, "how long a shard Lease stays valid without renewal")
+	simulate := flag.String("simulate", "", "run the scenario file against an in-memory fake cluster, print the timeline and exit")
+	flag.Parse()
+
+	// סימולציה לא צריכה kubeconfig, metrics או התראות
+	if *simulate != "" {
+		os.Exit(runSimulation(*simulate, os.Stdout))
+	}
+
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	slog.Info("Ghost Operator is starting", "version", "v1.2", "env", "production")
-
-	var config *rest.Config
-	var err error
+	slog.Info("Ghost Operator is starting", "version", "v1.2", "env", "production", "dryRun", dryRun)
+	// ה-Leases של ה-shards הם לא פעולה שאפשר לדמות: replica ב-dry run הייתה לוקחת shards מהאופרטור החי
+	if dryRun && *shardCount > 1 {
+		slog.Error("--dry-run cannot be combined with --shards")
+		os.Exit(1)
+	}
 
-	// בדיקה האם רצים בתוך הקלאסטר או לוקאלית
-	config, err = rest.InClusterConfig()
+	config, inCluster, err := loadKubeConfig()
 	if err != nil {
-		slog.Info("Running outside of cluster, trying local kubeconfig")
-		var kubeconfig string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		} else {
-			kubeconfig = filepath.Join(os.Getenv("USERPROFILE"), ".kube", "config")
-		}
-
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			slog.Error("CRITICAL: Could not load Kubernetes config", "error", err)
-			os.Exit(1)
-		}
-	} else {
+		slog.Error("CRITICAL: Could not load Kubernetes config", "error", err)
+		os.Exit(1)
+	}
+	if inCluster {
 		slog.Info("Running inside Kubernetes cluster")
+	} else {
+		slog.Info("Running outside of cluster, using local kubeconfig")
 	}
 
 	dynamicClient, err := dynamic.NewForConfig(config)
@@ -66,86 +89,429 @@ func main() {
 		os.Exit(1)
 	}
 
-	slog.Info("Operator started successfully. Watching for EtherealPods...")
+	// בלי זהות אי אפשר להבדיל בקלאסטר מרוחק משותף בין הפודים שלנו לשל אופרטור אחר
+	homeCluster = *clusterID
+	if homeCluster == "" {
+		if homeCluster, err = clusterIdentity(context.TODO(), k8sClient); err != nil {
+			slog.Warn("Could not read the cluster identity, pods left in remote clusters will not be cleaned up", "error", err)
+		}
+	}
+	if errs := validation.IsValidLabelValue(homeCluster); len(errs) > 0 {
+		slog.Error("Invalid --cluster-id", "clusterID", homeCluster, "error", strings.Join(errs, "; "))
+		os.Exit(1)
+	}
+
+	for _, entry := range strings.Split(*webhookAllow, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			webhookAllowlist = append(webhookAllowlist, entry)
+		}
+	}
+
+	serveMetrics(*metricsAddr)
+	if *notificationsConfig != "" {
+		if err := notifications.loadGlobal(context.TODO(), k8sClient, *notificationsConfig); err != nil {
+			slog.Error("Failed to load notifications config", "error", err)
+			os.Exit(1)
+		}
+	}
+	go notifications.run(context.Background())
+	limiter := newResurrectionLimiter(*resurrectionRate, *resurrectionBurst, *maxConcurrent)
+	chaos := newChaosController()
+	shards = newShardManager(k8sClient, *shardGroup, *shardCount, *shardLease)
+
+	slog.Info("Operator started successfully. Watching for EtherealPods...", "shards", *shardCount)
 
+	loop := &operatorLoop{
+		client: k8sClient, dyn: dynamicClient, limiter: limiter, chaos: chaos,
+		recordMaxAge: *recordMaxAge, recordMaxCount: *recordMaxCount,
+	}
 	for {
-		list, err := dynamicClient.Resource(gvr).Namespace("default").List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
+		if err := loop.pass(context.TODO()); err != nil {
 			slog.Error("Error listing custom resources", "error", err)
 			time.Sleep(10 * time.Second)
 			continue
 		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// operatorLoop מחזיקה את מה שסבבים של האופרטור חולקים. גם --simulate מריצה אותה, מול clients מזויפים
+type operatorLoop struct {
+	client         kubernetes.Interface
+	dyn            dynamic.Interface
+	limiter        *resurrectionLimiter
+	chaos          *chaosController
+	recordMaxAge   time.Duration
+	recordMaxCount int
+}
+
+// pass הוא סבב אחד על כל ה-EtherealPods. שגיאה רק כשאי אפשר לקרוא אותם בכלל
+func (l *operatorLoop) pass(ctx context.Context) error {
+	shards.sync(ctx)
+	clusters.sync(ctx, l.client, l.dyn)
+
+	list, err := l.dyn.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	policies := loadHealingPolicies(ctx, l.dyn)
+	notifications.configure(ctx, l.client, policies, time.Now())
+	graph := newDependencyGraph(list.Items)
+
+	// התחיות לא קורות תוך כדי הסבב אלא נאספות לתור, כדי שהמגביל יחליט עליהן יחד
+	var queue []resurrection
+	var owned []unstructured.Unstructured
+	for _, item := range list.Items {
+		policy := resolveHealingPolicy(item, policies)
+		if policy != nil {
+			policy.governed = append(policy.governed, item.GetNamespace()+"/"+item.GetName())
+		}
+		// ב-sharding כל replica מטפלת רק ב-shards שלה, אבל מדיניות נספרת על כל ה-EtherealPods
+		itemCtx, cancel, ok := shards.fence(ctx, item)
+		if !ok {
+			continue
+		}
+		owned = append(owned, item)
+		queue = append(queue, l.handle(itemCtx, item, policy, graph)...)
+		cancel()
+	}
+
+	l.limiter.dispatch(ctx, l.client, l.dyn, queue)
+	// מה שבזיכרון על EtherealPod שעבר ל-replica אחרת כבר לא עדכני
+	statuses.forget(owned)
+	disruptionBudgets.forget(owned)
+	healingRecords.expire(owned, time.Now())
+	healingRecords.flush(ctx, l.dyn)
+	if shards.primary() {
+		updatePolicyStatuses(ctx, l.dyn, policies)
+		healingRecords.collect(ctx, l.dyn, l.recordMaxAge, l.recordMaxCount, 10*time.Minute, time.Now())
+		clusters.collect(ctx, l.client, list.Items)
+		clusters.updateStatuses(ctx, l.dyn, time.Now())
+	}
+	return nil
+}
 
-		for _, item := range list.Items {
-			reconcile(context.TODO(), item, k8sClient)
+// handle מטפלת ב-EtherealPod אחד. ctx מתבטל כשה-shard שלו כבר לא בטוח בידינו (ראו shards.fence)
+func (l *operatorLoop) handle(ctx context.Context, item unstructured.Unstructured, policy *healingPolicy, graph *dependencyGraph) []resurrection {
+	// הפודים רצים בקלאסטר שנבחר מ-spec.clusters; ה-EtherealPod וה-status נשארים כאן
+	client, ok := clusters.place(ctx, l.client, l.dyn, &item, time.Now())
+	if !ok {
+		return nil
+	}
+	notifications.bind(item, policy)
+	queue := reconcile(ctx, item, client, l.dyn, policy, graph)
+	// ה-reconcile יכול להימשך, ו-chaos מוחקת פודים - בודקים שוב לפני
+	if shards.owns(ctx, item) {
+		l.chaos.run(ctx, client, l.dyn, item, policy, time.Now())
+	}
+	return queue
+}
+
+// reconcile בודקת את המצב הקיים מול המצב הרצוי עבור אובייקט ספציפי.
+// אם צריך להקים פודים היא מחזירה בקשות לתור במקום ליצור אותם בעצמה
+func reconcile(ctx context.Context, item unstructured.Unstructured, client kubernetes.Interface, dyn dynamic.Interface, policy *healingPolicy, graph *dependencyGraph) []resurrection {
+	name := item.GetName()
+
+	// שליפת ה-Spec מתוך ה-Custom Resource הדינמי
+	spec, found, err := unstructured.NestedMap(item.Object, "spec")
+	if !found || err != nil {
+		slog.Warn("Could not find spec in resource", "name", name)
+		return nil
+	}
+
+	recordPolicyRef(ctx, dyn, item, policy)
+
+	// כיוונון זיכרון אוטומטי תקף רק ל-spec שבשבילו הוא חושב
+	resetAutoTuneOnSpecChange(ctx, client, dyn, &item)
+	hibernatedBy := evaluateSchedules(ctx, client, dyn, &item, time.Now())
+	evaluateManualRestart(ctx, client, dyn, &item, time.Now())
+	if paused, _, _ := unstructured.NestedBool(spec, "paused"); !paused {
+		adoptPods(ctx, client, dyn, &item, spec)
+	}
+	tmpl := applyRollback(item, desiredTemplate(item, spec))
+	if tmpl.configHash, err = computeConfigHash(ctx, client, item.GetNamespace(), tmpl); err != nil {
+		slog.Error("Failed to read referenced config", "name", name, "error", err)
+		return nil
+	}
+
+	replicas := desiredReplicas(spec)
+	strategy := rolloutSettings(spec, replicas)
+	state := readHealingState(item)
+	now := time.Now()
+
+	// במקום context.TODO, אנחנו משתמשים ב-ctx שעובר מה-main
+	pods, err := listManagedPods(ctx, client, item)
+	if err != nil {
+		slog.Error("Failed to list pods", "name", name, "error", err)
+		return nil
+	}
+	// פוד שנעלם יחד עם ה-node שלו - ההתחייה תעדיף node אחר
+	avoidNode := state.failedNode
+	if lost := healingRecords.observe(item, pods, now); len(lost) > 0 {
+		avoidNode = lost[len(lost)-1]
+		if err := patchStatus(ctx, dyn, item, map[string]interface{}{"healing": map[string]interface{}{"failedNode": avoidNode}}); err != nil {
+			slog.Warn("Failed to record failed node", "name", name, "node", avoidNode, "error", err)
 		}
+	}
+	set := classifyPods(item, pods, tmpl, now)
+	reconcileDisruptionBudget(ctx, client, item, spec, replicas)
 
-		time.Sleep(5 * time.Second)
+	// מושהה (kubectl ethereal pause): רק מדווחים, בלי ריפוי, rollout או מחיקות עד resume
+	if paused, _, _ := unstructured.NestedBool(spec, "paused"); paused {
+		recordReplicaStatus(ctx, dyn, item, set, strategy, now)
+		setWaitingReason(ctx, dyn, item, "Paused")
+		if err := setConditions(ctx, dyn, item, availability(set, replicas, strategy, now)); err != nil {
+			slog.Warn("Failed to update availability", "name", name, "error", err)
+		}
+		return nil
+	}
+
+	// חלון שינה: אין פודים ואין ריפוי עד שהחלון נגמר
+	if hibernatedBy != "" {
+		hibernate(ctx, client, dyn, item, set, policy, hibernatedBy, now)
+		return nil
+	}
+
+	// פוד שקרס לא יעלה שוב לבד (RestartPolicyNever) - שומרים ראיות ומוחקים אותו.
+	// פוד שהמדיניות לא מרשה לרפא נשאר במקומו ותופס את המקום של הרפליקה
+	reason := state.pendingReason
+	held := 0
+	for _, pod := range set.terminated {
+		failure := failureReason(pod)
+		if ok, blocked := policy.allows(state, failure, now); !ok {
+			reportBlocked(ctx, client, dyn, item, state, policy.ref(), failure, blocked)
+			held++
+			continue
+		}
+		countRolloutFailure(ctx, dyn, item, pod, tmpl)
+		healFailedPod(ctx, client, dyn, item, spec, pod, policy, failure)
+		reason = failure
+		if nodeFailure(pod) && pod.Spec.NodeName != "" {
+			avoidNode = pod.Spec.NodeName
+		}
+	}
+	if reason == "" {
+		reason = reasonDeleted
+	}
+
+	// בדיקה אקטיבית: פוד שה-kubelet חושב שהוא תקין אבל האפליקציה מדווחת שהוא לא
+	if tmpl.active != nil {
+		for _, pod := range runActiveCheck(ctx, client, dyn, item, tmpl.active, append(append([]*corev1.Pod(nil), set.current...), set.old...), now) {
+			if ok, blocked := policy.allows(state, reasonUnhealthy, now); !ok {
+				reportBlocked(ctx, client, dyn, item, state, policy.ref(), reasonUnhealthy, blocked)
+				continue
+			}
+			recordEvent(ctx, client, item, corev1.EventTypeWarning, "UnhealthyPod", fmt.Sprintf("Pod %s failed the active health check, replacing it", pod.Name))
+			healFailedPod(ctx, client, dyn, item, spec, pod, policy, reasonUnhealthy)
+		}
+	}
+
+	// בדיקה עמוקה: DB, latency ושיעור שגיאות. המדיניות מחליטה אם להחליף פוד degraded
+	if deep := readDeepHealthSettings(spec); deep != nil {
+		for _, pod := range runDeepHealth(ctx, client, dyn, item, deep, proxyFetcher(client), append(append([]*corev1.Pod(nil), set.current...), set.old...), policy, now) {
+			if ok, blocked := policy.allows(state, reasonDegraded, now); !ok {
+				reportBlocked(ctx, client, dyn, item, state, policy.ref(), reasonDegraded, blocked)
+				continue
+			}
+			recordEvent(ctx, client, item, corev1.EventTypeWarning, "DegradedPod", fmt.Sprintf("Pod %s stayed degraded, recycling it per %s", pod.Name, policy.ref()))
+			healFailedPod(ctx, client, dyn, item, spec, pod, policy, reasonDegraded)
+		}
+	}
+
+	depsReady, waiting := checkDependencies(ctx, dyn, item, graph)
+	recordReplicaStatus(ctx, dyn, item, set, strategy, now)
+	if err := setConditions(ctx, dyn, item, availability(set, replicas, strategy, now)); err != nil {
+		slog.Warn("Failed to update availability", "name", name, "error", err)
+	}
+	progressRollout(ctx, client, dyn, item, set, tmpl, replicas, strategy, now)
+
+	priority, _, _ := unstructured.NestedInt64(spec, "priority")
+	tmpl.avoidNode = avoidNode
+	request := resurrection{item: item, client: client, policy: policy, state: state, priority: priority, template: tmpl}
+
+	// גרסה ישנה עדיין רצה - מחליפים בהדרגה לפי maxSurge/maxUnavailable
+	if len(set.old) > 0 {
+		var create int
+		var retire []*corev1.Pod
+		hold := false
+		// מחזור לפי ttl הוא אותה גרסה - אין מה לנתח בקנרית
+		if strategy.canary != nil && set.driftReason != reasonTTLExpired {
+			create, hold = runCanary(ctx, client, dyn, item, set, tmpl, strategy.canary, strategy, now)
+		}
+		if !hold {
+			create, retire = planRollout(set, replicas, strategy, now)
+		}
+		for _, pod := range retire {
+			retirePod(ctx, client, item, pod, policy, set.driftReason)
+		}
+		var queue []resurrection
+		for i := 0; i < create; i++ {
+			r := request
+			r.reason, r.rollout = set.driftReason, true
+			queue = append(queue, r)
+		}
+		return queue
+	}
+
+	// ה-PDB חוסם את הפינוי של רפליקה יחידה - מקימים חלופה על node אחר לפני שמשחררים אותה
+	if queue, draining := coordinateDrain(ctx, client, item, set, replicas, request, strategy, now); draining {
+		return queue
+	}
+
+	for _, pod := range excessPods(set.current, replicas) {
+		retirePod(ctx, client, item, pod, policy, "ScaledDown")
+	}
+
+	missing := replicas - len(set.current) - held
+	if missing <= 0 {
+		// מעגל תלויות מוצג גם כשהפודים רצים: אחרי השבתה של הקלאסטר הם לא יקומו
+		if cycle, _ := graph.blockingCycle(item); cycle != nil {
+			setWaitingReason(ctx, dyn, item, waiting)
+		} else {
+			setWaitingReason(ctx, dyn, item, "")
+		}
+		markStable(ctx, dyn, item, state, policy, set.current, now)
+		return nil
+	}
+
+	// אחרי השבתה של כל הקלאסטר - מקימים רק כשהתלויות כבר זמינות
+	if !depsReady {
+		setWaitingReason(ctx, dyn, item, waiting)
+		return nil
+	}
+	setWaitingReason(ctx, dyn, item, "")
+
+	if ok, blocked := policy.allows(state, reason, now); !ok {
+		reportBlocked(ctx, client, dyn, item, state, policy.ref(), reason, blocked)
+		return nil
+	}
+
+	// אם חסרים פודים - זה הזמן להקים אותם (Self-healing)
+	queue := make([]resurrection, 0, missing)
+	for i := 0; i < missing; i++ {
+		r := request
+		r.reason = reason
+		queue = append(queue, r)
 	}
+	return queue
 }
 
-// reconcile מקבלת כעת רק 2 פרמטרים
-// reconcile בודקת את המצב הקיים מול המצב הרצוי עבור אובייקט ספציפי
-func reconcile(ctx context.Context, item unstructured.Unstructured, client *kubernetes.Clientset) {
-    name := item.GetName()
-    
-    // שליפת ה-Spec מתוך ה-Custom Resource הדינמי
-    spec, found, err := unstructured.NestedMap(item.Object, "spec")
-    if !found || err != nil {
-        slog.Warn("Could not find spec in resource", "name", name)
-        return
-    }
-
-    // הגדרת ברירת מחדל לאימג' אם לא צוין ב-CR
-    image, _, _ := unstructured.NestedString(spec, "image")
-    if image == "" {
-        image = "sunday-app:v2" 
-    }
-
-    podName := "real-" + name
-
-    // במקום context.TODO, אנחנו משתמשים ב-ctx שעובר מה-main
-    _, err = client.CoreV1().Pods("default").Get(ctx, podName, metav1.GetOptions{})
-
-    if err != nil {
-        // אם השגיאה היא שהפוד לא נמצא - זה הזמן להקים אותו (Self-healing)
-        slog.Info("Pod missing, resurrecting...", "pod", podName)
-        createPod(ctx, client, podName, image)
-    }
+// healFailedPod שומרת post-mortem של הפוד שקרס, מקשרת אותו מה-status ומוחקת את הפוד
+func healFailedPod(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, spec map[string]interface{}, pod *corev1.Pod, policy *healingPolicy, reason string) {
+	tailLines, keep := postMortemSettings(spec)
+
+	key, report, err := capturePostMortem(ctx, client, item, pod, tailLines, keep)
+	if err != nil {
+		// לא חוסמים את הריפוי בגלל כשל בשמירת הראיות
+		slog.Error("Failed to store post-mortem", "pod", pod.Name, "error", err)
+	} else {
+		link := map[string]interface{}{
+			"configMap":  postMortemConfigMapName(item.GetName()),
+			"key":        key,
+			"pod":        pod.Name,
+			"capturedAt": report.CapturedAt.Format(time.RFC3339),
+		}
+		for _, c := range report.Containers {
+			if c.Reason != "" || c.ExitCode != 0 {
+				link["reason"] = c.Reason
+				link["exitCode"] = int64(c.ExitCode)
+				break
+			}
+		}
+		if err := patchStatus(ctx, dyn, item, map[string]interface{}{"lastPostMortem": link}); err != nil {
+			slog.Warn("Failed to link post-mortem from status", "name", item.GetName(), "error", err)
+		}
+		slog.Info("Captured post-mortem of failed pod", "pod", pod.Name, "configMap", link["configMap"], "key", key)
+	}
+
+	if oomKilled(report) {
+		tuneAfterOOM(ctx, client, dyn, item, spec, pod)
+	}
+
+	// הסבב הבא יראה פוד חסר - שומרים את הסיבה המקורית כדי שהמדיניות תחול עליה,
+	// ואת ה-node אם הוא זה שהפיל את הפוד
+	healing := map[string]interface{}{"pendingReason": reason}
+	if nodeFailure(pod) && pod.Spec.NodeName != "" {
+		healing["failedNode"] = pod.Spec.NodeName
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"healing": healing}); err != nil {
+		slog.Warn("Failed to record pending healing reason", "name", item.GetName(), "error", err)
+	}
+
+	healingRecords.removing(item, pod, reason, true, time.Now())
+	opts := metav1.DeleteOptions{DryRun: planned("delete", "pods", pod.Namespace, pod.Name, "reason", reason)}
+	if policy != nil {
+		opts.GracePeriodSeconds = policy.gracePeriod
+	}
+	err = client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, opts)
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Error("Failed to delete failed pod", "pod", pod.Name, "error", err)
+		return
+	}
+	slog.Info("Deleted failed pod, it will be resurrected", "pod", pod.Name, "reason", reason)
+}
+
+// loadKubeConfig מחזירה את הגדרות החיבור: בתוך הקלאסטר ה-ServiceAccount, ומחוץ לו ~/.kube/config.
+// משותפת לאופרטור ול-plugin
+func loadKubeConfig() (config *rest.Config, inCluster bool, err error) {
+	if config, err = rest.InClusterConfig(); err == nil {
+		return config, true, nil
+	}
+
+	var kubeconfig string
+	if home := homedir.HomeDir(); home != "" {
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	} else {
+		kubeconfig = filepath.Join(os.Getenv("USERPROFILE"), ".kube", "config")
+	}
+	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	return config, false, err
+}
+
+// createPod מקימה פוד חדש לפי התבנית, עם שם ייחודי ו-label שמקשר אותו ל-EtherealPod
+func createPod(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, tmpl podTemplate) (*corev1.Pod, error) {
+	return applyPod(ctx, client, item, desiredPod(item, tmpl))
 }
 
-func createPod(ctx context.Context, client *kubernetes.Clientset, name string, image string) {
-	newPod := &corev1.Pod{
+// desiredPod בונה את הפוד שהאופרטור היה מקים עכשיו. משמשת גם את kubectl ethereal diff
+func desiredPod(item unstructured.Unstructured, tmpl podTemplate) *corev1.Pod {
+	probes := tmpl.containerProbes()
+	annotations := tmpl.annotations()
+
+	labels := managedLabels(item)
+	labels["app"] = "sunday-app"
+
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   name,
-			Labels: map[string]string{"managed-by": "ethereal-operator", "app": "sunday-app"},
+			GenerateName:    "real-" + item.GetName() + "-",
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: ownerReferences(item, true),
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
 					Name:            "main-container",
-					Image:           image,
+					Image:           tmpl.image,
 					ImagePullPolicy: corev1.PullIfNotPresent,
-					LivenessProbe: &corev1.Probe{
-						ProbeHandler: corev1.ProbeHandler{
-							HTTPGet: &corev1.HTTPGetAction{
-								Path: "/health",
-								Port: intstr.FromInt(8080),
-							},
-						},
-						InitialDelaySeconds: 10,
-						PeriodSeconds:       15,
-					},
+					Resources:       tmpl.resources,
+					Env:             tmpl.env,
+					EnvFrom:         tmpl.envFrom,
+					LivenessProbe:   probes.Liveness,
+					ReadinessProbe:  probes.Readiness,
+					StartupProbe:    probes.Startup,
 				},
 			},
-			RestartPolicy: corev1.RestartPolicyNever,
+			RestartPolicy:             corev1.RestartPolicyNever,
+			Affinity:                  tmpl.placement.affinity(item, tmpl.avoidNode),
+			TopologySpreadConstraints: tmpl.placement.topologySpreadConstraints(item),
 		},
 	}
-
-	_, err := client.CoreV1().Pods("default").Create(ctx, newPod, metav1.CreateOptions{})
-	if err != nil {
-		slog.Error("Failed to resurrect pod", "pod", name, "error", err)
-	} else {
-		slog.Info("Successfully resurrected pod", "pod", name)
+	if tmpl.adopted != nil {
+		tmpl.adopted.apply(pod)
 	}
-}
\ No newline at end of file
+	return pod
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestCluster - אשכול מזויף (אותו אחד של --simulate) עם EtherealPod בשם ghost
+func newTestCluster(t *testing.T, spec map[string]interface{}) *fakeCluster {
+	t.Helper()
+	resetOperatorState()
+	c := newFakeCluster()
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sunday.com/v1",
+		"kind":       "EtherealPod",
+		"metadata":   map[string]interface{}{"name": "ghost", "namespace": "default"},
+		"spec":       spec,
+	}}
+	fillMeta(item)
+	if err := c.dyn.Tracker().Create(gvr, item, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *fakeCluster) item(t *testing.T) unstructured.Unstructured {
+	t.Helper()
+	item, err := c.dyn.Resource(gvr).Namespace("default").Get(context.Background(), "ghost", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *item
+}
+
+// edit משנה את ה-EtherealPod ישירות ב-tracker, כמו משתמש או בקר אחר, בלי לעבור דרך האופרטור
+func (c *fakeCluster) edit(t *testing.T, value interface{}, fields ...string) {
+	t.Helper()
+	item := c.item(t)
+	if err := unstructured.SetNestedField(item.Object, value, fields...); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.dyn.Tracker().Update(gvr, &item, "default"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *fakeCluster) pods(t *testing.T) []corev1.Pod {
+	t.Helper()
+	list, err := c.client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+// settle מריץ סבבים מלאים עד שהפודים רצים וה-rollout הראשון הושלם
+func (c *fakeCluster) settle(t *testing.T) {
+	t.Helper()
+	loop := &operatorLoop{client: c.client, dyn: c.dyn, limiter: newResurrectionLimiter(0, 0, 0), chaos: newChaosController()}
+	for i := 0; i < 2; i++ {
+		if err := loop.pass(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.kubelet(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.client.ClearActions()
+	c.dyn.ClearActions()
+}
+
+// deleted - שמות הפודים שהאופרטור מחק מאז ה-ClearActions האחרון
+func (c *fakeCluster) deleted() []string {
+	var names []string
+	for _, action := range c.client.Actions() {
+		if del, ok := action.(k8stesting.DeleteAction); ok && action.GetResource().Resource == "pods" {
+			names = append(names, del.GetName())
+		}
+	}
+	return names
+}
+
+func TestReconcile(t *testing.T) {
+	backoff := &healingPolicy{kind: "HealingPolicy", namespace: "default", name: "slow", backoffInitial: time.Minute, backoffMax: 10 * time.Minute}
+
+	cases := []struct {
+		name     string
+		replicas int64
+		// settled - להתחיל מפודים שהאופרטור כבר הקים ושרצים
+		settled bool
+		policy  *healingPolicy
+		change  func(t *testing.T, c *fakeCluster)
+
+		wantQueue   int
+		wantReason  string
+		wantRollout bool
+		wantDeleted int
+		wantBlocked string
+	}{
+		{
+			name: "missing pods are queued", replicas: 2,
+			wantQueue: 2, wantReason: reasonDeleted,
+		},
+		{
+			name: "healthy pods are left alone", replicas: 2, settled: true,
+		},
+		{
+			name: "deleted pod is resurrected", replicas: 2, settled: true,
+			change: func(t *testing.T, c *fakeCluster) {
+				pod := c.pods(t)[0]
+				if err := c.client.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), "default", pod.Name); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantQueue: 1, wantReason: reasonDeleted,
+		},
+		{
+			name: "failed pod is deleted and replaced", replicas: 1, settled: true,
+			change:    failFirstPod("Error", 1),
+			wantQueue: 1, wantReason: "Error", wantDeleted: 1,
+		},
+		{
+			name: "OOMKilled pod is replaced with the specific reason", replicas: 1, settled: true,
+			change:    failFirstPod("OOMKilled", 137),
+			wantQueue: 1, wantReason: "OOMKilled", wantDeleted: 1,
+		},
+		{
+			name: "image drift starts a rollout", replicas: 1, settled: true,
+			change: func(t *testing.T, c *fakeCluster) {
+				c.edit(t, "sunday-app:v2", "spec", "image")
+			},
+			wantQueue: 1, wantReason: reasonSpecChanged, wantRollout: true,
+		},
+		{
+			name: "pod within its ttl is left alone", replicas: 1, settled: true,
+			change: func(t *testing.T, c *fakeCluster) {
+				c.edit(t, int64(3600), "spec", "ttl")
+			},
+		},
+		{
+			name: "expired pod is replaced before it is deleted", replicas: 1, settled: true,
+			change: func(t *testing.T, c *fakeCluster) {
+				c.edit(t, int64(60), "spec", "ttl")
+				pod := c.pods(t)[0]
+				pod.Status.StartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+				if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &pod, "default"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantQueue: 1, wantReason: reasonTTLExpired, wantRollout: true,
+		},
+		{
+			name: "backoff holds a failed pod", replicas: 1, settled: true, policy: backoff,
+			change:      failFirstPod("Error", 1),
+			wantBlocked: "BackingOff",
+		},
+		{
+			name: "failed pod is replaced once the backoff has passed", replicas: 1, settled: true, policy: backoff,
+			change: func(t *testing.T, c *fakeCluster) {
+				c.edit(t, time.Now().Add(-2*time.Minute).UTC().Format(time.RFC3339), "status", "healing", "lastResurrection")
+				failFirstPod("Error", 1)(t, c)
+			},
+			wantQueue: 1, wantReason: "Error", wantDeleted: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "replicas": tc.replicas})
+			if tc.settled {
+				c.settle(t)
+			}
+			if tc.change != nil {
+				tc.change(t, c)
+			}
+
+			item := c.item(t)
+			queue := reconcile(context.Background(), item, c.client, c.dyn, tc.policy, newDependencyGraph([]unstructured.Unstructured{item}))
+
+			if len(queue) != tc.wantQueue {
+				t.Fatalf("queued %d resurrections, want %d", len(queue), tc.wantQueue)
+			}
+			for _, r := range queue {
+				if r.reason != tc.wantReason || r.rollout != tc.wantRollout {
+					t.Errorf("queued reason %q rollout %v, want %q rollout %v", r.reason, r.rollout, tc.wantReason, tc.wantRollout)
+				}
+			}
+			if deleted := c.deleted(); len(deleted) != tc.wantDeleted {
+				t.Errorf("deleted pods %v, want %d", deleted, tc.wantDeleted)
+			}
+			blocked, _, _ := unstructured.NestedString(c.item(t).Object, "status", "healing", "blockedReason")
+			if blocked != tc.wantBlocked {
+				t.Errorf("blockedReason = %q, want %q", blocked, tc.wantBlocked)
+			}
+		})
+	}
+}
+
+func failFirstPod(reason string, code int32) func(t *testing.T, c *fakeCluster) {
+	return func(t *testing.T, c *fakeCluster) {
+		pod := c.pods(t)[0]
+		failPod(&pod, reason, code)
+		if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &pod, "default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreatePodIsOwnedByTheEtherealPod(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1"})
+	item := c.item(t)
+
+	pod, err := createPod(context.Background(), c.client, item, desiredTemplate(item, item.Object["spec"].(map[string]interface{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.OwnerReferences) != 1 {
+		t.Fatalf("owner references = %v", pod.OwnerReferences)
+	}
+	owner := pod.OwnerReferences[0]
+	if owner.Kind != "EtherealPod" || owner.Name != "ghost" || owner.UID != item.GetUID() {
+		t.Errorf("owner = %s/%s %s, want EtherealPod/ghost %s", owner.Kind, owner.Name, owner.UID, item.GetUID())
+	}
+	if owner.Controller == nil || !*owner.Controller || owner.BlockOwnerDeletion == nil || !*owner.BlockOwnerDeletion {
+		t.Errorf("owner is not a blocking controller reference: %+v", owner)
+	}
+	if pod.Labels[labelEtherealPod] != "ghost" || pod.Spec.Containers[0].Image != "sunday-app:v1" {
+		t.Errorf("pod labels %v image %s", pod.Labels, pod.Spec.Containers[0].Image)
+	}
+}
+
+func TestStatusUpdates(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "replicas": int64(2)})
+	c.settle(t)
+
+	item := c.item(t)
+	status := func(fields ...string) interface{} {
+		v, _, _ := unstructured.NestedFieldNoCopy(c.item(t).Object, append([]string{"status"}, fields...)...)
+		return v
+	}
+	if got := status("readyReplicas"); got != int64(2) {
+		t.Errorf("readyReplicas = %v, want 2", got)
+	}
+	if got := status("resurrections"); got != int64(2) {
+		t.Errorf("resurrections = %v, want 2", got)
+	}
+	if got := availableStatus(c.item(t)); got != "True" {
+		t.Errorf("Available = %s, want True", got)
+	}
+
+	// apply של status מוחק שדות שלא נשלחו, אז כל עדכון חייב לכלול את כל מה שהאופרטור כבר כתב
+	if err := patchStatus(context.Background(), c.dyn, item, map[string]interface{}{"waitingReason": "Testing"}); err != nil {
+		t.Fatal(err)
+	}
+	if status("waitingReason") != "Testing" || status("readyReplicas") != int64(2) {
+		t.Errorf("status after a partial update: %v", c.item(t).Object["status"])
+	}
+	if err := patchStatus(context.Background(), c.dyn, item, map[string]interface{}{"waitingReason": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if status("waitingReason") != nil {
+		t.Errorf("waitingReason was not removed: %v", status("waitingReason"))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registry היא רשימת מטריקות מינימלית בפורמט הטקסט של Prometheus.
+// אין לנו את ספריית ה-client של Prometheus ב-vendor, וצריך רק gauges ו-counters
+type registry struct {
+	mu     sync.Mutex
+	meta   map[string][2]string // name -> {type, help}
+	values map[string]map[string]float64
+}
+
+var metrics = newRegistry()
+
+func newRegistry() *registry {
+	return &registry{meta: map[string][2]string{}, values: map[string]map[string]float64{}}
+}
+
+func (r *registry) describe(name, typ, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.meta[name] = [2]string{typ, help}
+	if r.values[name] == nil {
+		r.values[name] = map[string]float64{}
+	}
+}
+
+func (r *registry) set(name string, labels map[string]string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[name] == nil {
+		r.values[name] = map[string]float64{}
+	}
+	r.values[name][formatLabels(labels)] = v
+}
+
+func (r *registry) add(name string, labels map[string]string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[name] == nil {
+		r.values[name] = map[string]float64{}
+	}
+	r.values[name][formatLabels(labels)] += v
+}
+
+func (r *registry) get(name string, labels map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[name][formatLabels(labels)]
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.values))
+	for name := range r.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		if m, ok := r.meta[name]; ok {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m[1], name, m[0])
+		}
+		series := make([]string, 0, len(r.values[name]))
+		for labels := range r.values[name] {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			fmt.Fprintf(w, "%s%s %g\n", name, labels, r.values[name][labels])
+		}
+	}
+}
+
+// serveMetrics חושפת את /metrics ברקע; כשל בהאזנה לא עוצר את האופרטור
+func serveMetrics(addr string) {
+	if addr == "" || addr == "0" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
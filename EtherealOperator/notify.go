@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// סיבות שלא מגיעות מ-Event: כל התחייה, ומעבר של סף ההתחיות בחלון
+const (
+	notifyResurrected           = "Resurrected"
+	notifyRepeatedResurrections = "RepeatedResurrections"
+)
+
+// כותרת החתימה של webhook: sha256=<hex של HMAC-SHA256 על הגוף>
+const signatureHeader = "X-Ethereal-Signature"
+
+// כמה הודעות ממתינות לשליחה לפני שמתחילים לזרוק
+const notificationQueueSize = 256
+
+// notification היא הודעה אחת. השדות מיוצאים בשביל ה-template וה-JSON
+type notification struct {
+	Reason      string    `json:"reason"`
+	Type        string    `json:"type"`
+	Namespace   string    `json:"namespace"`
+	EtherealPod string    `json:"etherealPod"`
+	Message     string    `json:"message"`
+	Count       int       `json:"count,omitempty"`
+	Policy      string    `json:"policy,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// sink הוא יעד של הודעות
+type sink interface {
+	send(ctx context.Context, n notification) error
+}
+
+// webhookSink שולחת POST עם גוף JSON, חותמת עליו ב-HMAC אם יש סוד, ומנסה שוב על שגיאות זמניות
+type webhookSink struct {
+	url      string
+	template *template.Template // nil - ההודעה עצמה כ-JSON
+	secret   []byte
+	retries  int
+	backoff  time.Duration
+	client   *http.Client
+}
+
+// templateFuncs זמינות ב-template של webhook; json מחזירה ערך מקודד כדי לשלב מחרוזות בבטחה
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func (w *webhookSink) render(n notification) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(n)
+	}
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, n); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *webhookSink) send(ctx context.Context, n notification) error {
+	body, err := w.render(n)
+	if err != nil {
+		return fmt.Errorf("render template: %w", err)
+	}
+
+	delay := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil || !retry || attempt >= w.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post מחזירה גם אם כדאי לנסות שוב: שגיאת רשת, 429 או 5xx כן; שאר ה-4xx לא
+func (w *webhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ethereal-operator")
+	if len(w.secret) > 0 {
+		req.Header.Set(signatureHeader, "sha256="+sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// fileSink כותבת שורת JSON לכל הודעה, לקובץ או ל-stdout ("-")
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (f *fileSink) send(ctx context.Context, n notification) error {
+	line, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.path == "-" {
+		_, err = os.Stdout.Write(line)
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// webhookAllowlist - --webhook-allowlist: הכתובות ש-HealingPolicy בתוך namespace יכולה לשלוח אליהן.
+// בלי רשימה אין לה webhooks בכלל. ClusterHealingPolicy והקובץ הגלובלי לא מוגבלים
+var webhookAllowlist []string
+
+// webhookAllowed - אותו scheme ו-host כמו אחת הכתובות ברשימה, ו-path שמתחיל ב-path שלה (עד גבול של /)
+func webhookAllowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil {
+		return false
+	}
+	for _, entry := range webhookAllowlist {
+		allowed, err := url.Parse(entry)
+		if err != nil || allowed.Scheme != u.Scheme || !strings.EqualFold(allowed.Host, u.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(allowed.Path, "/")
+		if u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sinkConfig הוא sink כפי שנכתב ב-spec.notifications.sinks או בקובץ ההגדרות הגלובלי
+type sinkConfig struct {
+	name string
+
+	url       string
+	template  *template.Template
+	secretRef *corev1.SecretKeySelector
+	secretNS  string
+	retries   int
+	timeout   time.Duration
+
+	path string
+}
+
+// notificationConfig היא spec.notifications אחרי פענוח. הסודות נקראים רק כשבונים את ה-sinks
+type notificationConfig struct {
+	sinks      []sinkConfig
+	reasons    map[string]bool // ריק - כל Event מסוג Warning
+	threshold  int             // התחיות בתוך window שמעליהן נשלחת RepeatedResurrections
+	window     time.Duration
+	dedup      time.Duration
+	maxPerHour int
+	// fingerprint מזהה שינוי בהגדרות, כדי לא לבנות את ה-sinks מחדש בכל סבב
+	fingerprint string
+}
+
+// parseNotificationConfig קוראת הגדרת התראות. namespace הוא של HealingPolicy; במדיניות
+// ברמת הקלאסטר ובקובץ הגלובלי הוא ריק, ושם צריך לציין secretRef.namespace
+func parseNotificationConfig(m map[string]interface{}, namespace string) (*notificationConfig, error) {
+	fingerprint, _ := json.Marshal(m)
+	c := &notificationConfig{window: time.Hour, dedup: 5 * time.Minute, maxPerHour: 60, fingerprint: string(fingerprint), reasons: map[string]bool{}}
+
+	reasons, _, _ := unstructured.NestedStringSlice(m, "events")
+	for _, r := range reasons {
+		c.reasons[r] = true
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "resurrectionThreshold", "count"); found && v > 0 {
+		c.threshold = int(v)
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "resurrectionThreshold", "windowMinutes"); found && v > 0 {
+		c.window = time.Duration(v) * time.Minute
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "dedupSeconds"); found && v >= 0 {
+		c.dedup = time.Duration(v) * time.Second
+	}
+	if v, found, _ := unstructured.NestedInt64(m, "maxPerHour"); found && v >= 0 {
+		c.maxPerHour = int(v)
+	}
+
+	sinks, _, _ := unstructured.NestedSlice(m, "sinks")
+	for i, s := range sinks {
+		sm, _ := s.(map[string]interface{})
+		sc, err := parseSinkConfig(sm, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		if sc.name == "" {
+			sc.name = fmt.Sprintf("sink-%d", i)
+		}
+		c.sinks = append(c.sinks, sc)
+	}
+	if len(c.sinks) == 0 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+	return c, nil
+}
+
+// parseSinkConfig - HealingPolicy (namespace לא ריק) נכתבת ע"י מי שיש לו הרשאות רק ב-namespace שלו:
+// אסור לה לכתוב לקבצים של האופרטור, לקרוא סודות מ-namespace אחר או לשלוח לכתובת שלא ברשימה המותרת
+func parseSinkConfig(m map[string]interface{}, namespace string) (sinkConfig, error) {
+	sc := sinkConfig{retries: 3, timeout: 5 * time.Second}
+	sc.name, _, _ = unstructured.NestedString(m, "name")
+
+	if path, found, _ := unstructured.NestedString(m, "file", "path"); found {
+		if namespace != "" {
+			return sc, fmt.Errorf("file sinks are only allowed in the global configuration or a ClusterHealingPolicy")
+		}
+		if path == "" {
+			return sc, fmt.Errorf("file.path is required")
+		}
+		sc.path = path
+		return sc, nil
+	}
+
+	wh, ok := m["webhook"].(map[string]interface{})
+	if !ok {
+		return sc, fmt.Errorf("one of webhook or file is required")
+	}
+	sc.url, _, _ = unstructured.NestedString(wh, "url")
+	if !strings.HasPrefix(sc.url, "http://") && !strings.HasPrefix(sc.url, "https://") {
+		return sc, fmt.Errorf("webhook.url must be an http(s) URL")
+	}
+	if namespace != "" && !webhookAllowed(sc.url) {
+		return sc, fmt.Errorf("webhook.url %s is not in the operator's --webhook-allowlist", sc.url)
+	}
+	if text, _, _ := unstructured.NestedString(wh, "template"); text != "" {
+		tmpl, err := template.New(sc.name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return sc, fmt.Errorf("webhook.template: %w", err)
+		}
+		sc.template = tmpl
+	}
+	if v, found, _ := unstructured.NestedInt64(wh, "retries"); found && v >= 0 {
+		sc.retries = int(v)
+	}
+	if v, found, _ := unstructured.NestedInt64(wh, "timeoutSeconds"); found && v > 0 {
+		sc.timeout = time.Duration(v) * time.Second
+	}
+	if ref, found, _ := unstructured.NestedMap(wh, "secretRef"); found {
+		sc.secretRef = &corev1.SecretKeySelector{}
+		sc.secretRef.Name, _, _ = unstructured.NestedString(ref, "name")
+		sc.secretRef.Key, _, _ = unstructured.NestedString(ref, "key")
+		sc.secretNS, _, _ = unstructured.NestedString(ref, "namespace")
+		if namespace != "" {
+			if sc.secretNS != "" && sc.secretNS != namespace {
+				return sc, fmt.Errorf("webhook.secretRef.namespace must be the policy's namespace %s", namespace)
+			}
+			sc.secretNS = namespace
+		}
+		if sc.secretRef.Name == "" || sc.secretRef.Key == "" || sc.secretNS == "" {
+			return sc, fmt.Errorf("webhook.secretRef needs name, key and namespace")
+		}
+	}
+	return sc, nil
+}
+
+// build יוצרת את ה-sink, כולל קריאת הסוד של ה-HMAC
+func (sc sinkConfig) build(ctx context.Context, client kubernetes.Interface) (sink, error) {
+	if sc.path != "" {
+		return &fileSink{path: sc.path}, nil
+	}
+	w := &webhookSink{url: sc.url, template: sc.template, retries: sc.retries, backoff: time.Second, client: &http.Client{Timeout: sc.timeout}}
+	if sc.secretRef != nil {
+		secret, err := client.CoreV1().Secrets(sc.secretNS).Get(ctx, sc.secretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("read secret %s/%s: %w", sc.secretNS, sc.secretRef.Name, err)
+		}
+		value, ok := secret.Data[sc.secretRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s/%s has no key %q", sc.secretNS, sc.secretRef.Name, sc.secretRef.Key)
+		}
+		w.secret = value
+	}
+	return w, nil
+}
+
+// notificationRoute היא הגדרה אחת (גלובלית או של מדיניות) עם ה-sinks שלה ומצב ה-dedup וה-rate limit
+type notificationRoute struct {
+	config        *notificationConfig
+	sinks         map[string]sink
+	built         time.Time
+	limiter       *rate.Limiter
+	sent          map[string]time.Time   // מפתח dedup -> שליחה אחרונה
+	resurrections map[string][]time.Time // EtherealPod -> זמני התחייה בחלון
+}
+
+func newNotificationRoute(c *notificationConfig) *notificationRoute {
+	limit := rate.Inf
+	if c.maxPerHour > 0 {
+		limit = rate.Every(time.Hour / time.Duration(c.maxPerHour))
+	}
+	return &notificationRoute{
+		config:        c,
+		sinks:         map[string]sink{},
+		limiter:       rate.NewLimiter(limit, max(c.maxPerHour, 1)),
+		sent:          map[string]time.Time{},
+		resurrections: map[string][]time.Time{},
+	}
+}
+
+// prune שוכחת שליחות שחלון ה-dedup שלהן עבר והתחיות שיצאו מהחלון, כדי שהמפות לא יגדלו
+// עם כל EtherealPod שאי פעם שלח הודעה
+func (r *notificationRoute) prune(now time.Time) {
+	for key, last := range r.sent {
+		if now.Sub(last) >= r.config.dedup {
+			delete(r.sent, key)
+		}
+	}
+	for key, times := range r.resurrections {
+		if recent := recentWithin(times, now, r.config.window); len(recent) > 0 {
+			r.resurrections[key] = recent
+		} else {
+			delete(r.resurrections, key)
+		}
+	}
+}
+
+// accept מחליטה אילו הודעות לשלוח בעקבות n: סינון לפי events, סף התחיות, dedup ו-rate limit
+func (r *notificationRoute) accept(n notification) []notification {
+	var out []notification
+	key := n.Namespace + "/" + n.EtherealPod
+
+	if n.Reason == notifyResurrected && r.config.threshold > 0 {
+		recent := append(recentWithin(r.resurrections[key], n.Time, r.config.window), n.Time)
+		r.resurrections[key] = recent
+		if len(recent) >= r.config.threshold {
+			repeated := n
+			repeated.Reason, repeated.Type, repeated.Count = notifyRepeatedResurrections, corev1.EventTypeWarning, len(recent)
+			repeated.Message = fmt.Sprintf("%d resurrections in the last %s", len(recent), r.config.window)
+			out = append(out, repeated)
+		}
+	}
+	if r.config.reasons[n.Reason] || (len(r.config.reasons) == 0 && n.Type == corev1.EventTypeWarning) {
+		out = append(out, n)
+	}
+
+	var allowed []notification
+	for _, o := range out {
+		dedupKey := key + "/" + o.Reason
+		if last, ok := r.sent[dedupKey]; ok && o.Time.Sub(last) < r.config.dedup {
+			continue
+		}
+		if !r.limiter.AllowN(o.Time, 1) {
+			slog.Warn("Notification dropped by rate limit", "name", o.EtherealPod, "reason", o.Reason)
+			metrics.add("ethereal_notifications_dropped_total", map[string]string{"cause": "rate_limit"}, 1)
+			continue
+		}
+		r.sent[dedupKey] = o.Time
+		allowed = append(allowed, o)
+	}
+	return allowed
+}
+
+type delivery struct {
+	sink string
+	to   sink
+	n    notification
+}
+
+// notifier מנתבת הודעות ל-sinks הגלובליים ולאלה של המדיניות שחלה על ה-EtherealPod,
+// ושולחת אותן ברקע כדי ש-webhook איטי לא יעכב את הסבב
+type notifier struct {
+	mu       sync.Mutex
+	global   *notificationRoute
+	routes   map[string]*notificationRoute // policy ref -> route
+	policyOf map[string]string             // namespace/name -> policy ref
+	queue    chan delivery
+}
+
+var notifications = newNotifier()
+
+func newNotifier() *notifier {
+	return &notifier{routes: map[string]*notificationRoute{}, policyOf: map[string]string{}, queue: make(chan delivery, notificationQueueSize)}
+}
+
+// כל כמה זמן בונים מחדש sinks עם סוד, כדי לקלוט סיבוב של ה-Secret
+const sinkRefreshInterval = 5 * time.Minute
+
+func init() {
+	metrics.describe("ethereal_notifications_sent_total", "counter", "Notifications delivered to sinks, by sink and result.")
+	metrics.describe("ethereal_notifications_dropped_total", "counter", "Notifications dropped before delivery, by cause.")
+}
+
+// loadGlobal קוראת את קובץ ההגדרות של --notifications-config (YAML או JSON,
+// באותו מבנה כמו spec.notifications של HealingPolicy)
+func (nt *notifier) loadGlobal(ctx context.Context, client kubernetes.Interface, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// דרך JSON של apimachinery, כדי שמספרים שלמים ייקראו כ-int64 כמו ב-unstructured
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	var m map[string]interface{}
+	if err := utiljson.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	c, err := parseNotificationConfig(m, "")
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	route := newNotificationRoute(c)
+	route.refresh(ctx, client, "global", time.Now())
+
+	nt.mu.Lock()
+	nt.global = route
+	nt.mu.Unlock()
+	return nil
+}
+
+// refresh בונה את ה-sinks. sink שנכשל (למשל Secret חסר) נשאר עם הגרסה הקודמת אם יש
+func (r *notificationRoute) refresh(ctx context.Context, client kubernetes.Interface, owner string, now time.Time) {
+	r.built = now
+	for _, sc := range r.config.sinks {
+		s, err := sc.build(ctx, client)
+		if err != nil {
+			slog.Warn("Failed to build notification sink", "owner", owner, "sink", sc.name, "error", err)
+			continue
+		}
+		r.sinks[sc.name] = s
+	}
+}
+
+// configure מסנכרנת את הניתובים עם spec.notifications של המדיניות שנטענו בסבב הזה
+func (nt *notifier) configure(ctx context.Context, client kubernetes.Interface, policies []*healingPolicy, now time.Time) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	current := map[string]bool{}
+	for _, p := range policies {
+		if p.notifications == nil {
+			continue
+		}
+		ref := p.ref()
+		current[ref] = true
+		route, ok := nt.routes[ref]
+		if !ok || route.config.fingerprint != p.notifications.fingerprint {
+			route = newNotificationRoute(p.notifications)
+			nt.routes[ref] = route
+		} else if now.Sub(route.built) < sinkRefreshInterval {
+			route.prune(now)
+			continue
+		}
+		route.prune(now)
+		route.refresh(ctx, client, ref, now)
+	}
+	for ref := range nt.routes {
+		if !current[ref] {
+			delete(nt.routes, ref)
+		}
+	}
+	if nt.global != nil {
+		nt.global.prune(now)
+		if now.Sub(nt.global.built) >= sinkRefreshInterval {
+			nt.global.refresh(ctx, client, "global", now)
+		}
+	}
+}
+
+// bind זוכרת איזו מדיניות חלה על ה-EtherealPod, כדי שהודעות שלו יגיעו גם ל-sinks שלה
+func (nt *notifier) bind(item unstructured.Unstructured, policy *healingPolicy) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	key := item.GetNamespace() + "/" + item.GetName()
+	if policy == nil {
+		delete(nt.policyOf, key)
+		return
+	}
+	nt.policyOf[key] = policy.ref()
+}
+
+// publish מעבירה הודעה לכל ניתוב רלוונטי; השליחה עצמה קורית ב-run
+func (nt *notifier) publish(item unstructured.Unstructured, eventType, reason, message string) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	n := notification{
+		Reason: reason, Type: eventType, Namespace: item.GetNamespace(), EtherealPod: item.GetName(),
+		Message: message, Time: time.Now().UTC(),
+	}
+	n.Policy = nt.policyOf[n.Namespace+"/"+n.EtherealPod]
+
+	for _, route := range []*notificationRoute{nt.global, nt.routes[n.Policy]} {
+		if route == nil {
+			continue
+		}
+		for _, out := range route.accept(n) {
+			for name, s := range route.sinks {
+				select {
+				case nt.queue <- delivery{sink: name, to: s, n: out}:
+				default:
+					slog.Warn("Notification queue is full, dropping", "name", n.EtherealPod, "reason", out.Reason, "sink", name)
+					metrics.add("ethereal_notifications_dropped_total", map[string]string{"cause": "queue_full"}, 1)
+				}
+			}
+		}
+	}
+}
+
+// run שולחת את ההודעות שבתור, אחת אחרי השנייה
+func (nt *notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-nt.queue:
+			if dryRun {
+				slog.Info("Dry run: would notify", "sink", d.sink, "name", d.n.EtherealPod, "reason", d.n.Reason, "message", d.n.Message)
+				continue
+			}
+			err := d.to.send(ctx, d.n)
+			result := "success"
+			if err != nil {
+				result = "error"
+				slog.Warn("Failed to deliver notification", "sink", d.sink, "name", d.n.EtherealPod, "reason", d.n.Reason, "error", err)
+			}
+			metrics.add("ethereal_notifications_sent_total", map[string]string{"sink": d.sink, "result": result}, 1)
+		}
+	}
+}
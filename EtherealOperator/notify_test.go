@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWebhookSink(t *testing.T) {
+	secret := []byte("s3cret")
+	attempts := 0
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if sig := r.Header.Get(signatureHeader); sig != "sha256="+sign(secret, body) {
+			t.Errorf("bad signature %q", sig)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("body is not JSON: %v: %s", err, body)
+		}
+	}))
+	defer srv.Close()
+	webhookAllowlist = []string{srv.URL}
+	defer func() { webhookAllowlist = nil }()
+
+	c, err := parseNotificationConfig(map[string]interface{}{"sinks": []interface{}{map[string]interface{}{
+		"webhook": map[string]interface{}{"url": srv.URL, "template": `{"text": {{json .Message}}, "pod": "{{.EtherealPod}}"}`},
+	}}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.sinks[0].build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := s.(*webhookSink)
+	w.secret, w.backoff = secret, time.Millisecond
+
+	n := notification{EtherealPod: "ghost", Message: `pod "real-ghost-x" resurrected`}
+	if err := w.send(context.Background(), n); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want a retry after 503", attempts)
+	}
+	if got["text"] != n.Message || got["pod"] != "ghost" {
+		t.Errorf("rendered body %v", got)
+	}
+}
+
+func TestWebhookSinkDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := &webhookSink{url: srv.URL, retries: 3, backoff: time.Millisecond, client: srv.Client()}
+	if err := w.send(context.Background(), notification{}); err == nil {
+		t.Fatal("expected an error for 400")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestNotificationRoute(t *testing.T) {
+	c, err := parseNotificationConfig(map[string]interface{}{
+		"sinks":                 []interface{}{map[string]interface{}{"file": map[string]interface{}{"path": "-"}}},
+		"resurrectionThreshold": map[string]interface{}{"count": int64(3), "windowMinutes": int64(60)},
+		"dedupSeconds":          int64(300),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := newNotificationRoute(c)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, typ, reason string) []notification {
+		return route.accept(notification{Namespace: "default", EtherealPod: "ghost", Type: typ, Reason: reason, Time: start.Add(d)})
+	}
+
+	// התחיות לבדן לא נשלחות, רק מעבר הסף
+	if out := at(0, corev1.EventTypeNormal, notifyResurrected); len(out) != 0 {
+		t.Errorf("first resurrection sent %v", out)
+	}
+	at(time.Minute, corev1.EventTypeNormal, notifyResurrected)
+	out := at(2*time.Minute, corev1.EventTypeNormal, notifyResurrected)
+	if len(out) != 1 || out[0].Reason != notifyRepeatedResurrections || out[0].Count != 3 {
+		t.Fatalf("third resurrection sent %+v, want RepeatedResurrections with count 3", out)
+	}
+	if out := at(3*time.Minute, corev1.EventTypeNormal, notifyResurrected); len(out) != 0 {
+		t.Errorf("dedup window did not suppress %+v", out)
+	}
+	if out := at(9*time.Minute, corev1.EventTypeNormal, notifyResurrected); len(out) != 1 {
+		t.Errorf("after the dedup window got %+v", out)
+	}
+
+	// בלי events מוגדרים עוברים רק Events מסוג Warning
+	if out := at(10*time.Minute, corev1.EventTypeWarning, "RolloutFailed"); len(out) != 1 {
+		t.Errorf("warning event sent %+v", out)
+	}
+	if out := at(10*time.Minute, corev1.EventTypeNormal, "RolloutComplete"); len(out) != 0 {
+		t.Errorf("normal event sent %+v", out)
+	}
+}
+
+// HealingPolicy בתוך namespace לא יכולה לכתוב לקבצים של האופרטור, לקרוא סוד מ-namespace אחר
+// או לשלוח לכתובת שלא ב---webhook-allowlist
+func TestNamespacedPolicySinks(t *testing.T) {
+	webhookAllowlist = []string{"https://hooks.example.com"}
+	defer func() { webhookAllowlist = nil }()
+	file := map[string]interface{}{"file": map[string]interface{}{"path": "/etc/passwd"}}
+	foreign := map[string]interface{}{"webhook": map[string]interface{}{
+		"url":       "https://hooks.example.com",
+		"secretRef": map[string]interface{}{"name": "db", "key": "password", "namespace": "kube-system"},
+	}}
+	own := map[string]interface{}{"webhook": map[string]interface{}{
+		"url":       "https://hooks.example.com",
+		"secretRef": map[string]interface{}{"name": "hmac", "key": "secret"},
+	}}
+
+	if _, err := parseSinkConfig(file, "default"); err == nil {
+		t.Error("file sink accepted in a namespaced HealingPolicy")
+	}
+	if _, err := parseSinkConfig(file, ""); err != nil {
+		t.Errorf("file sink rejected in a cluster-wide configuration: %v", err)
+	}
+	if _, err := parseSinkConfig(foreign, "default"); err == nil {
+		t.Error("secretRef to another namespace accepted in a namespaced HealingPolicy")
+	}
+	if sc, err := parseSinkConfig(foreign, ""); err != nil || sc.secretNS != "kube-system" {
+		t.Errorf("cluster-wide secretRef.namespace = %q, %v", sc.secretNS, err)
+	}
+	if sc, err := parseSinkConfig(own, "default"); err != nil || sc.secretNS != "default" {
+		t.Errorf("secretRef namespace = %q, %v, want the policy's namespace", sc.secretNS, err)
+	}
+
+	internal := map[string]interface{}{"webhook": map[string]interface{}{"url": "http://169.254.169.254/latest/meta-data"}}
+	if _, err := parseSinkConfig(internal, "default"); err == nil {
+		t.Error("webhook outside the allowlist accepted in a namespaced HealingPolicy")
+	}
+	if _, err := parseSinkConfig(internal, ""); err != nil {
+		t.Errorf("cluster-wide webhook rejected by the allowlist: %v", err)
+	}
+}
+
+func TestWebhookAllowed(t *testing.T) {
+	webhookAllowlist = []string{"https://hooks.example.com/ethereal/", "https://Alerts.example.com"}
+	defer func() { webhookAllowlist = nil }()
+
+	cases := map[string]bool{
+		"https://hooks.example.com/ethereal":          true,
+		"https://hooks.example.com/ethereal/team-a":   true,
+		"https://hooks.example.com/ethereal-evil":     false,
+		"https://hooks.example.com/other":             false,
+		"http://hooks.example.com/ethereal":           false,
+		"https://hooks.example.com:8443/ethereal":     false,
+		"https://alerts.example.com/anything":         true,
+		"https://alerts.example.com.evil.io/anything": false,
+		"https://user:pw@alerts.example.com/":         false,
+	}
+	for url, want := range cases {
+		if got := webhookAllowed(url); got != want {
+			t.Errorf("webhookAllowed(%q) = %v, want %v", url, got, want)
+		}
+	}
+
+	webhookAllowlist = nil
+	if webhookAllowed("https://hooks.example.com/ethereal") {
+		t.Error("an empty allowlist allowed a webhook")
+	}
+}
+
+// configure שוכחת מפתחות dedup והתחיות ישנים, כך שהמפות לא גדלות עם כל EtherealPod שאי פעם שלח הודעה
+func TestNotificationRoutePrune(t *testing.T) {
+	c, err := parseNotificationConfig(map[string]interface{}{
+		"sinks":                 []interface{}{map[string]interface{}{"file": map[string]interface{}{"path": "-"}}},
+		"events":                []interface{}{notifyResurrected},
+		"resurrectionThreshold": map[string]interface{}{"count": int64(3), "windowMinutes": int64(60)},
+		"dedupSeconds":          int64(300),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nt := newNotifier()
+	nt.global = newNotificationRoute(c)
+	start := time.Now()
+	for _, name := range []string{"old-ghost", "recent-ghost"} {
+		at := start
+		if name == "old-ghost" {
+			at = start.Add(-2 * time.Hour)
+		}
+		nt.global.accept(notification{Namespace: "default", EtherealPod: name, Type: corev1.EventTypeNormal, Reason: notifyResurrected, Time: at})
+	}
+
+	nt.configure(context.Background(), nil, nil, start.Add(10*time.Minute))
+	if _, ok := nt.global.sent["default/old-ghost/"+notifyResurrected]; ok {
+		t.Error("dedup entry older than dedupSeconds was kept")
+	}
+	if _, ok := nt.global.sent["default/recent-ghost/"+notifyResurrected]; ok {
+		t.Error("dedup entry past dedupSeconds was kept")
+	}
+	if _, ok := nt.global.resurrections["default/old-ghost"]; ok {
+		t.Error("resurrections outside the window were kept")
+	}
+	if len(nt.global.resurrections["default/recent-ghost"]) != 1 {
+		t.Errorf("resurrections inside the window were dropped: %v", nt.global.resurrections)
+	}
+}
+
+func TestGlobalNotificationsFile(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "notifications.jsonl")
+	config := filepath.Join(dir, "notifications.yaml")
+	os.WriteFile(config, []byte(`
+sinks:
+- name: audit
+  file:
+    path: `+out+`
+events: ["Resurrected"]
+dedupSeconds: 0
+`), 0o644)
+
+	nt := newNotifier()
+	if err := nt.loadGlobal(context.Background(), nil, config); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go nt.run(ctx)
+
+	item := unstructured.Unstructured{}
+	item.SetNamespace("default")
+	item.SetName("ghost")
+	nt.publish(item, corev1.EventTypeNormal, notifyResurrected, "pod real-ghost-a resurrected")
+	nt.publish(item, corev1.EventTypeNormal, notifyResurrected, "pod real-ghost-b resurrected")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(out)
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) == 2 {
+			var n notification
+			if err := json.Unmarshal([]byte(lines[1]), &n); err != nil || n.Message != "pod real-ghost-b resurrected" {
+				t.Errorf("line %q: %v", lines[1], err)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file sink wrote %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
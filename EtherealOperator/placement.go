@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// הערכים של spec.placement.spread[].topology, ו-label ה-topology שכל אחד מהם מתורגם אליו
+var spreadTopologies = map[string]string{
+	"node": corev1.LabelHostname,
+	"zone": corev1.LabelTopologyZone,
+}
+
+// podPlacement - spec.placement: פיזור הרפליקות בין nodes או zones, ו-anti-affinity בין הרפליקות
+// על אותו node. נכנס ל-hash של התבנית, אז שינוי שלו מחליף את הפודים ב-rollout
+type podPlacement struct {
+	Spread       []spreadRule `json:"spread,omitempty"`
+	AntiAffinity string       `json:"antiAffinity,omitempty"`
+}
+
+type spreadRule struct {
+	Topology          string `json:"topology"`
+	MaxSkew           int32  `json:"maxSkew,omitempty"`
+	WhenUnsatisfiable string `json:"whenUnsatisfiable,omitempty"`
+}
+
+func parsePlacement(spec map[string]interface{}) (*podPlacement, error) {
+	m, found, _ := unstructured.NestedMap(spec, "placement")
+	if !found {
+		return nil, nil
+	}
+	p := &podPlacement{}
+	if err := fromUnstructured(m, p); err != nil {
+		return nil, err
+	}
+
+	for i := range p.Spread {
+		rule := &p.Spread[i]
+		if _, ok := spreadTopologies[rule.Topology]; !ok {
+			return nil, fmt.Errorf("spread[%d]: topology must be node or zone, got %q", i, rule.Topology)
+		}
+		if rule.MaxSkew == 0 {
+			rule.MaxSkew = 1
+		}
+		switch corev1.UnsatisfiableConstraintAction(rule.WhenUnsatisfiable) {
+		case "":
+			// ברירת המחדל לא משאירה פוד Pending כשאין לאן לפזר - עדיף פוד על אותו node מאשר בלי פוד
+			rule.WhenUnsatisfiable = string(corev1.ScheduleAnyway)
+		case corev1.ScheduleAnyway, corev1.DoNotSchedule:
+		default:
+			return nil, fmt.Errorf("spread[%d]: whenUnsatisfiable must be ScheduleAnyway or DoNotSchedule", i)
+		}
+	}
+	switch p.AntiAffinity {
+	case "", "preferred", "required":
+	default:
+		return nil, fmt.Errorf("antiAffinity must be preferred or required, got %q", p.AntiAffinity)
+	}
+
+	if len(p.Spread) == 0 && p.AntiAffinity == "" {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// topologySpreadConstraints מתרגמת את spec.placement.spread, על כל הפודים של ה-EtherealPod (גם מגרסאות קודמות)
+func (p *podPlacement) topologySpreadConstraints(item unstructured.Unstructured) []corev1.TopologySpreadConstraint {
+	if p == nil {
+		return nil
+	}
+	var constraints []corev1.TopologySpreadConstraint
+	for _, rule := range p.Spread {
+		constraints = append(constraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           rule.MaxSkew,
+			TopologyKey:       spreadTopologies[rule.Topology],
+			WhenUnsatisfiable: corev1.UnsatisfiableConstraintAction(rule.WhenUnsatisfiable),
+			LabelSelector:     replicaSelector(item),
+		})
+	}
+	return constraints
+}
+
+// affinity - anti-affinity בין הרפליקות לפי spec.placement, ועדיפות להימנע מה-node שבגללו
+// הפוד הקודם נפל (avoidNode). רק עדיפות, כדי שפוד יקום גם כשאין node אחר
+func (p *podPlacement) affinity(item unstructured.Unstructured, avoidNode string) *corev1.Affinity {
+	affinity := &corev1.Affinity{}
+	if p != nil && p.AntiAffinity != "" {
+		term := corev1.PodAffinityTerm{LabelSelector: replicaSelector(item), TopologyKey: corev1.LabelHostname}
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		if p.AntiAffinity == "required" {
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []corev1.PodAffinityTerm{term}
+		} else {
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: term}}
+		}
+	}
+	if avoidNode != "" {
+		affinity.NodeAffinity = &corev1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+				Weight: 100,
+				Preference: corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{{
+					Key: "metadata.name", Operator: corev1.NodeSelectorOpNotIn, Values: []string{avoidNode},
+				}}},
+			}},
+		}
+	}
+	if affinity.PodAntiAffinity == nil && affinity.NodeAffinity == nil {
+		return nil
+	}
+	return affinity
+}
+
+func replicaSelector(item unstructured.Unstructured) *metav1.LabelSelector {
+	return &metav1.LabelSelector{MatchLabels: map[string]string{labelEtherealPod: item.GetName()}}
+}
+
+// nodeFailure - הפוד נפל בגלל ה-node ולא בגלל האפליקציה: ה-node נעלם, כובה או פינה פודים בגלל לחץ משאבים
+func nodeFailure(pod *corev1.Pod) bool {
+	if lostWithNode(pod) {
+		return true
+	}
+	switch pod.Status.Reason {
+	case "Evicted", "NodeShutdown", "NodeLost", "Terminated":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPlacement(t *testing.T) {
+	item := unstructured.Unstructured{}
+	item.SetName("ghost")
+	spec := map[string]interface{}{"image": "sunday-app:v1"}
+	before := desiredTemplate(item, spec).hash()
+
+	spec["placement"] = map[string]interface{}{
+		"spread":       []interface{}{map[string]interface{}{"topology": "zone", "whenUnsatisfiable": "DoNotSchedule"}, map[string]interface{}{"topology": "node", "maxSkew": int64(2)}},
+		"antiAffinity": "required",
+	}
+	tmpl := desiredTemplate(item, spec)
+	if tmpl.hash() == before {
+		t.Error("placement did not change the template hash")
+	}
+	pod := desiredPod(item, tmpl)
+
+	spread := pod.Spec.TopologySpreadConstraints
+	if len(spread) != 2 {
+		t.Fatalf("topology spread constraints = %+v", spread)
+	}
+	if spread[0].TopologyKey != corev1.LabelTopologyZone || spread[0].MaxSkew != 1 || spread[0].WhenUnsatisfiable != corev1.DoNotSchedule {
+		t.Errorf("zone spread = %+v", spread[0])
+	}
+	if spread[1].TopologyKey != corev1.LabelHostname || spread[1].MaxSkew != 2 || spread[1].WhenUnsatisfiable != corev1.ScheduleAnyway {
+		t.Errorf("node spread = %+v", spread[1])
+	}
+	if spread[0].LabelSelector.MatchLabels[labelEtherealPod] != "ghost" {
+		t.Errorf("spread selector = %v", spread[0].LabelSelector)
+	}
+	anti := pod.Spec.Affinity.PodAntiAffinity
+	if anti == nil || len(anti.RequiredDuringSchedulingIgnoredDuringExecution) != 1 || anti.RequiredDuringSchedulingIgnoredDuringExecution[0].TopologyKey != corev1.LabelHostname {
+		t.Errorf("anti-affinity = %+v", anti)
+	}
+
+	// בלי spec.placement הפוד נשאר כמו קודם, כדי ששדרוג לא יחליף פודים
+	delete(spec, "placement")
+	if tmpl := desiredTemplate(item, spec); tmpl.hash() != before || desiredPod(item, tmpl).Spec.Affinity != nil {
+		t.Error("a pod without spec.placement changed")
+	}
+
+	spec["placement"] = map[string]interface{}{"spread": []interface{}{map[string]interface{}{"topology": "rack"}}}
+	if _, err := parsePlacement(spec); err == nil {
+		t.Error("unknown topology was accepted")
+	}
+}
+
+func TestResurrectionAvoidsTheFailedNode(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1"})
+	c.settle(t)
+
+	// ה-kubelet פינה את הפוד בגלל לחץ זיכרון על node-1
+	pod := c.pods(t)[0]
+	failPod(&pod, "Error", 1)
+	pod.Spec.NodeName, pod.Status.Reason = "node-1", "Evicted"
+	if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), &pod, "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	item := c.item(t)
+	queue := reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+	if len(queue) != 1 {
+		t.Fatalf("queued %d resurrections, want 1", len(queue))
+	}
+	affinity := desiredPod(item, queue[0].template).Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil {
+		t.Fatalf("replacement has no node affinity: %+v", affinity)
+	}
+	term := affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchFields[0]
+	if term.Operator != corev1.NodeSelectorOpNotIn || term.Values[0] != "node-1" {
+		t.Errorf("node affinity = %+v, want to prefer nodes other than node-1", term)
+	}
+	if node, _, _ := unstructured.NestedString(c.item(t).Object, "status", "healing", "failedNode"); node != "node-1" {
+		t.Errorf("status.healing.failedNode = %q", node)
+	}
+}
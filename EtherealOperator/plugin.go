@@ -0,0 +1,652 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// pluginName - כשהבינארי מותקן (או מקושר) בשם הזה ב-PATH, kubectl מריץ אותו כ-kubectl ethereal
+const pluginName = "kubectl-ethereal"
+
+const pluginUsage = `Usage: kubectl ethereal <command> <name> [flags]
+
+Commands:
+  status <name>                 health, replicas, resurrections, last failure and owned objects
+  history <name>                healing records, oldest first (--limit N)
+  pause <name>                  stop healing, rollouts and deletions until resume
+  resume <name>                 resume a paused EtherealPod
+  resurrect <name> [--now]      replace a pod (--pod, default the oldest); --now starts the new pod first
+  restart <name>                gracefully replace all pods once, as a rollout (sets sunday.com/restartedAt)
+  logs <name> [--previous]      logs of the live pods, or with --previous the captured post-mortems
+  diff <name>                   the pod the operator would create against the live pods
+
+Flags:
+  -n, --namespace               namespace of the EtherealPod (default: the kubeconfig context)
+`
+
+// errDiffFound - כמו kubectl diff, קוד יציאה 1 כשיש הבדלים, בלי הודעת שגיאה
+var errDiffFound = errors.New("differences found")
+
+type pluginEnv struct {
+	ctx       context.Context
+	client    kubernetes.Interface
+	dyn       dynamic.Interface
+	namespace string
+	out       io.Writer
+}
+
+var pluginCommands = map[string]func(p *pluginEnv, args []string) error{
+	"status":    pluginStatus,
+	"history":   pluginHistory,
+	"pause":     func(p *pluginEnv, args []string) error { return pluginSetPaused(p, args, true) },
+	"resume":    func(p *pluginEnv, args []string) error { return pluginSetPaused(p, args, false) },
+	"resurrect": pluginResurrect,
+	"restart":   pluginRestart,
+	"logs":      pluginLogs,
+	"diff":      pluginDiff,
+}
+
+// runPlugin מריצה פקודה של kubectl ethereal ומחזירה קוד יציאה
+func runPlugin(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, pluginUsage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	run, ok := pluginCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], pluginUsage)
+		return 2
+	}
+
+	p := &pluginEnv{ctx: context.Background(), out: os.Stdout}
+	err := run(p, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errDiffFound):
+		return 1
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+}
+
+// flags מחזירה FlagSet של פקודה עם -n/--namespace
+func (p *pluginEnv) flags(command string) *flag.FlagSet {
+	fs := flag.NewFlagSet(pluginName+" "+command, flag.ContinueOnError)
+	fs.StringVar(&p.namespace, "n", "", "namespace")
+	fs.StringVar(&p.namespace, "namespace", "", "namespace")
+	return fs
+}
+
+// parse קוראת את הדגלים (גם אחרי השם, כמו ב-kubectl), מחזירה את שם ה-EtherealPod ומתחברת לקלאסטר
+func (p *pluginEnv) parse(fs *flag.FlagSet, args []string) (string, error) {
+	var names []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		names = append(names, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(names) != 1 {
+		return "", fmt.Errorf("%s expects exactly one EtherealPod name", fs.Name())
+	}
+
+	// clients שכבר קיימים (בבדיקות) נשארים
+	if p.client == nil {
+		config, _, err := loadKubeConfig()
+		if err != nil {
+			return "", fmt.Errorf("could not load Kubernetes config: %w", err)
+		}
+		if p.client, err = kubernetes.NewForConfig(config); err != nil {
+			return "", err
+		}
+		if p.dyn, err = dynamic.NewForConfig(config); err != nil {
+			return "", err
+		}
+	}
+	if p.namespace == "" {
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+		if namespace, _, err := loader.Namespace(); err == nil && namespace != "" {
+			p.namespace = namespace
+		} else {
+			p.namespace = metav1.NamespaceDefault
+		}
+	}
+	return names[0], nil
+}
+
+func (p *pluginEnv) get(name string) (unstructured.Unstructured, error) {
+	item, err := p.dyn.Resource(gvr).Namespace(p.namespace).Get(p.ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	return *item, nil
+}
+
+func pluginStatus(p *pluginEnv, args []string) error {
+	name, err := p.parse(p.flags("status"), args)
+	if err != nil {
+		return err
+	}
+	item, err := p.get(name)
+	if err != nil {
+		return err
+	}
+	spec, _, _ := unstructured.NestedMap(item.Object, "spec")
+	status, _, _ := unstructured.NestedMap(item.Object, "status")
+	str := func(fields ...string) string {
+		v, _, _ := unstructured.NestedString(status, fields...)
+		return v
+	}
+	num := func(fields ...string) int64 {
+		v, _, _ := unstructured.NestedInt64(status, fields...)
+		return v
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", item.GetName())
+	fmt.Fprintf(w, "Namespace:\t%s\n", item.GetNamespace())
+	image, _, _ := unstructured.NestedString(spec, "image")
+	fmt.Fprintf(w, "Image:\t%s\n", image)
+
+	conditions, _, _ := unstructured.NestedSlice(status, "conditions")
+	if len(conditions) == 0 {
+		fmt.Fprintf(w, "Health:\tunknown (not reconciled yet)\n")
+	}
+	for i, c := range conditions {
+		m, _ := c.(map[string]interface{})
+		label := ""
+		if i == 0 {
+			label = "Health:"
+		}
+		fmt.Fprintf(w, "%s\t%v=%v (%v) %v\n", label, m["type"], m["status"], m["reason"], m["message"])
+	}
+
+	fmt.Fprintf(w, "Replicas:\t%d desired, %d ready, %d available, %d updated\n",
+		desiredReplicas(spec), num("readyReplicas"), num("availableReplicas"), num("updatedReplicas"))
+	paused, _, _ := unstructured.NestedBool(spec, "paused")
+	fmt.Fprintf(w, "Paused:\t%t\n", paused)
+	if waiting := str("waitingReason"); waiting != "" {
+		fmt.Fprintf(w, "Waiting:\t%s\n", waiting)
+	}
+	if policy := str("healingPolicy"); policy != "" {
+		fmt.Fprintf(w, "Policy:\t%s\n", policy)
+	}
+
+	resurrections := fmt.Sprintf("%d", num("resurrections"))
+	if last := str("healing", "lastResurrection"); last != "" {
+		resurrections += fmt.Sprintf(" (%d in a row, last %s ago)", num("healing", "consecutive"), since(last))
+	}
+	fmt.Fprintf(w, "Resurrections:\t%s\n", resurrections)
+	if blocked := str("healing", "blockedReason"); blocked != "" {
+		fmt.Fprintf(w, "Blocked:\t%s\n", blocked)
+	}
+
+	if pm, found, _ := unstructured.NestedMap(status, "lastPostMortem"); found {
+		exitCode, _, _ := unstructured.NestedInt64(pm, "exitCode")
+		fmt.Fprintf(w, "Last failure:\t%v %v (exit code %d), %s ago\n", pm["pod"], pm["reason"], exitCode, since(fmt.Sprint(pm["capturedAt"])))
+		fmt.Fprintf(w, "\tkubectl ethereal logs %s --previous -n %s\n", item.GetName(), item.GetNamespace())
+	} else {
+		fmt.Fprintf(w, "Last failure:\tnone captured\n")
+	}
+	w.Flush()
+
+	fmt.Fprintln(p.out, "\nOwned objects:")
+	w = tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  KIND\tNAME\tSTATUS\tAGE")
+	pods, err := listManagedPods(p.ctx, p.client, item)
+	if err != nil {
+		return err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp) })
+	for i := range pods {
+		pod := &pods[i]
+		state := string(pod.Status.Phase)
+		if podReady(pod) {
+			state += ", Ready"
+		}
+		fmt.Fprintf(w, "  Pod\t%s\t%s\t%s\n", pod.Name, state, since(pod.CreationTimestamp.UTC().Format(time.RFC3339)))
+	}
+
+	cm, err := p.client.CoreV1().ConfigMaps(item.GetNamespace()).Get(p.ctx, postMortemConfigMapName(item.GetName()), metav1.GetOptions{})
+	if err == nil {
+		fmt.Fprintf(w, "  ConfigMap\t%s\t%d post-mortems\t%s\n", cm.Name, len(managedPostMortems(cm)), since(cm.CreationTimestamp.UTC().Format(time.RFC3339)))
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	records, err := p.healingRecords(item)
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		fmt.Fprintf(w, "  HealingRecord\t%s-*\t%d records\t\n", item.GetName(), len(records))
+	}
+	return w.Flush()
+}
+
+// healingRecords מחזירה את הרשומות של EtherealPod לפי זמן ההתחלה
+func (p *pluginEnv) healingRecords(item unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	list, err := p.dyn.Resource(healingRecordGVR).Namespace(item.GetNamespace()).List(p.ctx, metav1.ListOptions{LabelSelector: labelEtherealPod + "=" + item.GetName()})
+	if err != nil {
+		return nil, err
+	}
+	records := list.Items
+	startedAt := func(r unstructured.Unstructured) string {
+		v, _, _ := unstructured.NestedString(r.Object, "spec", "startedAt")
+		return v
+	}
+	sort.SliceStable(records, func(i, j int) bool { return startedAt(records[i]) < startedAt(records[j]) })
+	return records, nil
+}
+
+func pluginHistory(p *pluginEnv, args []string) error {
+	fs := p.flags("history")
+	limit := fs.Int("limit", 20, "show only the newest N records, 0 for all")
+	name, err := p.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	item, err := p.get(name)
+	if err != nil {
+		return err
+	}
+	records, err := p.healingRecords(item)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(p.out, "No healing records for %s/%s\n", item.GetNamespace(), item.GetName())
+		return nil
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tTRIGGER\tREASON\tOUTCOME\tOLD POD\tNEW POD\tDURATION\tMESSAGE")
+	for _, r := range records {
+		s, _, _ := unstructured.NestedMap(r.Object, "spec")
+		field := func(fields ...string) string {
+			v, _, _ := unstructured.NestedString(s, fields...)
+			if v == "" {
+				return "-"
+			}
+			return v
+		}
+		duration, _, _ := unstructured.NestedFieldNoCopy(s, "durationSeconds")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%vs\t%s\n", field("startedAt"), field("trigger"), field("reason"), field("outcome"),
+			field("oldPod", "name"), field("newPod", "name"), duration, field("message"))
+	}
+	return w.Flush()
+}
+
+func pluginSetPaused(p *pluginEnv, args []string, paused bool) error {
+	command := "resume"
+	var value interface{}
+	if paused {
+		command, value = "pause", true
+	}
+	name, err := p.parse(p.flags(command), args)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"paused": value}})
+	if _, err := p.dyn.Resource(gvr).Namespace(p.namespace).Patch(p.ctx, name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "etherealpod.sunday.com/%s %sd\n", name, command)
+	return nil
+}
+
+func pluginResurrect(p *pluginEnv, args []string) error {
+	fs := p.flags("resurrect")
+	now := fs.Bool("now", false, "start the replacement first, then retire the pod (recorded as Manual)")
+	podName := fs.String("pod", "", "pod to replace (default: the oldest)")
+	name, err := p.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	item, err := p.get(name)
+	if err != nil {
+		return err
+	}
+	pods, err := listManagedPods(p.ctx, p.client, item)
+	if err != nil {
+		return err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp) })
+
+	var target *corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && (*podName == "" || pods[i].Name == *podName) {
+			target = &pods[i]
+			break
+		}
+	}
+	if target == nil {
+		if *podName != "" {
+			return fmt.Errorf("pod %s is not managed by %s", *podName, name)
+		}
+		return fmt.Errorf("%s has no pods to replace", name)
+	}
+
+	paused, _, _ := unstructured.NestedBool(item.Object, "spec", "paused")
+	if *now {
+		// האופרטור מקים חלופה לפני שהפוד יוצא, והרשומה היא Manual ולא Deleted
+		data, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{annotationReplace: time.Now().UTC().Format(time.RFC3339)}}})
+		if _, err := p.client.CoreV1().Pods(target.Namespace).Patch(p.ctx, target.Name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "pod/%s marked for replacement, %s will start a new pod before retiring it\n", target.Name, name)
+		if paused {
+			fmt.Fprintf(p.out, "warning: %s is paused, the pod will not be replaced until resume\n", name)
+		}
+		return nil
+	}
+
+	// המחיקה עצמה היא הטריגר: האופרטור רואה פוד חסר ומקים חדש לפי המדיניות
+	if err := p.client.CoreV1().Pods(target.Namespace).Delete(p.ctx, target.Name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "pod/%s deleted, %s will resurrect it\n", target.Name, name)
+	if paused {
+		fmt.Fprintf(p.out, "warning: %s is paused, the pod will not be replaced until resume\n", name)
+	}
+	return nil
+}
+
+func pluginRestart(p *pluginEnv, args []string) error {
+	name, err := p.parse(p.flags("restart"), args)
+	if err != nil {
+		return err
+	}
+	at := time.Now().UTC().Format(time.RFC3339)
+	data, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{annotationRestartedAt: at}}})
+	if _, err := p.dyn.Resource(gvr).Namespace(p.namespace).Patch(p.ctx, name, types.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "etherealpod.sunday.com/%s restarted\n", name)
+	return nil
+}
+
+func pluginLogs(p *pluginEnv, args []string) error {
+	fs := p.flags("logs")
+	previous := fs.Bool("previous", false, "print the captured post-mortems instead of the live logs")
+	all := fs.Bool("all", false, "with --previous, print every kept post-mortem, not only the latest")
+	podName := fs.String("pod", "", "only this pod")
+	name, err := p.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	item, err := p.get(name)
+	if err != nil {
+		return err
+	}
+
+	if !*previous {
+		pods, err := listManagedPods(p.ctx, p.client, item)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			if *podName != "" && pod.Name != *podName {
+				continue
+			}
+			raw, err := p.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Do(p.ctx).Raw()
+			if err != nil {
+				return fmt.Errorf("logs of %s: %w", pod.Name, err)
+			}
+			fmt.Fprintf(p.out, "==> pod/%s <==\n%s\n", pod.Name, raw)
+		}
+		return nil
+	}
+
+	cm, err := p.client.CoreV1().ConfigMaps(item.GetNamespace()).Get(p.ctx, postMortemConfigMapName(item.GetName()), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("no post-mortems were captured for %s", name)
+	} else if err != nil {
+		return err
+	}
+	reports := managedPostMortems(cm)
+	keys := make([]string, 0, len(reports))
+	for k := range reports {
+		keys = append(keys, k)
+	}
+	// המפתחות ממוינים כרונולוגית; מציגים מהחדש לישן
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	printed := 0
+	for _, k := range keys {
+		var report postMortem
+		if err := json.Unmarshal([]byte(reports[k]), &report); err != nil {
+			return fmt.Errorf("post-mortem %s: %w", k, err)
+		}
+		if *podName != "" && report.Pod != *podName {
+			continue
+		}
+		printPostMortem(p.out, report)
+		printed++
+		if !*all {
+			break
+		}
+	}
+	if printed == 0 {
+		return fmt.Errorf("no post-mortem of pod %s", *podName)
+	}
+	return nil
+}
+
+func printPostMortem(out io.Writer, report postMortem) {
+	fmt.Fprintf(out, "==> pod/%s (%s, captured %s) <==\n", report.Pod, report.Phase, report.CapturedAt.Format(time.RFC3339))
+	for _, c := range report.Containers {
+		fmt.Fprintf(out, "--- container %s: %s, exit code %d, %d restarts\n", c.Name, c.Reason, c.ExitCode, c.RestartCount)
+		if c.Message != "" {
+			fmt.Fprintf(out, "%s\n", c.Message)
+		}
+		fmt.Fprint(out, c.Logs)
+		if c.Logs != "" && !strings.HasSuffix(c.Logs, "\n") {
+			fmt.Fprintln(out)
+		}
+	}
+	for _, e := range report.Events {
+		fmt.Fprintf(out, "--- event %s %s %s (x%d): %s\n", e.LastSeen.Format(time.RFC3339), e.Type, e.Reason, e.Count, e.Message)
+	}
+}
+
+func pluginDiff(p *pluginEnv, args []string) error {
+	name, err := p.parse(p.flags("diff"), args)
+	if err != nil {
+		return err
+	}
+	item, err := p.get(name)
+	if err != nil {
+		return err
+	}
+	spec, _, _ := unstructured.NestedMap(item.Object, "spec")
+	tmpl := applyRollback(item, desiredTemplate(item, spec))
+	if tmpl.configHash, err = computeConfigHash(p.ctx, p.client, item.GetNamespace(), tmpl); err != nil {
+		return err
+	}
+	pods, err := listManagedPods(p.ctx, p.client, item)
+	if err != nil {
+		return err
+	}
+
+	desired := desiredPod(item, tmpl)
+	desired.Namespace = item.GetNamespace()
+	if len(pods) == 0 {
+		data, err := podYAML(desired, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "%s has no live pods; the operator would create:\n%s", name, data)
+		return nil
+	}
+
+	different := false
+	for i := range pods {
+		live := &pods[i]
+		desired.GenerateName, desired.Name = "", live.Name
+		want, err := podYAML(desired, nil)
+		if err != nil {
+			return err
+		}
+		got, err := podYAML(live, desired)
+		if err != nil {
+			return err
+		}
+		lines := lineDiff(strings.Split(want, "\n"), strings.Split(got, "\n"))
+		if lines == nil {
+			continue
+		}
+		different = true
+		fmt.Fprintf(p.out, "--- desired/%s\n+++ live/%s\n%s\n", live.Name, live.Name, strings.Join(lines, "\n"))
+	}
+	if !different {
+		fmt.Fprintf(p.out, "All %d pods of %s match the desired pod\n", len(pods), name)
+		return nil
+	}
+	return errDiffFound
+}
+
+// podYAML מחזירה פוד כ-YAML. עם desired, רק השדות שהאופרטור קובע - שדות שה-API server,
+// ה-scheduler או sidecar injectors הוסיפו לא נחשבים הבדל
+func podYAML(pod *corev1.Pod, desired *corev1.Pod) (string, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return "", err
+	}
+	delete(obj, "status")
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+
+	if desired != nil {
+		shape, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+		if err != nil {
+			return "", err
+		}
+		obj = projectOnto(obj, shape).(map[string]interface{})
+	}
+	data, err := yaml.Marshal(obj)
+	return string(data), err
+}
+
+// projectOnto משאירה מ-live רק מפתחות שקיימים ב-shape. רשימות מושוות לפי מיקום
+func projectOnto(live, shape interface{}) interface{} {
+	switch s := shape.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		out := map[string]interface{}{}
+		for k, v := range s {
+			if lv, found := l[k]; found {
+				out[k] = projectOnto(lv, v)
+			}
+		}
+		return out
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		out := make([]interface{}, 0, len(l))
+		for i, v := range l {
+			if i < len(s) {
+				v = projectOnto(v, s[i])
+			}
+			out = append(out, v)
+		}
+		return out
+	default:
+		return live
+	}
+}
+
+// lineDiff מחזירה diff של שורות (LCS) עם " ", "-" ו-"+", או nil כשהן זהות
+func lineDiff(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i, changed = i+1, true
+		default:
+			out = append(out, "+"+b[j])
+			j, changed = j+1, true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return out
+}
+
+// since מחזירה כמה זמן עבר מזמן בפורמט RFC3339, בעיגול כמו ב-kubectl get
+func since(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "?"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
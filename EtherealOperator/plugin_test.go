@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLineDiff(t *testing.T) {
+	if got := lineDiff([]string{"a", "b"}, []string{"a", "b"}); got != nil {
+		t.Errorf("identical lines gave %q", got)
+	}
+	got := strings.Join(lineDiff([]string{"a", "b", "c"}, []string{"a", "x", "c"}), "|")
+	if got != " a|-b|+x| c" {
+		t.Errorf("diff = %q", got)
+	}
+}
+
+func TestDiffIgnoresFieldsTheOperatorDoesNotSet(t *testing.T) {
+	item := unstructured.Unstructured{}
+	item.SetNamespace("default")
+	item.SetName("ghost")
+	desired := desiredPod(item, podTemplate{image: "sunday-app:v2"})
+	desired.GenerateName, desired.Name = "", "real-ghost-abcde"
+
+	// פוד חי עם ערכי ברירת מחדל של ה-API server, label ו-sidecar שהוזרקו.
+	// קונטיינר נוסף כן מוצג, כדי שיהיה ברור למה הפוד שונה
+	live := desired.DeepCopy()
+	live.Labels["injected"] = "true"
+	live.Spec.NodeName = "node-1"
+	live.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	live.Spec.Containers = append(live.Spec.Containers, corev1.Container{Name: "sidecar", Image: "envoy"})
+	want, _ := podYAML(desired, nil)
+	got, _ := podYAML(live, desired)
+	if lines := lineDiff(strings.Split(want, "\n"), strings.Split(got, "\n")); len(lines) == 0 || !strings.Contains(strings.Join(lines, "\n"), "+  - image: envoy") {
+		t.Errorf("expected the injected container in the diff, got %q", lines)
+	}
+
+	live.Spec.Containers = live.Spec.Containers[:1]
+	got, _ = podYAML(live, desired)
+	if lines := lineDiff(strings.Split(want, "\n"), strings.Split(got, "\n")); lines != nil {
+		t.Errorf("server defaults showed up as a diff:\n%s", strings.Join(lines, "\n"))
+	}
+
+	live.Spec.Containers[0].Image = "sunday-app:v1"
+	got, _ = podYAML(live, desired)
+	if lines := lineDiff(strings.Split(want, "\n"), strings.Split(got, "\n")); !strings.Contains(strings.Join(lines, "\n"), "+  - image: sunday-app:v1") {
+		t.Errorf("image change missing from diff: %q", lines)
+	}
+}
+
+// resurrect --now לא מוחק: החלופה עולה קודם, הפוד יוצא אחריה, והרשומה היא Manual
+func TestResurrectNowReplacesFirst(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1"})
+	c.settle(t)
+	old := c.pods(t)[0]
+
+	var out bytes.Buffer
+	p := &pluginEnv{ctx: context.Background(), client: c.client, dyn: c.dyn, out: &out}
+	if err := pluginResurrect(p, []string{"ghost", "--now", "-n", "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.deleted()) != 0 {
+		t.Fatalf("resurrect --now deleted %v itself", c.deleted())
+	}
+
+	c.settle(t)
+	c.settle(t)
+	pods := c.pods(t)
+	if len(pods) != 1 || pods[0].Name == old.Name || pods[0].Annotations[annotationReplace] != "" {
+		t.Fatalf("pods after the replacement: %d, want one new pod instead of %s", len(pods), old.Name)
+	}
+
+	records, err := c.dyn.Resource(healingRecordGVR).Namespace("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records.Items {
+		if name, _, _ := unstructured.NestedString(rec.Object, "spec", "oldPod", "name"); name != old.Name {
+			continue
+		}
+		trigger, _, _ := unstructured.NestedString(rec.Object, "spec", "trigger")
+		outcome, _, _ := unstructured.NestedString(rec.Object, "spec", "outcome")
+		if trigger != triggerManual || outcome != outcomeReplaced {
+			t.Errorf("record for %s: trigger %q, outcome %q, want Manual and Replaced", old.Name, trigger, outcome)
+		}
+		return
+	}
+	t.Fatalf("no HealingRecord for %s", old.Name)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var healingPolicyGVR = schema.GroupVersionResource{
+	Group:    "sunday.com",
+	Version:  "v1",
+	Resource: "healingpolicies",
+}
+
+var clusterHealingPolicyGVR = schema.GroupVersionResource{
+	Group:    "sunday.com",
+	Version:  "v1",
+	Resource: "clusterhealingpolicies",
+}
+
+const (
+	kindHealingPolicy        = "HealingPolicy"
+	kindClusterHealingPolicy = "ClusterHealingPolicy"
+)
+
+// healingPolicy היא הגרסה המפוענחת של HealingPolicy או ClusterHealingPolicy
+type healingPolicy struct {
+	kind      string
+	namespace string
+	name      string
+	priority  int64
+	selector  labels.Selector
+
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	budgetMax      int
+	budgetWindow   time.Duration
+	pauseWindows   []pauseWindow
+	gracePeriod    *int64
+	healOn         []string
+	// recycleDegraded - להחליף פוד שמדווח Degraded ברציפות לפחות degradedFor
+	recycleDegraded bool
+	degradedFor     time.Duration
+	// notifications - sinks שמקבלים הודעות על ה-EtherealPods שהמדיניות מנהלת
+	notifications *notificationConfig
+
+	// governed מתמלא במהלך הסבב - אילו EtherealPods המדיניות מנהלת כרגע;
+	// reported הוא מה שכבר כתוב ב-status שלה
+	governed []string
+	reported []string
+}
+
+// pauseWindow היא חלון זמן יומי שבו הריפוי מושהה, למשל 20:00-06:00 בימי שישי
+type pauseWindow struct {
+	start, end time.Duration
+	days       map[time.Weekday]bool
+	location   *time.Location
+}
+
+// ref מזהה את המדיניות כפי שהיא מופיעה ב-status של EtherealPod
+func (p *healingPolicy) ref() string {
+	if p.kind == kindClusterHealingPolicy {
+		return p.kind + "/" + p.name
+	}
+	return p.kind + "/" + p.namespace + "/" + p.name
+}
+
+// loadHealingPolicies טוענת את כל המדיניות בקלאסטר; אם ה-CRD לא מותקן פשוט אין מדיניות
+func loadHealingPolicies(ctx context.Context, dyn dynamic.Interface) []*healingPolicy {
+	var policies []*healingPolicy
+
+	for _, src := range []struct {
+		gvr  schema.GroupVersionResource
+		kind string
+	}{
+		{healingPolicyGVR, kindHealingPolicy},
+		{clusterHealingPolicyGVR, kindClusterHealingPolicy},
+	} {
+		list, err := dyn.Resource(src.gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Debug("Could not list healing policies", "kind", src.kind, "error", err)
+			continue
+		}
+		for _, obj := range list.Items {
+			p, err := parseHealingPolicy(src.kind, obj)
+			if err != nil {
+				slog.Warn("Ignoring invalid healing policy", "kind", src.kind, "namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+				continue
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+func parseHealingPolicy(kind string, obj unstructured.Unstructured) (*healingPolicy, error) {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	p := &healingPolicy{kind: kind, namespace: obj.GetNamespace(), name: obj.GetName()}
+
+	p.priority, _, _ = unstructured.NestedInt64(spec, "priority")
+	p.reported, _, _ = unstructured.NestedStringSlice(obj.Object, "status", "governed")
+
+	if sel, found, _ := unstructured.NestedMap(spec, "selector"); found {
+		var ls metav1.LabelSelector
+		if err := fromUnstructured(sel, &ls); err != nil {
+			return nil, fmt.Errorf("selector: %w", err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&ls)
+		if err != nil {
+			return nil, fmt.Errorf("selector: %w", err)
+		}
+		p.selector = selector
+	}
+
+	if v, found, _ := unstructured.NestedInt64(spec, "backoff", "initialSeconds"); found {
+		p.backoffInitial = time.Duration(v) * time.Second
+	}
+	if v, found, _ := unstructured.NestedInt64(spec, "backoff", "maxSeconds"); found {
+		p.backoffMax = time.Duration(v) * time.Second
+	}
+	if p.backoffMax < p.backoffInitial {
+		p.backoffMax = p.backoffInitial
+	}
+
+	if v, found, _ := unstructured.NestedInt64(spec, "budget", "maxResurrections"); found {
+		p.budgetMax = int(v)
+		p.budgetWindow = time.Hour
+		if w, found, _ := unstructured.NestedInt64(spec, "budget", "windowMinutes"); found && w > 0 {
+			p.budgetWindow = time.Duration(w) * time.Minute
+		}
+	}
+
+	if v, found, _ := unstructured.NestedInt64(spec, "gracePeriodSeconds"); found {
+		p.gracePeriod = &v
+	}
+
+	p.healOn, _, _ = unstructured.NestedStringSlice(spec, "healOn")
+
+	if action, _, _ := unstructured.NestedString(spec, "degradation", "action"); action == "Recycle" {
+		p.recycleDegraded = true
+		p.degradedFor = time.Minute
+		if v, found, _ := unstructured.NestedInt64(spec, "degradation", "afterSeconds"); found && v >= 0 {
+			p.degradedFor = time.Duration(v) * time.Second
+		}
+	}
+
+	if m, found, _ := unstructured.NestedMap(spec, "notifications"); found {
+		c, err := parseNotificationConfig(m, p.namespace)
+		if err != nil {
+			return nil, fmt.Errorf("notifications: %w", err)
+		}
+		p.notifications = c
+	}
+
+	windows, _, _ := unstructured.NestedSlice(spec, "pauseWindows")
+	for i, w := range windows {
+		m, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pw, err := parsePauseWindow(m)
+		if err != nil {
+			return nil, fmt.Errorf("pauseWindows[%d]: %w", i, err)
+		}
+		p.pauseWindows = append(p.pauseWindows, pw)
+	}
+
+	return p, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parsePauseWindow(m map[string]interface{}) (pauseWindow, error) {
+	var pw pauseWindow
+	var err error
+
+	start, _, _ := unstructured.NestedString(m, "start")
+	end, _, _ := unstructured.NestedString(m, "end")
+	if pw.start, err = parseClock(start); err != nil {
+		return pw, fmt.Errorf("start: %w", err)
+	}
+	if pw.end, err = parseClock(end); err != nil {
+		return pw, fmt.Errorf("end: %w", err)
+	}
+
+	pw.location = time.UTC
+	if tz, found, _ := unstructured.NestedString(m, "timeZone"); found && tz != "" {
+		if pw.location, err = time.LoadLocation(tz); err != nil {
+			return pw, fmt.Errorf("timeZone: %w", err)
+		}
+	}
+
+	days, _, _ := unstructured.NestedStringSlice(m, "days")
+	if len(days) > 0 {
+		pw.days = map[time.Weekday]bool{}
+		for _, d := range days {
+			wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+			if !ok {
+				return pw, fmt.Errorf("unknown day %q", d)
+			}
+			pw.days[wd] = true
+		}
+	}
+	return pw, nil
+}
+
+// parseClock ממירה "HH:MM" למשך הזמן מתחילת היום
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// active בודקת אם now נמצא בתוך החלון. חלון שחוצה חצות (20:00-06:00) שייך ליום שבו הוא התחיל
+func (w pauseWindow) active(now time.Time) bool {
+	local := now.In(w.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, w.location)
+	clock := local.Sub(midnight)
+
+	dayAllowed := func(d time.Weekday) bool { return w.days == nil || w.days[d] }
+
+	if w.start <= w.end {
+		return dayAllowed(local.Weekday()) && clock >= w.start && clock < w.end
+	}
+	if clock >= w.start {
+		return dayAllowed(local.Weekday())
+	}
+	if clock < w.end {
+		return dayAllowed(midnight.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+func fromUnstructured(obj map[string]interface{}, into interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj, into)
+}
+
+// resolveHealingPolicy בוחרת את המדיניות שחלה על EtherealPod לפי סדר הקדימות:
+//  1. spec.healingPolicyRef - HealingPolicy באותו namespace, ואחריה ClusterHealingPolicy באותו שם
+//  2. HealingPolicy באותו namespace שה-selector שלה תואם את הלייבלים
+//  3. ClusterHealingPolicy שה-selector שלה תואם
+//
+// בתוך כל שלב מנצחת ה-priority הגבוהה ביותר, ובשוויון - השם הראשון בסדר אלפביתי.
+func resolveHealingPolicy(item unstructured.Unstructured, policies []*healingPolicy) *healingPolicy {
+	if ref, found, _ := unstructured.NestedString(item.Object, "spec", "healingPolicyRef"); found && ref != "" {
+		var cluster *healingPolicy
+		for _, p := range policies {
+			if p.name != ref {
+				continue
+			}
+			if p.kind == kindHealingPolicy && p.namespace == item.GetNamespace() {
+				return p
+			}
+			if p.kind == kindClusterHealingPolicy {
+				cluster = p
+			}
+		}
+		if cluster != nil {
+			return cluster
+		}
+		slog.Warn("Referenced healing policy not found, falling back to selectors", "name", item.GetName(), "healingPolicyRef", ref)
+	}
+
+	itemLabels := labels.Set(item.GetLabels())
+	for _, kind := range []string{kindHealingPolicy, kindClusterHealingPolicy} {
+		var matches []*healingPolicy
+		for _, p := range policies {
+			if p.kind != kind || p.selector == nil || !p.selector.Matches(itemLabels) {
+				continue
+			}
+			if kind == kindHealingPolicy && p.namespace != item.GetNamespace() {
+				continue
+			}
+			matches = append(matches, p)
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].priority != matches[j].priority {
+				return matches[i].priority > matches[j].priority
+			}
+			return matches[i].name < matches[j].name
+		})
+		return matches[0]
+	}
+	return nil
+}
+
+// updatePolicyStatuses כותבת ל-status של כל מדיניות אילו EtherealPods היא מנהלת, רק כשהרשימה השתנתה
+func updatePolicyStatuses(ctx context.Context, dyn dynamic.Interface, policies []*healingPolicy) {
+	for _, p := range policies {
+		sort.Strings(p.governed)
+		if len(p.governed) == 0 && len(p.reported) == 0 || reflect.DeepEqual(p.reported, p.governed) {
+			continue
+		}
+
+		governed := make([]interface{}, 0, len(p.governed))
+		for _, g := range p.governed {
+			governed = append(governed, g)
+		}
+		status := map[string]interface{}{
+			"governed":      governed,
+			"governedCount": int64(len(p.governed)),
+		}
+
+		res := dyn.Resource(healingPolicyGVR).Namespace(p.namespace)
+		if p.kind == kindClusterHealingPolicy {
+			res = dyn.Resource(clusterHealingPolicyGVR).Namespace("")
+		}
+		policy := unstructured.Unstructured{}
+		policy.SetAPIVersion(healingPolicyGVR.GroupVersion().String())
+		policy.SetKind(p.kind)
+		policy.SetNamespace(p.namespace)
+		policy.SetName(p.name)
+		if err := applyStatusOf(ctx, res, policy, status); err != nil {
+			slog.Warn("Failed to update healing policy status", "policy", p.ref(), "error", err)
+		}
+	}
+}
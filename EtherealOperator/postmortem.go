@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultPostMortemTailLines = 100
+	defaultPostMortemKeep      = 5
+
+	// מגבלה לכל דוח, כדי ש-keep דוחות ייכנסו בבטחה ב-ConfigMap (מקסימום 1MiB)
+	postMortemLogLimitBytes = 64 * 1024
+	maxPostMortemKeep       = 10
+)
+
+// postMortem הוא הדוח שנשמר לפני שהאופרטור מוחק פוד שקרס
+type postMortem struct {
+	Pod        string                `json:"pod"`
+	UID        string                `json:"uid"`
+	Node       string                `json:"node,omitempty"`
+	Phase      string                `json:"phase"`
+	Reason     string                `json:"reason,omitempty"`
+	CapturedAt time.Time             `json:"capturedAt"`
+	Containers []containerPostMortem `json:"containers"`
+	Events     []eventSummary        `json:"events,omitempty"`
+}
+
+type containerPostMortem struct {
+	Name         string     `json:"name"`
+	RestartCount int32      `json:"restartCount"`
+	ExitCode     int32      `json:"exitCode"`
+	Signal       int32      `json:"signal,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+	Message      string     `json:"message,omitempty"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+	Logs         string     `json:"logs,omitempty"`
+}
+
+type eventSummary struct {
+	Type     string    `json:"type"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// postMortemSettings קוראת את spec.postMortem עם ברירות מחדל
+func postMortemSettings(spec map[string]interface{}) (tailLines int64, keep int) {
+	tailLines, keep = defaultPostMortemTailLines, defaultPostMortemKeep
+
+	if v, found, _ := unstructured.NestedInt64(spec, "postMortem", "tailLines"); found && v > 0 {
+		tailLines = v
+	}
+	if v, found, _ := unstructured.NestedInt64(spec, "postMortem", "keep"); found && v > 0 {
+		keep = int(v)
+	}
+	if keep > maxPostMortemKeep {
+		keep = maxPostMortemKeep
+	}
+	return tailLines, keep
+}
+
+// postMortemConfigMapName מחזירה את שם ה-ConfigMap שמחזיק את הדוחות של EtherealPod
+func postMortemConfigMapName(name string) string {
+	return "postmortem-" + name
+}
+
+// terminationState מחזירה את מצב הסיום האחרון של הקונטיינר (הנוכחי או הקודם)
+func terminationState(status corev1.ContainerStatus) *corev1.ContainerStateTerminated {
+	if status.State.Terminated != nil {
+		return status.State.Terminated
+	}
+	return status.LastTerminationState.Terminated
+}
+
+// capturePostMortem אוספת לוגים, מצב סיום ו-Events של פוד שקרס ושומרת אותם
+// ב-ConfigMap מסובב לפני שהאופרטור מחליף את הפוד
+func capturePostMortem(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, pod *corev1.Pod, tailLines int64, keep int) (string, *postMortem, error) {
+	report := &postMortem{
+		Pod:        pod.Name,
+		UID:        string(pod.UID),
+		Node:       pod.Spec.NodeName,
+		Phase:      string(pod.Status.Phase),
+		Reason:     pod.Status.Reason,
+		CapturedAt: time.Now().UTC(),
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		c := containerPostMortem{Name: cs.Name, RestartCount: cs.RestartCount}
+		if term := terminationState(cs); term != nil {
+			c.ExitCode = term.ExitCode
+			c.Signal = term.Signal
+			c.Reason = term.Reason
+			c.Message = term.Message
+			if !term.StartedAt.IsZero() {
+				t := term.StartedAt.UTC()
+				c.StartedAt = &t
+			}
+			if !term.FinishedAt.IsZero() {
+				t := term.FinishedAt.UTC()
+				c.FinishedAt = &t
+			}
+		}
+		c.Logs = containerLogs(ctx, client, pod, cs.Name, tailLines)
+		report.Containers = append(report.Containers, c)
+	}
+
+	events, err := client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + pod.Name,
+	})
+	if err != nil {
+		slog.Warn("Could not list pod events for post-mortem", "pod", pod.Name, "error", err)
+	} else {
+		for _, e := range events.Items {
+			if e.InvolvedObject.UID != "" && e.InvolvedObject.UID != pod.UID {
+				continue
+			}
+			report.Events = append(report.Events, eventSummary{
+				Type:     e.Type,
+				Reason:   e.Reason,
+				Message:  e.Message,
+				Count:    e.Count,
+				LastSeen: eventTime(e).UTC(),
+			})
+		}
+		sort.Slice(report.Events, func(i, j int) bool {
+			return report.Events[i].LastSeen.Before(report.Events[j].LastSeen)
+		})
+	}
+
+	key, err := storePostMortem(ctx, client, item, report, keep)
+	return key, report, err
+}
+
+// containerLogs מחזירה את N השורות האחרונות; אם הקונטיינר כבר הופעל מחדש, לוקחים את הלוג הקודם
+func containerLogs(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod, container string, tailLines int64) string {
+	limit := int64(postMortemLogLimitBytes)
+	opts := &corev1.PodLogOptions{Container: container, TailLines: &tailLines, LimitBytes: &limit}
+
+	raw, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Do(ctx).Raw()
+	if err != nil {
+		opts.Previous = true
+		raw, err = client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Do(ctx).Raw()
+	}
+	if err != nil {
+		slog.Warn("Could not read container logs for post-mortem", "pod", pod.Name, "container", container, "error", err)
+		return ""
+	}
+	return string(raw)
+}
+
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.FirstTimestamp.Time
+	}
+}
+
+// storePostMortem כותבת את הדוח ל-ConfigMap ומוחקת את הישנים ביותר מעבר ל-keep
+func storePostMortem(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured, report *postMortem, keep int) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// מפתח שממוין כרונולוגית, כך שהסיבוב הוא פשוט מיון של המפתחות
+	key := fmt.Sprintf("%s-%s.json", report.CapturedAt.Format("20060102-150405"), report.Pod)
+
+	cms := client.CoreV1().ConfigMaps(item.GetNamespace())
+	name := postMortemConfigMapName(item.GetName())
+
+	// ה-ConfigMap נכתב ב-apply עם כל המפתחות שנשארים: מפתח שהאופרטור הפסיק לשלוח נמחק,
+	// ומפתחות או labels שכלים אחרים הוסיפו נשארים
+	existing := map[string]string{}
+	cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	if err == nil {
+		existing = managedPostMortems(cm)
+	}
+	existing[key] = string(data)
+
+	keys := make([]string, 0, len(existing))
+	for k := range existing {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for len(keys) > keep {
+		delete(existing, keys[0])
+		keys = keys[1:]
+	}
+
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       item.GetNamespace(),
+			Labels:          map[string]string{"managed-by": "ethereal-operator", "sunday.com/etherealpod": item.GetName()},
+			OwnerReferences: ownerReferences(item, false),
+		},
+		Data: existing,
+	}
+	ac := corev1ac.ConfigMap(name, item.GetNamespace())
+	if err := toApplyConfiguration(desired, ac); err != nil {
+		return "", err
+	}
+	_, err = cms.Apply(ctx, ac, applyOptions("configmaps", item.GetNamespace(), name, "key", key))
+	if err != nil {
+		reportApplyConflict(ctx, client, item, "configmaps", name, err)
+	}
+	return key, err
+}
+
+// managedPostMortems מחזירה רק את המפתחות של הדוחות, בלי מפתחות שכלים אחרים הוסיפו ל-ConfigMap
+func managedPostMortems(cm *corev1.ConfigMap) map[string]string {
+	reports := map[string]string{}
+	for k, v := range cm.Data {
+		if strings.HasSuffix(k, ".json") {
+			reports[k] = v
+		}
+	}
+	return reports
+}
+
+// ownerReference מקשרת אובייקט שהאופרטור יוצר ל-EtherealPod, כך שהוא נמחק יחד איתו
+func ownerReference(item unstructured.Unstructured) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: item.GetAPIVersion(),
+		Kind:       item.GetKind(),
+		Name:       item.GetName(),
+		UID:        item.GetUID(),
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resurrection היא בקשה להקים פוד מחדש, שממתינה בתור עד שהמגביל הגלובלי מאשר אותה
+type resurrection struct {
+	item unstructured.Unstructured
+	// client - הקלאסטר שבו הפוד יוקם (ראו clusters.place)
+	client   kubernetes.Interface
+	policy   *healingPolicy
+	state    healingState
+	reason   string
+	priority int64
+	template podTemplate
+	// rollout - פוד של גרסה חדשה ולא התחייה, ולכן לא נספר במוני הריפוי
+	rollout bool
+}
+
+// resurrectionLimiter מונע סערת ריפוי: token bucket גלובלי ומקסימום פודים שעולים במקביל
+type resurrectionLimiter struct {
+	bucket        *rate.Limiter
+	maxConcurrent int
+}
+
+func newResurrectionLimiter(perSecond float64, burst, maxConcurrent int) *resurrectionLimiter {
+	limit := rate.Limit(perSecond)
+	if perSecond <= 0 {
+		limit = rate.Inf
+	}
+	return &resurrectionLimiter{bucket: rate.NewLimiter(limit, burst), maxConcurrent: maxConcurrent}
+}
+
+func init() {
+	metrics.describe("ethereal_deferred_resurrections", "gauge", "Resurrections deferred by the global rate limiter in the last reconcile tick.")
+	metrics.describe("ethereal_resurrections_in_flight", "gauge", "Managed pods that were created and are not ready yet.")
+	metrics.describe("ethereal_resurrections_total", "counter", "Pods resurrected by the operator.")
+}
+
+// orderResurrections ממיינת לפי spec.priority (גבוה קודם), ובתוך אותה עדיפות
+// משלבת בין namespaces בסבב (round-robin) כדי ש-namespace אחד לא ירעיב את האחרים
+func orderResurrections(queue []resurrection) []resurrection {
+	byPriority := map[int64]map[string][]resurrection{}
+	for _, r := range queue {
+		ns := r.item.GetNamespace()
+		if byPriority[r.priority] == nil {
+			byPriority[r.priority] = map[string][]resurrection{}
+		}
+		byPriority[r.priority][ns] = append(byPriority[r.priority][ns], r)
+	}
+
+	priorities := make([]int64, 0, len(byPriority))
+	for p := range byPriority {
+		priorities = append(priorities, p)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+
+	ordered := make([]resurrection, 0, len(queue))
+	for _, p := range priorities {
+		namespaces := make([]string, 0, len(byPriority[p]))
+		for ns, rs := range byPriority[p] {
+			namespaces = append(namespaces, ns)
+			// בתוך namespace - ה-EtherealPod הוותיק ביותר קודם
+			sort.SliceStable(rs, func(i, j int) bool {
+				a, b := rs[i].item.GetCreationTimestamp(), rs[j].item.GetCreationTimestamp()
+				return a.Before(&b)
+			})
+		}
+		sort.Strings(namespaces)
+
+		for round := 0; ; round++ {
+			added := false
+			for _, ns := range namespaces {
+				if rs := byPriority[p][ns]; round < len(rs) {
+					ordered = append(ordered, rs[round])
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+// inFlight סופרת פודים מנוהלים שעדיין עולים (Pending או Running ולא Ready)
+func inFlight(ctx context.Context, client kubernetes.Interface) (int, error) {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: "managed-by=ethereal-operator"})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		switch pod.Status.Phase {
+		case corev1.PodPending:
+			count++
+		case corev1.PodRunning:
+			if !podReady(&pod) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// dispatch מקימה את הפודים שבתור לפי הסדר, כל עוד יש tokens ומקום להתחיות במקביל.
+// מה שלא נכנס נדחה לסבב הבא ונספר במטריקה
+func (l *resurrectionLimiter) dispatch(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, queue []resurrection) {
+	running, err := inFlight(ctx, client)
+	if err != nil {
+		slog.Warn("Could not count in-flight resurrections", "error", err)
+	}
+	running += clusters.inFlight(ctx)
+	metrics.set("ethereal_resurrections_in_flight", nil, float64(running))
+
+	deferred := 0
+	created := map[string]int{}
+	for _, r := range orderResurrections(queue) {
+		client := client
+		if r.client != nil {
+			client = r.client
+		}
+		// הסבב יכול להימשך; אם ה-shard עבר בינתיים ל-replica אחרת, היא תקים את הפוד
+		rctx, cancel, ok := shards.fence(ctx, r.item)
+		if !ok {
+			continue
+		}
+		if (l.maxConcurrent > 0 && running >= l.maxConcurrent) || !l.bucket.Allow() {
+			deferred++
+			if !r.rollout {
+				reportBlocked(rctx, client, dyn, r.item, r.state, "global rate limiter", r.reason, "RateLimited")
+			}
+			cancel()
+			continue
+		}
+
+		pod, err := createPod(rctx, client, r.item, r.template)
+		cancel()
+		if err != nil {
+			slog.Error("Failed to resurrect pod", "name", r.item.GetName(), "reason", r.reason, "error", err)
+			healingRecords.failedResurrection(r.item, err, time.Now())
+			continue
+		}
+		running++
+		healingRecords.resurrected(r.item, r.reason, r.rollout, pod, time.Now())
+		slog.Info("Successfully resurrected pod", "name", r.item.GetName(), "pod", pod.Name, "reason", r.reason, "priority", r.priority)
+		if !r.rollout {
+			notifications.publish(r.item, corev1.EventTypeNormal, notifyResurrected, fmt.Sprintf("Pod %s resurrected (%s)", pod.Name, r.reason))
+			metrics.add("ethereal_resurrections_total", map[string]string{"namespace": r.item.GetNamespace(), "cluster": placement(r.item)}, 1)
+			created[r.item.GetNamespace()+"/"+r.item.GetName()]++
+		}
+	}
+
+	// כל הבקשות של אותו EtherealPod חולקות את אותו status, אז מעדכנים פעם אחת עם הספירה
+	recorded := map[string]bool{}
+	for _, r := range queue {
+		key := r.item.GetNamespace() + "/" + r.item.GetName()
+		if n := created[key]; n > 0 && !recorded[key] {
+			recorded[key] = true
+			recordResurrection(ctx, dyn, r.item, r.state, r.policy, time.Now(), n)
+		}
+	}
+
+	if deferred > 0 {
+		slog.Warn("Resurrections deferred by rate limiter", "deferred", deferred, "inFlight", running)
+	}
+	metrics.set("ethereal_deferred_resurrections", nil, float64(deferred))
+}
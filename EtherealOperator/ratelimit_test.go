@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// queuedItem - EtherealPod ב-namespace, עם גיל ועדיפות, כמו שהוא מגיע לתור
+func queuedItem(namespace, name string, age time.Duration, priority int64) resurrection {
+	item := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "sunday.com/v1",
+		"kind":       "EtherealPod",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"image": "sunday-app:v1", "priority": priority},
+	}}
+	item.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-age)))
+	return resurrection{item: item, priority: priority, reason: reasonDeleted}
+}
+
+func TestOrderResurrections(t *testing.T) {
+	queue := []resurrection{
+		queuedItem("team-b", "b-low", time.Hour, 0),
+		queuedItem("team-a", "a-new", time.Minute, 10),
+		queuedItem("team-a", "a-old", time.Hour, 10),
+		queuedItem("team-a", "a-older", 2*time.Hour, 10),
+		queuedItem("team-c", "c-high", time.Minute, 100),
+		queuedItem("team-b", "b-mid", time.Minute, 10),
+		queuedItem("team-a", "a-low", time.Hour, 0),
+	}
+	// עדיפות גבוהה קודם; בתוך עדיפות 10 team-a ו-team-b מתחלפים, והוותיק ביותר בכל namespace קודם
+	want := []string{"c-high", "a-older", "b-mid", "a-old", "a-new", "a-low", "b-low"}
+
+	ordered := orderResurrections(queue)
+	if len(ordered) != len(want) {
+		t.Fatalf("ordered %d resurrections, want %d", len(ordered), len(want))
+	}
+	for i, r := range ordered {
+		if r.item.GetName() != want[i] {
+			var got []string
+			for _, r := range ordered {
+				got = append(got, r.item.GetName())
+			}
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDispatchDefersOverBurst(t *testing.T) {
+	resetOperatorState()
+	c := newFakeCluster()
+	queue := []resurrection{
+		queuedItem("team-a", "a-low", time.Hour, 0),
+		queuedItem("team-b", "b-high", time.Minute, 10),
+		queuedItem("team-a", "a-high", time.Minute, 10),
+	}
+	for i := range queue {
+		if err := c.dyn.Tracker().Create(gvr, &queue[i].item, queue[i].item.GetNamespace()); err != nil {
+			t.Fatal(err)
+		}
+		queue[i].template = desiredTemplate(queue[i].item, queue[i].item.Object["spec"].(map[string]interface{}))
+	}
+
+	// token אחד, וה-bucket לא מתמלא במהלך הבדיקה
+	limiter := newResurrectionLimiter(0.001, 1, 0)
+	limiter.dispatch(context.Background(), c.client, c.dyn, queue)
+
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].OwnerReferences[0].Name != "a-high" {
+		t.Fatalf("created %d pods, want only a-high (first in order)", len(pods.Items))
+	}
+	if got := metrics.get("ethereal_deferred_resurrections", nil); got != 2 {
+		t.Errorf("ethereal_deferred_resurrections = %v, want 2", got)
+	}
+	for _, r := range queue[:2] {
+		item, err := c.dyn.Resource(gvr).Namespace(r.item.GetNamespace()).Get(context.Background(), r.item.GetName(), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked, _, _ := unstructured.NestedString(item.Object, "status", "healing", "blockedReason"); blocked != "RateLimited" {
+			t.Errorf("%s: status.healing.blockedReason = %q, want RateLimited", r.item.GetName(), blocked)
+		}
+	}
+
+	// סבב בלי דחיות מאפס את ה-gauge
+	newResurrectionLimiter(0, 0, 0).dispatch(context.Background(), c.client, c.dyn, queue[:1])
+	if got := metrics.get("ethereal_deferred_resurrections", nil); got != 0 {
+		t.Errorf("ethereal_deferred_resurrections = %v after a tick with nothing deferred", got)
+	}
+}
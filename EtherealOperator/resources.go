@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podResources ממירה את spec.resources (requests/limits של cpu ו-memory) ל-ResourceRequirements
+func podResources(spec map[string]interface{}) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: resourceList(spec, "requests"),
+		Limits:   resourceList(spec, "limits"),
+	}
+}
+
+func resourceList(spec map[string]interface{}, field string) corev1.ResourceList {
+	values, found, _ := unstructured.NestedStringMap(spec, "resources", field)
+	if !found {
+		return nil
+	}
+
+	list := corev1.ResourceList{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		v, ok := values[string(name)]
+		if !ok || v == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			slog.Warn("Ignoring invalid resource quantity", "field", "spec.resources."+field+"."+string(name), "value", v, "error", err)
+			continue
+		}
+		list[name] = q
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
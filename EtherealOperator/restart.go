@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// annotationRestartedAt - שינוי של הערך (בדרך כלל זמן, כמו ב-kubectl rollout restart) מבקש החלפה של הפודים
+const annotationRestartedAt = "sunday.com/restartedAt"
+
+// annotationPodRestartedAt נשמרת על הפוד: ה-status.restartedAt שלפיו הוא נוצר
+const annotationPodRestartedAt = "sunday.com/restarted-at"
+
+// annotationReplace על פוד אחד (kubectl ethereal resurrect --now) מבקשת להחליף רק אותו: החלופה עולה קודם,
+// והפוד יוצא כמו גרסה ישנה ונרשם כ-Manual
+const annotationReplace = "sunday.com/replace"
+
+// מי ביקש את ה-restart האחרון, ב-status.restartTrigger
+const (
+	restartManual    = "Manual"
+	restartScheduled = "Scheduled"
+)
+
+// evaluateManualRestart מחליפה את הפודים פעם אחת כשה-annotation או spec.restartGeneration משתנים.
+// הבקשה שטופלה נשמרת ב-status, אז הסבבים הבאים לא מחליפים שוב. ההחלפה עצמה היא rollout
+// רגיל (לפי maxSurge/maxUnavailable) כי status.restartedAt הוא חלק מה-hash של התבנית
+func evaluateManualRestart(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured, now time.Time) {
+	requested := item.GetAnnotations()[annotationRestartedAt]
+	generation, _, _ := unstructured.NestedInt64(item.Object, "spec", "restartGeneration")
+	observed, _, _ := unstructured.NestedString(item.Object, "status", "observedRestartedAt")
+	observedGeneration, _, _ := unstructured.NestedInt64(item.Object, "status", "observedRestartGeneration")
+
+	var why string
+	switch {
+	case requested != "" && requested != observed:
+		why = fmt.Sprintf("annotation %s set to %s", annotationRestartedAt, requested)
+	case generation > observedGeneration:
+		why = fmt.Sprintf("spec.restartGeneration bumped to %d", generation)
+	default:
+		return
+	}
+
+	restartedAt := now.UTC().Format(time.RFC3339)
+	status := map[string]interface{}{
+		"restartedAt":               restartedAt,
+		"restartTrigger":            restartManual,
+		"observedRestartedAt":       nilIfEmpty(requested),
+		"observedRestartGeneration": generation,
+	}
+	if err := patchStatus(ctx, dyn, *item, status); err != nil {
+		slog.Warn("Failed to record manual restart", "name", item.GetName(), "error", err)
+		return
+	}
+	// כמו ב-restart מתוזמן: התבנית של הסבב הזה כבר צריכה לכלול את ה-restart
+	for field, v := range status {
+		if v == nil {
+			unstructured.RemoveNestedField(item.Object, "status", field)
+		} else {
+			_ = unstructured.SetNestedField(item.Object, v, "status", field)
+		}
+	}
+
+	slog.Info("Manual restart", "name", item.GetName(), "why", why)
+	recordEvent(ctx, client, *item, corev1.EventTypeNormal, "ManualRestart", fmt.Sprintf("Restarting pods: %s", why))
+}
+
+// restartReason - אם ההבדל היחיד בין הפוד לתבנית הוא ה-restart, מחזירה את סיבת ההחלפה לפי מי שביקש אותו
+func restartReason(item unstructured.Unstructured, pod *corev1.Pod, tmpl podTemplate) string {
+	if tmpl.restartedAt == "" || pod.Annotations[annotationPodRestartedAt] == tmpl.restartedAt {
+		return ""
+	}
+	before := tmpl
+	before.restartedAt = pod.Annotations[annotationPodRestartedAt]
+	if before.hash() != pod.Annotations[annotationTemplateHash] {
+		return ""
+	}
+	if trigger, _, _ := unstructured.NestedString(item.Object, "status", "restartTrigger"); trigger == restartManual {
+		return reasonManualRestart
+	}
+	return reasonScheduledRestart
+}
+
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
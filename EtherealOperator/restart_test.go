@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// כל שינוי של restartGeneration או של ה-annotation מחליף כל פוד פעם אחת בדיוק, וערך שלא השתנה לא מחליף כלום
+func TestEvaluateManualRestart(t *testing.T) {
+	c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1", "replicas": int64(2)})
+	c.settle(t)
+
+	count := func(t *testing.T) (events, records int) {
+		t.Helper()
+		list, err := c.client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range list.Items {
+			if e.Reason == "ManualRestart" {
+				events++
+			}
+		}
+		recs, err := c.dyn.Resource(healingRecordGVR).Namespace("default").List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range recs.Items {
+			if trigger, _, _ := unstructured.NestedString(rec.Object, "spec", "trigger"); trigger == triggerManual {
+				records++
+			}
+		}
+		return events, records
+	}
+
+	steps := []struct {
+		name        string
+		value       interface{}
+		fields      []string
+		wantRestart bool
+	}{
+		{name: "restartGeneration bumped", value: int64(1), fields: []string{"spec", "restartGeneration"}, wantRestart: true},
+		{name: "restartGeneration unchanged", value: int64(1), fields: []string{"spec", "restartGeneration"}},
+		{name: "annotation set", value: "2026-10-19T10:00:00Z", fields: []string{"metadata", "annotations", annotationRestartedAt}, wantRestart: true},
+		{name: "annotation unchanged", value: "2026-10-19T10:00:00Z", fields: []string{"metadata", "annotations", annotationRestartedAt}},
+		{name: "restartGeneration bumped again", value: int64(2), fields: []string{"spec", "restartGeneration"}, wantRestart: true},
+	}
+	now := time.Now()
+	for _, step := range steps {
+		// status.restartedAt הוא ברזולוציה של שניות, אז כל צעד בדקה אחרת
+		now = now.Add(time.Minute)
+		before := map[string]bool{}
+		for _, pod := range c.pods(t) {
+			before[pod.Name] = true
+		}
+		eventsBefore, recordsBefore := count(t)
+		restartedBefore, _, _ := unstructured.NestedString(c.item(t).Object, "status", "restartedAt")
+
+		c.edit(t, step.value, step.fields...)
+		item := c.item(t)
+		evaluateManualRestart(context.Background(), c.client, c.dyn, &item, now)
+		c.settle(t)
+		c.settle(t)
+
+		item = c.item(t)
+		restartedAt, _, _ := unstructured.NestedString(item.Object, "status", "restartedAt")
+		events, records := count(t)
+		replaced := 0
+		for _, pod := range c.pods(t) {
+			if !before[pod.Name] {
+				replaced++
+			}
+		}
+		if !step.wantRestart {
+			if restartedAt != restartedBefore || events != eventsBefore || records != recordsBefore || replaced != 0 {
+				t.Errorf("%s: restarted anyway (restartedAt %q, %d new events, %d new records, %d new pods)",
+					step.name, restartedAt, events-eventsBefore, records-recordsBefore, replaced)
+			}
+			continue
+		}
+
+		if want := now.UTC().Format(time.RFC3339); restartedAt != want {
+			t.Errorf("%s: status.restartedAt = %q, want %q", step.name, restartedAt, want)
+		}
+		if trigger, _, _ := unstructured.NestedString(item.Object, "status", "restartTrigger"); trigger != restartManual {
+			t.Errorf("%s: status.restartTrigger = %q, want %s", step.name, trigger, restartManual)
+		}
+		if events != eventsBefore+1 {
+			t.Errorf("%s: %d ManualRestart events, want 1", step.name, events-eventsBefore)
+		}
+		if replaced != 2 || records != recordsBefore+2 {
+			t.Errorf("%s: %d new pods and %d Manual HealingRecords, want one per replica", step.name, replaced, records-recordsBefore)
+		}
+		for _, pod := range c.pods(t) {
+			if pod.DeletionTimestamp == nil && pod.Annotations[annotationPodRestartedAt] != restartedAt {
+				t.Errorf("%s: pod %s still carries restart %q", step.name, pod.Name, pod.Annotations[annotationPodRestartedAt])
+			}
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	labelEtherealPod = "sunday.com/etherealpod"
+
+	conditionProgressing   = "Progressing"
+	conditionRolloutFailed = "RolloutFailed"
+
+	defaultProgressDeadline = 10 * time.Minute
+	// כמה פודים של הגרסה החדשה מותר שיקרסו במהלך rollout לפני שחוזרים אחורה
+	rolloutFailureThreshold = 3
+	maxRevisionHistory      = 10
+)
+
+// rolloutStrategy היא spec.strategy אחרי המרה למספרים עבור מספר הרפליקות הנוכחי
+type rolloutStrategy struct {
+	maxSurge         int
+	maxUnavailable   int
+	minReady         time.Duration
+	progressDeadline time.Duration
+	canary           *canarySettings
+}
+
+// desiredReplicas קוראת את spec.replicas (ברירת מחדל 1)
+func desiredReplicas(spec map[string]interface{}) int {
+	if v, found, _ := unstructured.NestedInt64(spec, "replicas"); found && v >= 0 {
+		return int(v)
+	}
+	return 1
+}
+
+func rolloutSettings(spec map[string]interface{}, replicas int) rolloutStrategy {
+	s := rolloutStrategy{maxSurge: 1, progressDeadline: defaultProgressDeadline}
+
+	scaled := func(field string, roundUp bool, def int) int {
+		v, found, _ := unstructured.NestedFieldNoCopy(spec, "strategy", field)
+		if !found {
+			return def
+		}
+		var value intstr.IntOrString
+		switch n := v.(type) {
+		case int64:
+			value = intstr.FromInt32(int32(n))
+		case string:
+			value = intstr.FromString(n)
+		default:
+			return def
+		}
+		out, err := intstr.GetScaledValueFromIntOrPercent(&value, replicas, roundUp)
+		if err != nil {
+			slog.Warn("Ignoring invalid rollout strategy value", "field", "spec.strategy."+field, "error", err)
+			return def
+		}
+		return out
+	}
+	s.maxSurge = scaled("maxSurge", true, 1)
+	s.maxUnavailable = scaled("maxUnavailable", false, 0)
+	// אחרת ה-rollout לא יכול להתקדם בכלל
+	if s.maxSurge == 0 && s.maxUnavailable == 0 {
+		s.maxSurge = 1
+	}
+
+	if v, found, _ := unstructured.NestedInt64(spec, "strategy", "minReadySeconds"); found {
+		s.minReady = time.Duration(v) * time.Second
+	}
+	if v, found, _ := unstructured.NestedInt64(spec, "strategy", "progressDeadlineSeconds"); found && v > 0 {
+		s.progressDeadline = time.Duration(v) * time.Second
+	}
+	// חלון הניתוח של ה-canary לא נספר על חשבון ה-deadline
+	if s.canary = canaryStrategy(spec); s.canary != nil {
+		s.progressDeadline += s.canary.analysis
+	}
+	return s
+}
+
+// podSet מחלק את הפודים של EtherealPod לפי מצבם מול התבנית הרצויה
+type podSet struct {
+	current     []*corev1.Pod // תואמים לתבנית
+	old         []*corev1.Pod // גרסה קודמת (spec או קונפיגורציה)
+	terminated  []*corev1.Pod // Failed/Succeeded וטרם נמחקו
+	terminating int
+	driftReason string
+}
+
+func (s podSet) alive() int { return len(s.current) + len(s.old) }
+
+// listManagedPods מחזירה את כל הפודים של ה-EtherealPod לפי label.
+// פוד ישן בשם הקבוע real-<name> (מלפני שהיו רפליקות) מצורף גם אם אין לו עדיין label
+func listManagedPods(ctx context.Context, client kubernetes.Interface, item unstructured.Unstructured) ([]corev1.Pod, error) {
+	list, err := client.CoreV1().Pods(item.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: labelEtherealPod + "=" + item.GetName()})
+	if err != nil {
+		return nil, err
+	}
+	pods := list.Items
+
+	legacy, err := client.CoreV1().Pods(item.GetNamespace()).Get(ctx, "real-"+item.GetName(), metav1.GetOptions{})
+	if err == nil && legacy.Labels[labelEtherealPod] == "" {
+		pods = append(pods, *legacy)
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	return pods, nil
+}
+
+func classifyPods(item unstructured.Unstructured, pods []corev1.Pod, tmpl podTemplate, now time.Time) podSet {
+	var set podSet
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case pod.DeletionTimestamp != nil:
+			set.terminating++
+		case pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded:
+			set.terminated = append(set.terminated, pod)
+		default:
+			if reason := detectDrift(item, pod, tmpl); reason != "" {
+				set.old = append(set.old, pod)
+				set.driftReason = reason
+			} else if pod.Annotations[annotationReplace] != "" {
+				set.old = append(set.old, pod)
+				if set.driftReason == "" {
+					set.driftReason = reasonManualRestart
+				}
+			} else if podExpired(pod, tmpl.ttl, now) {
+				set.old = append(set.old, pod)
+				if set.driftReason == "" {
+					set.driftReason = reasonTTLExpired
+				}
+			} else {
+				set.current = append(set.current, pod)
+			}
+		}
+	}
+	return set
+}
+
+// podExpired - spec.ttl: פוד שחי יותר מה-ttl מוחלף כמו גרסה ישנה, בהדרגה ובלי לרדת מתחת ל-maxUnavailable.
+// פוד שאומץ נספר מרגע האימוץ
+func podExpired(pod *corev1.Pod, ttl time.Duration, now time.Time) bool {
+	if ttl <= 0 {
+		return false
+	}
+	started := pod.CreationTimestamp.Time
+	if pod.Status.StartTime != nil {
+		started = pod.Status.StartTime.Time
+	}
+	if adopted, err := time.Parse(time.RFC3339, pod.Annotations[annotationAdoptedAt]); err == nil && adopted.After(started) {
+		started = adopted
+	}
+	return !started.IsZero() && now.Sub(started) >= ttl
+}
+
+// podAvailable - הפוד Ready לפחות minReady (כמו availableReplicas של Deployment)
+func podAvailable(pod *corev1.Pod, minReady time.Duration, now time.Time) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue && !c.LastTransitionTime.Add(minReady).After(now)
+		}
+	}
+	return false
+}
+
+func countAvailable(pods []*corev1.Pod, minReady time.Duration, now time.Time) int {
+	n := 0
+	for _, pod := range pods {
+		if podAvailable(pod, minReady, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// rolloutState הוא מה שנשמר ב-status.rollout בזמן שגרסה חדשה מתפרסת
+type rolloutState struct {
+	revision  string
+	image     string
+	startedAt time.Time
+	failures  int64
+}
+
+func readRolloutState(item unstructured.Unstructured) (rolloutState, bool) {
+	var r rolloutState
+	rollout, found, _ := unstructured.NestedMap(item.Object, "status", "rollout")
+	if !found {
+		return r, false
+	}
+	r.revision, _, _ = unstructured.NestedString(rollout, "revision")
+	r.image, _, _ = unstructured.NestedString(rollout, "image")
+	r.failures, _, _ = unstructured.NestedInt64(rollout, "failures")
+	if v, _, _ := unstructured.NestedString(rollout, "startedAt"); v != "" {
+		r.startedAt, _ = time.Parse(time.RFC3339, v)
+	}
+	return r, true
+}
+
+// applyRollback - אם ה-image שב-spec כבר נכשל ב-rollout (ואותו generation), ממשיכים להריץ את האחרון שעבד
+func applyRollback(item unstructured.Unstructured, tmpl podTemplate) podTemplate {
+	badImage, _, _ := unstructured.NestedString(item.Object, "status", "rolledBack", "image")
+	toImage, _, _ := unstructured.NestedString(item.Object, "status", "rolledBack", "toImage")
+	generation, _, _ := unstructured.NestedInt64(item.Object, "status", "rolledBack", "observedGeneration")
+
+	if badImage != "" && badImage == tmpl.image && generation == item.GetGeneration() && toImage != "" {
+		tmpl.image = toImage
+	}
+	return tmpl
+}
+
+// progressRollout עוקבת אחרי ה-rollout של התבנית הנוכחית: מתחילה מעקב כשהתבנית משתנה,
+// מסיימת כשכל הרפליקות החדשות זמינות, ומחזירה לאחור אם עבר ה-deadline או שהפודים החדשים קורסים
+func progressRollout(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, set podSet, tmpl podTemplate, replicas int, strategy rolloutStrategy, now time.Time) {
+	revision := tmpl.hash()
+	current, _, _ := unstructured.NestedString(item.Object, "status", "currentRevision")
+	state, inProgress := readRolloutState(item)
+
+	if current != revision || (inProgress && state.revision != revision) {
+		startRollout(ctx, client, dyn, item, revision, tmpl.image, now)
+		return
+	}
+	if !inProgress {
+		return
+	}
+
+	if len(set.old) == 0 && countAvailable(set.current, strategy.minReady, now) >= replicas {
+		completeRollout(ctx, client, dyn, item, state, now)
+		return
+	}
+
+	switch {
+	case state.failures >= rolloutFailureThreshold:
+		failRollout(ctx, client, dyn, item, state, "PodsFailing", fmt.Sprintf("%d pods of revision %s failed", state.failures, revision), now)
+	case now.Sub(state.startedAt) > strategy.progressDeadline:
+		failRollout(ctx, client, dyn, item, state, "ProgressDeadlineExceeded", fmt.Sprintf("revision %s did not become available within %s", revision, strategy.progressDeadline), now)
+	}
+}
+
+func startRollout(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, revision, image string, now time.Time) {
+	status := map[string]interface{}{
+		"currentRevision": revision,
+		"rollout": map[string]interface{}{
+			"revision":  revision,
+			"image":     image,
+			"startedAt": now.UTC().Format(time.RFC3339),
+			"failures":  int64(0),
+		},
+	}
+	conditions := []metav1.Condition{{
+		Type: conditionProgressing, Status: metav1.ConditionTrue, Reason: "NewRevision",
+		Message: fmt.Sprintf("Rolling out revision %s (%s)", revision, image),
+	}}
+	// spec חדש - ה-rollback הקודם כבר לא רלוונטי
+	if generation, found, _ := unstructured.NestedInt64(item.Object, "status", "rolledBack", "observedGeneration"); found && generation != item.GetGeneration() {
+		status["rolledBack"] = nil
+		conditions = append(conditions, metav1.Condition{Type: conditionRolloutFailed, Status: metav1.ConditionFalse, Reason: "NewRevision"})
+	}
+
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to record rollout start", "name", item.GetName(), "error", err)
+		return
+	}
+	if err := setConditions(ctx, dyn, item, conditions...); err != nil {
+		slog.Warn("Failed to update rollout condition", "name", item.GetName(), "error", err)
+	}
+
+	slog.Info("Starting rollout", "name", item.GetName(), "revision", revision, "image", image)
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "RolloutStarted", fmt.Sprintf("Rolling out revision %s with image %s", revision, image))
+}
+
+func completeRollout(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, state rolloutState, now time.Time) {
+	history, _, _ := unstructured.NestedSlice(item.Object, "status", "revisionHistory")
+	entry := map[string]interface{}{
+		"revision":   state.revision,
+		"image":      state.image,
+		"deployedAt": now.UTC().Format(time.RFC3339),
+	}
+	if len(history) == 0 || history[0].(map[string]interface{})["revision"] != state.revision {
+		history = append([]interface{}{entry}, history...)
+	}
+	if len(history) > maxRevisionHistory {
+		history = history[:maxRevisionHistory]
+	}
+
+	status := map[string]interface{}{
+		"rollout":         nil,
+		"stableRevision":  state.revision,
+		"stableImage":     state.image,
+		"revisionHistory": history,
+	}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to record rollout completion", "name", item.GetName(), "error", err)
+		return
+	}
+
+	rolledBackTo, _, _ := unstructured.NestedString(item.Object, "status", "rolledBack", "toImage")
+	conditions := []metav1.Condition{{
+		Type: conditionProgressing, Status: metav1.ConditionFalse, Reason: "RolloutComplete",
+		Message: fmt.Sprintf("Revision %s (%s) is available", state.revision, state.image),
+	}}
+	// אחרי rollback ה-condition RolloutFailed נשאר עד שה-spec משתנה, כדי שיראו שה-image שב-spec לא רץ
+	if rolledBackTo != state.image {
+		conditions = append(conditions, metav1.Condition{Type: conditionRolloutFailed, Status: metav1.ConditionFalse, Reason: "RolloutComplete"})
+	}
+	if err := setConditions(ctx, dyn, item, conditions...); err != nil {
+		slog.Warn("Failed to update rollout condition", "name", item.GetName(), "error", err)
+	}
+
+	slog.Info("Rollout complete", "name", item.GetName(), "revision", state.revision, "image", state.image)
+	recordEvent(ctx, client, item, corev1.EventTypeNormal, "RolloutComplete", fmt.Sprintf("Revision %s with image %s is available", state.revision, state.image))
+}
+
+func failRollout(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, state rolloutState, reason, why string, now time.Time) {
+	stableImage, _, _ := unstructured.NestedString(item.Object, "status", "stableImage")
+
+	status := map[string]interface{}{"rollout": nil}
+	message := "Rollout failed: " + why
+	if stableImage != "" && stableImage != state.image {
+		status["rolledBack"] = map[string]interface{}{
+			"image":              state.image,
+			"toImage":            stableImage,
+			"observedGeneration": item.GetGeneration(),
+			"at":                 now.UTC().Format(time.RFC3339),
+		}
+		message += ", rolled back to " + stableImage
+	}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to record failed rollout", "name", item.GetName(), "error", err)
+		return
+	}
+
+	if err := setConditions(ctx, dyn, item,
+		metav1.Condition{Type: conditionRolloutFailed, Status: metav1.ConditionTrue, Reason: reason, Message: message},
+		metav1.Condition{Type: conditionProgressing, Status: metav1.ConditionFalse, Reason: "RolloutFailed", Message: message},
+	); err != nil {
+		slog.Warn("Failed to update rollout condition", "name", item.GetName(), "error", err)
+	}
+
+	slog.Error("Rollout failed", "name", item.GetName(), "revision", state.revision, "image", state.image, "reason", why, "rollbackTo", stableImage)
+	recordEvent(ctx, client, item, corev1.EventTypeWarning, "RolloutFailed", message)
+}
+
+// countRolloutFailure סופרת קריסה של פוד מהגרסה שמתפרסת עכשיו
+func countRolloutFailure(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, pod *corev1.Pod, tmpl podTemplate) {
+	state, inProgress := readRolloutState(item)
+	if !inProgress || pod.Annotations[annotationTemplateHash] != state.revision || state.revision != tmpl.hash() {
+		return
+	}
+	if err := patchStatus(ctx, dyn, item, map[string]interface{}{"rollout": map[string]interface{}{"failures": state.failures + 1}}); err != nil {
+		slog.Warn("Failed to count rollout failure", "name", item.GetName(), "error", err)
+	}
+}
+
+// planRollout מחליטה כמה פודים חדשים להקים ואילו ישנים להוריד, בגבולות maxSurge ו-maxUnavailable.
+// פודים ישנים שאינם זמינים יורדים ראשונים - הם לא תורמים לזמינות בכל מקרה
+func planRollout(set podSet, replicas int, strategy rolloutStrategy, now time.Time) (create int, retire []*corev1.Pod) {
+	create = replicas - len(set.current)
+	if room := replicas + strategy.maxSurge - set.alive() - set.terminating; create > room {
+		create = room
+	}
+	if create < 0 {
+		create = 0
+	}
+
+	old := append([]*corev1.Pod(nil), set.old...)
+	sort.SliceStable(old, func(i, j int) bool {
+		return !podAvailable(old[i], strategy.minReady, now) && podAvailable(old[j], strategy.minReady, now)
+	})
+
+	available := countAvailable(set.current, strategy.minReady, now) + countAvailable(set.old, strategy.minReady, now)
+	minAvailable := replicas - strategy.maxUnavailable
+	for _, pod := range old {
+		if !podAvailable(pod, strategy.minReady, now) {
+			retire = append(retire, pod)
+			continue
+		}
+		if available-1 < minAvailable {
+			break
+		}
+		retire = append(retire, pod)
+		available--
+	}
+	return create, retire
+}
+
+// excessPods בוחרת אילו פודים עודפים להוריד כשיש יותר מ-replicas: קודם לא מוכנים, אחר כך החדשים ביותר
+func excessPods(pods []*corev1.Pod, replicas int) []*corev1.Pod {
+	if len(pods) <= replicas {
+		return nil
+	}
+	sorted := append([]*corev1.Pod(nil), pods...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := podReady(sorted[i]), podReady(sorted[j])
+		if ri != rj {
+			return !ri
+		}
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+	return sorted[:len(pods)-replicas]
+}
+
+// recordReplicaStatus כותבת את ספירת הרפליקות ל-status, רק כשהיא משתנה
+func recordReplicaStatus(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, set podSet, strategy rolloutStrategy, now time.Time) {
+	ready := 0
+	for _, pod := range append(append([]*corev1.Pod(nil), set.current...), set.old...) {
+		if podReady(pod) {
+			ready++
+		}
+	}
+	counts := map[string]int64{
+		"replicas":          int64(set.alive()),
+		"readyReplicas":     int64(ready),
+		"updatedReplicas":   int64(len(set.current)),
+		"availableReplicas": int64(countAvailable(set.current, strategy.minReady, now) + countAvailable(set.old, strategy.minReady, now)),
+	}
+
+	status := map[string]interface{}{}
+	for field, v := range counts {
+		if old, _, _ := unstructured.NestedInt64(item.Object, "status", field); old != v {
+			status[field] = v
+		}
+	}
+	if len(status) == 0 {
+		return
+	}
+	if err := patchStatus(ctx, dyn, item, status); err != nil {
+		slog.Warn("Failed to update replica counts", "name", item.GetName(), "error", err)
+	}
+}
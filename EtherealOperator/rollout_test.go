@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPlanRollout(t *testing.T) {
+	now := time.Now()
+	pods := func(prefix string, available, unavailable int) []*corev1.Pod {
+		var out []*corev1.Pod
+		for i := 0; i < available+unavailable; i++ {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: prefix + string(rune('a'+i))}, Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+			ready := corev1.ConditionTrue
+			if i >= available {
+				ready = corev1.ConditionFalse
+			}
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: ready, LastTransitionTime: metav1.NewTime(now.Add(-time.Hour))}}
+			out = append(out, pod)
+		}
+		return out
+	}
+
+	cases := []struct {
+		name        string
+		surge       int
+		unavailable int
+		set         podSet
+
+		wantCreate int
+		wantRetire []string
+	}{
+		{name: "surge first", surge: 1, set: podSet{old: pods("old-", 3, 0)}, wantCreate: 1},
+		{name: "surge is spent until an old pod goes", surge: 1, set: podSet{current: pods("new-", 0, 1), old: pods("old-", 3, 0)}},
+		{name: "new pod available lets one old pod go", surge: 1, set: podSet{current: pods("new-", 1, 0), old: pods("old-", 3, 0)}, wantRetire: []string{"old-a"}},
+		{name: "no surge retires first", unavailable: 1, set: podSet{old: pods("old-", 3, 0)}, wantRetire: []string{"old-a"}},
+		{name: "surge and unavailable together", surge: 2, unavailable: 1, set: podSet{old: pods("old-", 3, 0)}, wantCreate: 2, wantRetire: []string{"old-a"}},
+		{name: "an unavailable old pod uses up maxUnavailable", unavailable: 1, set: podSet{old: pods("old-", 2, 1)}, wantRetire: []string{"old-c"}},
+		{name: "unavailable old pods go first", unavailable: 2, set: podSet{old: pods("old-", 2, 1)}, wantRetire: []string{"old-c", "old-a"}},
+		{name: "zero budget still retires broken pods", set: podSet{old: pods("old-", 2, 1)}, wantRetire: []string{"old-c"}},
+		{name: "terminating pods count against the surge", surge: 1, set: podSet{old: pods("old-", 3, 0), terminating: 1}},
+		{name: "scaling up during a rollout", surge: 1, set: podSet{old: pods("old-", 1, 0)}, wantCreate: 3},
+		{name: "done", surge: 1, set: podSet{current: pods("new-", 3, 0)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			strategy := rolloutStrategy{maxSurge: tc.surge, maxUnavailable: tc.unavailable}
+			create, retire := planRollout(tc.set, 3, strategy, now)
+			if create != tc.wantCreate {
+				t.Errorf("create = %d, want %d", create, tc.wantCreate)
+			}
+			var names []string
+			for _, pod := range retire {
+				names = append(names, pod.Name)
+			}
+			if len(names) != len(tc.wantRetire) {
+				t.Fatalf("retire = %v, want %v", names, tc.wantRetire)
+			}
+			for i := range names {
+				if names[i] != tc.wantRetire[i] {
+					t.Errorf("retire = %v, want %v", names, tc.wantRetire)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	item := unstructured.Unstructured{Object: map[string]interface{}{}}
+	item.SetGeneration(4)
+	_ = unstructured.SetNestedMap(item.Object, map[string]interface{}{"image": "sunday-app:bad", "toImage": "sunday-app:v1", "observedGeneration": int64(4)}, "status", "rolledBack")
+
+	cases := []struct {
+		name       string
+		image      string
+		generation int64
+		want       string
+	}{
+		{name: "the failed image runs the stable one", image: "sunday-app:bad", generation: 4, want: "sunday-app:v1"},
+		{name: "a different image is rolled out", image: "sunday-app:v2", generation: 4, want: "sunday-app:v2"},
+		{name: "a new generation retries the image", image: "sunday-app:bad", generation: 5, want: "sunday-app:bad"},
+	}
+	for _, tc := range cases {
+		item.SetGeneration(tc.generation)
+		if got := applyRollback(item, podTemplate{image: tc.image}).image; got != tc.want {
+			t.Errorf("%s: image = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// rollout שהפודים שלו קורסים rolloutFailureThreshold פעמים חוזר ל-image האחרון שעבד
+func TestRolloutRollsBackAfterFailures(t *testing.T) {
+	for _, failures := range []int64{rolloutFailureThreshold - 1, rolloutFailureThreshold} {
+		c := newTestCluster(t, map[string]interface{}{"image": "sunday-app:v1"})
+		c.settle(t)
+		if stable, _, _ := unstructured.NestedString(c.item(t).Object, "status", "stableImage"); stable != "sunday-app:v1" {
+			t.Fatalf("status.stableImage = %q after the first rollout", stable)
+		}
+
+		c.edit(t, "sunday-app:bad", "spec", "image")
+		item := c.item(t)
+		reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+		if _, rolling := readRolloutState(c.item(t)); !rolling {
+			t.Fatal("the new image did not start a rollout")
+		}
+		c.edit(t, failures, "status", "rollout", "failures")
+
+		item = c.item(t)
+		reconcile(context.Background(), item, c.client, c.dyn, nil, newDependencyGraph([]unstructured.Unstructured{item}))
+		item = c.item(t)
+		rolledBack, _, _ := unstructured.NestedString(item.Object, "status", "rolledBack", "toImage")
+		if failures < rolloutFailureThreshold {
+			if rolledBack != "" || conditionStatus(item, conditionRolloutFailed) == metav1.ConditionTrue {
+				t.Errorf("rolled back after %d failures, below the threshold", failures)
+			}
+			continue
+		}
+		if rolledBack != "sunday-app:v1" || conditionStatus(item, conditionRolloutFailed) != metav1.ConditionTrue {
+			t.Fatalf("after %d failures: rolledBack.toImage = %q, RolloutFailed %s", failures, rolledBack, conditionStatus(item, conditionRolloutFailed))
+		}
+
+		// ה-spec עדיין מבקש את ה-image השבור, אבל הפודים חוזרים ל-v1
+		c.settle(t)
+		c.settle(t)
+		for _, pod := range c.pods(t) {
+			if pod.DeletionTimestamp == nil && pod.Spec.Containers[0].Image != "sunday-app:v1" {
+				t.Errorf("pod %s runs %s after the rollback", pod.Name, pod.Spec.Containers[0].Image)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// פעולות מתוזמנות ב-spec.schedule
+const (
+	actionRestart   = "Restart"
+	actionHibernate = "Hibernate"
+)
+
+// הרצה של Restart שהוחמצה (למשל כשהאופרטור היה למטה) מתבצעת באיחור רק בתוך החלון הזה
+const defaultStartingDeadline = time.Hour
+
+// scheduleEntry היא רשומה אחת ב-spec.schedule
+type scheduleEntry struct {
+	name             string
+	action           string
+	cron             *cronSchedule
+	until            *cronSchedule // רק ל-Hibernate: מתי להתעורר
+	startingDeadline time.Duration
+}
+
+func parseScheduleEntry(m map[string]interface{}) (scheduleEntry, error) {
+	e := scheduleEntry{startingDeadline: defaultStartingDeadline}
+	e.name, _, _ = unstructured.NestedString(m, "name")
+	e.action, _, _ = unstructured.NestedString(m, "action")
+
+	location := time.UTC
+	if tz, _, _ := unstructured.NestedString(m, "timeZone"); tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return e, fmt.Errorf("timeZone: %w", err)
+		}
+	}
+
+	expr, _, _ := unstructured.NestedString(m, "cron")
+	var err error
+	if e.cron, err = parseCron(expr, location); err != nil {
+		return e, fmt.Errorf("cron: %w", err)
+	}
+
+	switch e.action {
+	case actionRestart:
+	case actionHibernate:
+		until, _, _ := unstructured.NestedString(m, "until")
+		if e.until, err = parseCron(until, location); err != nil {
+			return e, fmt.Errorf("until: %w", err)
+		}
+	default:
+		return e, fmt.Errorf("unknown action %q", e.action)
+	}
+
+	if v, found, _ := unstructured.NestedInt64(m, "startingDeadlineSeconds"); found && v > 0 {
+		e.startingDeadline = time.Duration(v) * time.Second
+	}
+	return e, nil
+}
+
+// hibernating - חלון שינה פעיל כשההתחלה האחרונה מאוחרת מההתעוררות האחרונה.
+// החישוב תלוי רק בשעון, אז אחרי השבתה של האופרטור המצב נכון מיד
+func (e scheduleEntry) hibernating(now time.Time) (bool, time.Time) {
+	start, found := e.cron.prev(now)
+	if !found {
+		return false, time.Time{}
+	}
+	wake, found := e.until.prev(now)
+	return !found || start.After(wake), start
+}
+
+// evaluateSchedules מריצה את הפעולות המתוזמנות שהגיע זמנן, מעדכנת את status.schedules,
+// ומחזירה את שם החלון אם ה-EtherealPod צריך לישון עכשיו
+func evaluateSchedules(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item *unstructured.Unstructured, now time.Time) string {
+	entries, _, _ := unstructured.NestedSlice(item.Object, "spec", "schedule")
+	existing, _, _ := unstructured.NestedMap(item.Object, "status", "schedules")
+	status := map[string]interface{}{}
+	statusUpdate := map[string]interface{}{}
+	hibernatedBy := ""
+	changed := false
+
+	for i, raw := range entries {
+		m, _ := raw.(map[string]interface{})
+		e, err := parseScheduleEntry(m)
+		if e.name == "" {
+			e.name = fmt.Sprintf("schedule-%d", i)
+		}
+		previous, _ := existing[e.name].(map[string]interface{})
+		if err != nil {
+			if previous["error"] != err.Error() {
+				slog.Warn("Ignoring invalid schedule", "name", item.GetName(), "schedule", e.name, "error", err)
+				recordEvent(ctx, client, *item, corev1.EventTypeWarning, "InvalidSchedule", fmt.Sprintf("Schedule %s: %v", e.name, err))
+			}
+			status[e.name] = map[string]interface{}{"action": e.action, "error": err.Error()}
+			changed = changed || previous["error"] != err.Error()
+			continue
+		}
+
+		entry := map[string]interface{}{"action": e.action, "error": nil}
+		for _, field := range []string{"since", "lastRun", "lastScheduleTime", "lastMissed"} {
+			entry[field] = previous[field]
+		}
+		if entry["since"] == nil {
+			entry["since"] = now.UTC().Format(time.RFC3339)
+		}
+		if next, found := e.cron.next(now); found {
+			entry["nextRun"] = next.UTC().Format(time.RFC3339)
+		}
+
+		switch e.action {
+		case actionHibernate:
+			active, start := e.hibernating(now)
+			entry["active"] = active
+			if active {
+				if hibernatedBy == "" {
+					hibernatedBy = e.name
+				}
+				entry["lastRun"] = start.UTC().Format(time.RFC3339)
+				if wake, found := e.until.next(now); found {
+					entry["wakeAt"] = wake.UTC().Format(time.RFC3339)
+				}
+			} else {
+				entry["wakeAt"] = nil
+			}
+			if active != (previous["active"] == true) {
+				slog.Info("Hibernation window changed", "name", item.GetName(), "schedule", e.name, "active", active)
+				reason, message := "Waking", fmt.Sprintf("Hibernation window %s ended", e.name)
+				if active {
+					reason, message = "Hibernating", fmt.Sprintf("Hibernation window %s started, pods are removed and healing is suspended", e.name)
+				}
+				recordEvent(ctx, client, *item, corev1.EventTypeNormal, reason, message)
+			}
+
+		case actionRestart:
+			scheduled, found := e.cron.prev(now)
+			if !found || !scheduled.After(latestTime(entry, "since", "lastScheduleTime", "lastMissed")) {
+				break
+			}
+			// כמה הרצות שהוחמצו מתאחדות להרצה אחת, ורק אם האחרונה שבהן עדיין בתוך ה-deadline
+			if now.Sub(scheduled) > e.startingDeadline {
+				entry["lastMissed"] = scheduled.UTC().Format(time.RFC3339)
+				slog.Warn("Missed scheduled restart", "name", item.GetName(), "schedule", e.name, "scheduled", scheduled)
+				recordEvent(ctx, client, *item, corev1.EventTypeWarning, "MissedSchedule",
+					fmt.Sprintf("Skipped restart %s scheduled for %s: more than %s late", e.name, scheduled.UTC().Format(time.RFC3339), e.startingDeadline))
+				break
+			}
+			entry["lastRun"] = now.UTC().Format(time.RFC3339)
+			entry["lastScheduleTime"] = scheduled.UTC().Format(time.RFC3339)
+			statusUpdate["restartedAt"] = now.UTC().Format(time.RFC3339)
+			statusUpdate["restartTrigger"] = restartScheduled
+			slog.Info("Scheduled restart", "name", item.GetName(), "schedule", e.name, "scheduled", scheduled)
+			recordEvent(ctx, client, *item, corev1.EventTypeNormal, "ScheduledRestart", fmt.Sprintf("Restarting pods for schedule %s", e.name))
+		}
+		status[e.name] = entry
+		changed = changed || !sameFields(previous, entry)
+	}
+
+	// רשומות שהוסרו מה-spec יוצאות גם מה-status
+	for name := range existing {
+		if _, ok := status[name]; !ok {
+			status[name] = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return hibernatedBy
+	}
+
+	statusUpdate["schedules"] = status
+	if err := patchStatus(ctx, dyn, *item, statusUpdate); err != nil {
+		slog.Warn("Failed to update schedule status", "name", item.GetName(), "error", err)
+		return hibernatedBy
+	}
+	// ה-restart צריך להיכנס כבר לתבנית של הסבב הזה
+	if restartedAt, ok := statusUpdate["restartedAt"]; ok {
+		_ = unstructured.SetNestedField(item.Object, restartedAt, "status", "restartedAt")
+		_ = unstructured.SetNestedField(item.Object, restartScheduled, "status", "restartTrigger")
+	}
+	return hibernatedBy
+}
+
+// latestTime מחזירה את המאוחר מבין שדות הזמן (RFC3339) שנמצאים ב-m
+func latestTime(m map[string]interface{}, fields ...string) time.Time {
+	var latest time.Time
+	for _, f := range fields {
+		s, _ := m[f].(string)
+		if t, err := time.Parse(time.RFC3339, s); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// sameFields בודקת אם כל שדות ה-patch כבר נמצאים ב-status (nil פירושו שדה שלא קיים)
+func sameFields(current, update map[string]interface{}) bool {
+	for k, v := range update {
+		if current[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// hibernate מורידה את כל הפודים החיים ומדווחת שה-EtherealPod ישן. פודים שקרסו נשארים לריפוי אחרי ההתעוררות
+func hibernate(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, item unstructured.Unstructured, set podSet, policy *healingPolicy, window string, now time.Time) {
+	for _, pod := range append(append([]*corev1.Pod(nil), set.current...), set.old...) {
+		retirePod(ctx, client, item, pod, policy, "Hibernating")
+	}
+
+	recordReplicaStatus(ctx, dyn, item, podSet{}, rolloutStrategy{}, now)
+	setWaitingReason(ctx, dyn, item, "Hibernating")
+	cond := metav1.Condition{Type: conditionAvailable, Status: metav1.ConditionFalse, Reason: "Hibernating",
+		Message: fmt.Sprintf("Hibernation window %s is active", window)}
+	if err := setConditions(ctx, dyn, item, cond); err != nil {
+		slog.Warn("Failed to update availability", "name", item.GetName(), "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHibernationWindow(t *testing.T) {
+	// החלון מהבקשה: שישי 20:00 עד שני 06:00
+	e, err := parseScheduleEntry(map[string]interface{}{
+		"name": "weekend", "action": actionHibernate, "cron": "0 20 * * fri", "until": "0 6 * * mon", "timeZone": "Asia/Jerusalem",
+	})
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	jerusalem := e.cron.location
+
+	cases := []struct {
+		at   string
+		want bool
+	}{
+		{at: "2026-03-13 19:59", want: false}, // שישי
+		{at: "2026-03-13 20:00", want: true},
+		{at: "2026-03-14 12:00", want: true}, // שבת
+		{at: "2026-03-16 05:59", want: true}, // שני
+		{at: "2026-03-16 06:00", want: false},
+		{at: "2026-03-18 12:00", want: false}, // רביעי
+	}
+	for _, tc := range cases {
+		now, err := time.ParseInLocation("2006-01-02 15:04", tc.at, jerusalem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		active, start := e.hibernating(now)
+		if active != tc.want {
+			t.Errorf("hibernating at %s = %v, want %v", tc.at, active, tc.want)
+		}
+		if active && (start.Weekday() != time.Friday || start.In(jerusalem).Hour() != 20) {
+			t.Errorf("window at %s started %s, want Friday 20:00", tc.at, start)
+		}
+	}
+}
+
+func TestScheduledRestartCatchUp(t *testing.T) {
+	since := time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		// now - מתי האופרטור חוזר; ההרצה המתוזמנת היא ב-03:00 כל יום
+		now         time.Time
+		wantRestart bool
+		wantMissed  bool
+	}{
+		{name: "before the first run", now: time.Date(2026, 3, 10, 2, 59, 0, 0, time.UTC)},
+		{name: "on time", now: time.Date(2026, 3, 10, 3, 0, 30, 0, time.UTC), wantRestart: true},
+		{name: "late but within startingDeadline", now: time.Date(2026, 3, 10, 3, 50, 0, 0, time.UTC), wantRestart: true},
+		{name: "past startingDeadline", now: time.Date(2026, 3, 10, 4, 1, 0, 0, time.UTC), wantMissed: true},
+		// שלוש הרצות הוחמצו; רק האחרונה נבדקת מול ה-deadline, וה-restart רץ פעם אחת
+		{name: "several missed runs collapse into one", now: time.Date(2026, 3, 12, 3, 30, 0, 0, time.UTC), wantRestart: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCluster(t, map[string]interface{}{"schedule": []interface{}{
+				map[string]interface{}{"name": "nightly", "action": actionRestart, "cron": "0 3 * * *"},
+			}})
+			c.edit(t, map[string]interface{}{
+				"nightly": map[string]interface{}{"action": actionRestart, "since": since.Format(time.RFC3339)},
+			}, "status", "schedules")
+
+			item := c.item(t)
+			evaluateSchedules(context.Background(), c.client, c.dyn, &item, tc.now)
+			restartedAt, _, _ := unstructured.NestedString(c.item(t).Object, "status", "restartedAt")
+			if (restartedAt != "") != tc.wantRestart {
+				t.Errorf("status.restartedAt = %q, want a restart: %v", restartedAt, tc.wantRestart)
+			}
+			missed, _, _ := unstructured.NestedString(c.item(t).Object, "status", "schedules", "nightly", "lastMissed")
+			if (missed != "") != tc.wantMissed {
+				t.Errorf("lastMissed = %q, want a missed run: %v", missed, tc.wantMissed)
+			}
+
+			// הסבב הבא לא מריץ שוב את אותה הרצה
+			item = c.item(t)
+			evaluateSchedules(context.Background(), c.client, c.dyn, &item, tc.now.Add(30*time.Second))
+			if again, _, _ := unstructured.NestedString(c.item(t).Object, "status", "restartedAt"); again != restartedAt {
+				t.Errorf("the same scheduled run restarted twice: %q then %q", restartedAt, again)
+			}
+		})
+	}
+}
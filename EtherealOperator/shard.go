@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// label על ה-Leases של ה-sharding, כדי למצוא את החברים בקבוצה
+const labelShardGroup = "sunday.com/shard-group"
+
+func init() {
+	metrics.describe("ethereal_shards_owned", "gauge", "Shards whose Lease this replica currently holds.")
+	metrics.describe("ethereal_shard_members", "gauge", "Live operator replicas in the shard group.")
+	metrics.describe("ethereal_shard_handoffs_total", "counter", "Shards acquired or released by this replica.")
+}
+
+// shards הוא nil כשאין sharding, ואז כל replica מטפלת בכל ה-EtherealPods
+var shards *shardManager
+
+// shardManager מחלקת את ה-EtherealPods בין replicas פעילות של האופרטור. כל EtherealPod שייך
+// לאחד מ-count shards לפי hash של namespace/name, ולכל shard יש Lease. replica מטפלת ב-EtherealPod
+// רק כשהיא מחזיקה ב-Lease של ה-shard שלו ועוד לא עבר renewDeadline מאז החידוש האחרון שהצליח.
+//
+// כמו ב-leader election של client-go: replica אחרת לוקחת Lease רק כשהוא פנוי, או אחרי שראתה
+// אותו בלי שינוי במשך duration שלם לפי השעון שלה. renewDeadline קצר מ-duration, אז המחזיק
+// מפסיק לפעול לפני שמישהו אחר יכול להתחיל - גם בלי להסתמך על שעונים מסונכרנים
+type shardManager struct {
+	client        kubernetes.Interface
+	namespace     string
+	group         string
+	identity      string
+	count         int
+	duration      time.Duration
+	renewDeadline time.Duration
+	// now - השעון המקומי; בבדיקות שעון מזויף
+	now func() time.Time
+
+	mu sync.Mutex
+	// held - ה-Leases שבידינו, עם הגרסה האחרונה והזמן המקומי שלפני החידוש האחרון שהצליח
+	held map[int]heldLease
+	// observed - Leases של אחרים: מתי ראינו לראשונה את הגרסה הנוכחית
+	observed map[int]observedLease
+}
+
+type heldLease struct {
+	lease     *coordinationv1.Lease
+	renewedAt time.Time
+}
+
+type observedLease struct {
+	resourceVersion string
+	at              time.Time
+}
+
+func newShardManager(client kubernetes.Interface, group string, count int, duration time.Duration) *shardManager {
+	if count <= 1 {
+		return nil
+	}
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	return &shardManager{
+		client:        client,
+		namespace:     operatorNamespace(),
+		group:         group,
+		identity:      identity,
+		count:         count,
+		duration:      duration,
+		renewDeadline: duration * 2 / 3,
+		now:           time.Now,
+		held:          map[int]heldLease{},
+		observed:      map[int]observedLease{},
+	}
+}
+
+// shardOf - אותו EtherealPod תמיד באותו shard, לא משנה כמה replicas יש
+func shardOf(item unstructured.Unstructured, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(item.GetNamespace() + "/" + item.GetName()))
+	return int(h.Sum32() % uint32(count))
+}
+
+func (s *shardManager) leaseName(shard int) string {
+	return fmt.Sprintf("%s-shard-%d", s.group, shard)
+}
+
+func (s *shardManager) memberName() string {
+	return s.group + "-member-" + s.identity
+}
+
+// owns - האם ה-replica הזו רשאית לטפל ב-EtherealPod עכשיו. בלי sharding תמיד כן
+func (s *shardManager) owns(ctx context.Context, item unstructured.Unstructured) bool {
+	_, ok := s.ownedUntil(ctx, item)
+	return ok
+}
+
+// fence - כמו owns, ומחזירה context שמתבטל כשעובר ה-renewDeadline של ה-Lease. בדיקה אחת לפני
+// הטיפול לא מספיקה: קריאה איטית (קלאסטר מרוחק, בדיקת HTTP, API server עמוס) יכולה לכתוב אחרי
+// שה-Lease כבר עבר ל-replica אחרת. cancel חובה גם כשאין בעלות
+func (s *shardManager) fence(ctx context.Context, item unstructured.Unstructured) (context.Context, context.CancelFunc, bool) {
+	if s == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, true
+	}
+	until, ok := s.ownedUntil(ctx, item)
+	if !ok {
+		return ctx, func() {}, false
+	}
+	// until לפי השעון של s.now, וה-deadline של ה-context לפי השעון האמיתי
+	ctx, cancel := context.WithTimeout(ctx, until.Sub(s.now()))
+	return ctx, cancel, true
+}
+
+// ownedUntil מחזירה עד מתי מותר לטפל ב-EtherealPod בלי חידוש נוסף.
+// Lease שמתקרב ל-renewDeadline מחודש כאן, כדי שסבב ארוך לא יאבד את ה-shards באמצע
+func (s *shardManager) ownedUntil(ctx context.Context, item unstructured.Unstructured) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, true
+	}
+	shard := shardOf(item, s.count)
+	s.mu.Lock()
+	h, ok := s.held[shard]
+	s.mu.Unlock()
+	if !ok {
+		return time.Time{}, false
+	}
+	if s.now().Sub(h.renewedAt) > s.renewDeadline/2 {
+		s.renew(ctx, shard, h)
+		s.mu.Lock()
+		h, ok = s.held[shard]
+		s.mu.Unlock()
+	}
+	until := h.renewedAt.Add(s.renewDeadline)
+	return until, ok && s.now().Before(until)
+}
+
+// primary - ה-replica שמחזיקה ב-shard 0 עושה את העבודה הכלל-קלאסטרית (status של מדיניות, ניקוי רשומות)
+func (s *shardManager) primary() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.held[0]
+	return ok && s.now().Sub(h.renewedAt) < s.renewDeadline
+}
+
+// owned מסננת את ה-EtherealPods שבטיפול ה-replica הזו
+func (s *shardManager) owned(ctx context.Context, items []unstructured.Unstructured) []unstructured.Unstructured {
+	if s == nil {
+		return items
+	}
+	var out []unstructured.Unstructured
+	for _, item := range items {
+		if s.owns(ctx, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// sync רצה בתחילת כל סבב: מחדשת את החברות ואת ה-Leases שבידינו, ומאזנת - משחררת shards
+// מעבר לחלק ההוגן ולוקחת shards פנויים או שפג תוקפם. השחרור קורה בין סבבים, כשאין עבודה באמצע
+func (s *shardManager) sync(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	members, leases := s.heartbeat(ctx)
+	fair := (s.count + members - 1) / members
+	s.observe(leases, s.now())
+
+	s.mu.Lock()
+	held := make(map[int]heldLease, len(s.held))
+	for shard, h := range s.held {
+		held[shard] = h
+	}
+	s.mu.Unlock()
+	for shard, h := range held {
+		s.renew(ctx, shard, h)
+	}
+
+	mine := s.heldShards()
+	for len(mine) > fair {
+		s.release(ctx, mine[len(mine)-1])
+		mine = mine[:len(mine)-1]
+	}
+	for shard := 0; shard < s.count && len(mine) < fair; shard++ {
+		if _, ok := held[shard]; ok {
+			continue
+		}
+		if s.acquire(ctx, shard, leases[s.leaseName(shard)]) {
+			mine = append(mine, shard)
+		}
+	}
+
+	metrics.set("ethereal_shards_owned", nil, float64(len(s.heldShards())))
+	metrics.set("ethereal_shard_members", nil, float64(members))
+}
+
+func (s *shardManager) heldShards() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shards := make([]int, 0, len(s.held))
+	for shard := range s.held {
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards
+}
+
+// heartbeat מחדשת את ה-Lease של החברות שלנו ומחזירה כמה replicas חיות בקבוצה (לפחות 1 - אנחנו)
+// ואת כל ה-Leases של הקבוצה לפי שם, כדי שהאיזון לא יצטרך לקרוא כל shard בנפרד
+func (s *shardManager) heartbeat(ctx context.Context) (int, map[string]*coordinationv1.Lease) {
+	leases := s.client.CoordinationV1().Leases(s.namespace)
+	now := metav1.NewMicroTime(s.now())
+	seconds := int32(s.duration.Seconds())
+
+	lease, err := leases.Get(ctx, s.memberName(), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: s.memberName(), Labels: map[string]string{labelShardGroup: s.group}},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &s.identity, LeaseDurationSeconds: &seconds, RenewTime: &now},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+	case err == nil:
+		lease.Spec.RenewTime = &now
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		slog.Warn("Failed to renew shard membership", "lease", s.memberName(), "error", err)
+	}
+
+	list, err := leases.List(ctx, metav1.ListOptions{LabelSelector: labelShardGroup + "=" + s.group})
+	if err != nil {
+		slog.Warn("Failed to list shard members", "group", s.group, "error", err)
+		return 1, nil
+	}
+	// החברות משמשת רק לאיזון, לא לבטיחות, אז השוואה לשעון המקומי מספיקה
+	members := 1
+	byName := map[string]*coordinationv1.Lease{}
+	for i := range list.Items {
+		l := &list.Items[i]
+		byName[l.Name] = l
+		if !strings.HasPrefix(l.Name, s.group+"-member-") || l.Name == s.memberName() || l.Spec.RenewTime == nil {
+			continue
+		}
+		age := s.now().Sub(l.Spec.RenewTime.Time)
+		switch {
+		case age < s.duration:
+			members++
+		case age > 10*s.duration:
+			// replica שנעלמה מזמן - מנקים כדי שה-Leases לא יצטברו
+			_ = leases.Delete(ctx, l.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &l.ResourceVersion}})
+		}
+	}
+	return members, byName
+}
+
+// observe זוכרת מתי ראינו לראשונה כל גרסה של Lease שמחזיקה replica אחרת
+func (s *shardManager) observe(leases map[string]*coordinationv1.Lease, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for shard := 0; shard < s.count; shard++ {
+		lease, ok := leases[s.leaseName(shard)]
+		if !ok {
+			delete(s.observed, shard)
+			continue
+		}
+		if seen, ok := s.observed[shard]; !ok || seen.resourceVersion != lease.ResourceVersion {
+			s.observed[shard] = observedLease{resourceVersion: lease.ResourceVersion, at: now}
+		}
+	}
+}
+
+// renew מחדשת Lease שבידינו. כישלון (למשל conflict כי מישהו לקח אותו) מוציא את ה-shard מהרשימה
+func (s *shardManager) renew(ctx context.Context, shard int, h heldLease) {
+	start := s.now()
+	lease := h.lease.DeepCopy()
+	now := metav1.NewMicroTime(start)
+	lease.Spec.RenewTime = &now
+	updated, err := s.client.CoordinationV1().Leases(s.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.held[shard] = heldLease{lease: updated, renewedAt: start}
+		return
+	}
+	if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+		slog.Warn("Lost shard lease", "shard", shard, "lease", s.leaseName(shard), "error", err)
+		delete(s.held, shard)
+		metrics.add("ethereal_shard_handoffs_total", map[string]string{"direction": "lost"}, 1)
+		return
+	}
+	// שגיאה זמנית: ה-Lease עדיין שלנו, אבל owns תפסיק לאשר כשיעבור renewDeadline
+	slog.Warn("Failed to renew shard lease", "shard", shard, "error", err)
+}
+
+// acquire לוקחת Lease פנוי, או Lease שלא השתנה במשך duration מאז שראינו אותו. lease הוא nil כשהוא לא קיים עדיין
+func (s *shardManager) acquire(ctx context.Context, shard int, lease *coordinationv1.Lease) bool {
+	leases := s.client.CoordinationV1().Leases(s.namespace)
+	start := s.now()
+	now := metav1.NewMicroTime(start)
+	seconds := int32(s.duration.Seconds())
+
+	if lease == nil {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: s.leaseName(shard), Labels: map[string]string{labelShardGroup: s.group}},
+			Spec: coordinationv1.LeaseSpec{HolderIdentity: &s.identity, LeaseDurationSeconds: &seconds,
+				AcquireTime: &now, RenewTime: &now, LeaseTransitions: ptr(int32(0))},
+		}
+		created, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+		if err != nil {
+			return false
+		}
+		s.took(shard, created, start)
+		return true
+	}
+	lease = lease.DeepCopy()
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != "" && holder != s.identity {
+		s.mu.Lock()
+		seen, ok := s.observed[shard]
+		s.mu.Unlock()
+		if !ok || seen.resourceVersion != lease.ResourceVersion || start.Sub(seen.at) < s.duration {
+			return false
+		}
+		slog.Info("Taking over expired shard lease", "shard", shard, "previousHolder", holder)
+	}
+
+	// ה-resourceVersion מה-Get מבטיח שרק replica אחת מצליחה לקחת אותו
+	lease.Spec.HolderIdentity = &s.identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	transitions := int32(0)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions
+	}
+	if holder != s.identity {
+		transitions++
+	}
+	lease.Spec.LeaseTransitions = &transitions
+	updated, err := leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return false
+	}
+	s.took(shard, updated, start)
+	return true
+}
+
+func (s *shardManager) took(shard int, lease *coordinationv1.Lease, renewedAt time.Time) {
+	s.mu.Lock()
+	s.held[shard] = heldLease{lease: lease, renewedAt: renewedAt}
+	delete(s.observed, shard)
+	s.mu.Unlock()
+	slog.Info("Acquired shard", "shard", shard, "lease", s.leaseName(shard), "identity", s.identity)
+	metrics.add("ethereal_shard_handoffs_total", map[string]string{"direction": "acquired"}, 1)
+}
+
+// release מוותרת על shard כדי ש-replica אחרת תוכל לקחת אותו מיד, בלי לחכות ל-duration.
+// קודם מפסיקים לטפל בו (מוציאים מ-held), ורק אז משחררים את ה-Lease
+func (s *shardManager) release(ctx context.Context, shard int) {
+	s.mu.Lock()
+	h, ok := s.held[shard]
+	delete(s.held, shard)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	lease := h.lease.DeepCopy()
+	lease.Spec.HolderIdentity = ptr("")
+	if _, err := s.client.CoordinationV1().Leases(s.namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		// ה-Lease יפוג בעצמו; עד אז אף אחד לא מטפל ב-shard, וזה בטוח
+		slog.Warn("Failed to release shard lease", "shard", shard, "error", err)
+	}
+	slog.Info("Released shard for rebalancing", "shard", shard, "lease", s.leaseName(shard))
+	metrics.add("ethereal_shard_handoffs_total", map[string]string{"direction": "released"}, 1)
+}
+
+// describe מחזירה את ה-shards שבידינו, ללוג
+func (s *shardManager) describe() string {
+	if s == nil {
+		return "all"
+	}
+	var parts []string
+	for _, shard := range s.heldShards() {
+		parts = append(parts, strconv.Itoa(shard))
+	}
+	return fmt.Sprintf("%s/%d", strings.Join(parts, ","), s.count)
+}
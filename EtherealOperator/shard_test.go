@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// leaseServer - ל-tracker המזויף אין optimistic concurrency, וכל ה-fencing נשען עליה:
+// update עם resourceVersion ישן נכשל ב-conflict כמו ב-API server. fail מדמה API server שלא עונה
+type leaseServer struct {
+	client  *kubefake.Clientset
+	version int
+	fail    error
+}
+
+func newLeaseServer() *leaseServer {
+	s := &leaseServer{client: kubefake.NewSimpleClientset()}
+	leases := coordinationv1.SchemeGroupVersion.WithResource("leases")
+	s.client.PrependReactor("create", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		s.version++
+		action.(k8stesting.CreateAction).GetObject().(*coordinationv1.Lease).ResourceVersion = strconv.Itoa(s.version)
+		return false, nil, nil
+	})
+	s.client.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if s.fail != nil {
+			return true, nil, s.fail
+		}
+		lease := action.(k8stesting.UpdateAction).GetObject().(*coordinationv1.Lease).DeepCopy()
+		current, err := s.client.Tracker().Get(leases, lease.Namespace, lease.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if current.(*coordinationv1.Lease).ResourceVersion != lease.ResourceVersion {
+			return true, nil, apierrors.NewConflict(leases.GroupResource(), lease.Name, fmt.Errorf("the object has been modified"))
+		}
+		s.version++
+		lease.ResourceVersion = strconv.Itoa(s.version)
+		return true, lease, s.client.Tracker().Update(leases, lease, lease.Namespace)
+	})
+	return s
+}
+
+// replica - replica של האופרטור עם שעון משותף לכל הבדיקה
+func (s *leaseServer) replica(identity string, clock *time.Time) *shardManager {
+	return &shardManager{
+		client: s.client, namespace: "default", group: "ethereal", identity: identity, count: 2,
+		duration: 30 * time.Second, renewDeadline: 20 * time.Second,
+		now:  func() time.Time { return *clock },
+		held: map[int]heldLease{}, observed: map[int]observedLease{},
+	}
+}
+
+// inShard מחזירה EtherealPod שנופל ב-shard המבוקש
+func inShard(t *testing.T, shard, count int) unstructured.Unstructured {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		item := unstructured.Unstructured{}
+		item.SetNamespace("default")
+		item.SetName(fmt.Sprintf("ghost-%d", i))
+		if shardOf(item, count) == shard {
+			return item
+		}
+	}
+	t.Fatalf("no name hashes to shard %d", shard)
+	return unstructured.Unstructured{}
+}
+
+func TestShardFencing(t *testing.T) {
+	ctx := context.Background()
+	item := inShard(t, 0, 2)
+
+	t.Run("failing renewals stop ownership at renewDeadline", func(t *testing.T) {
+		clock := time.Now()
+		server := newLeaseServer()
+		a := server.replica("a", &clock)
+		a.sync(ctx)
+		if !a.owns(ctx, item) {
+			t.Fatal("a does not own the shard it just acquired")
+		}
+
+		server.fail = apierrors.NewServiceUnavailable("etcd is down")
+		clock = clock.Add(15 * time.Second)
+		if !a.owns(ctx, item) {
+			t.Error("a transient error dropped the shard before renewDeadline")
+		}
+		clock = clock.Add(6 * time.Second)
+		if a.owns(ctx, item) {
+			t.Error("a still owns the shard after renewDeadline without a successful renewal")
+		}
+	})
+
+	t.Run("work still running at renewDeadline is cancelled", func(t *testing.T) {
+		clock := time.Now()
+		server := newLeaseServer()
+		a := server.replica("a", &clock)
+		a.sync(ctx)
+
+		// החידושים נכשלים, וה-reconcile מתחיל רגע לפני ה-deadline
+		server.fail = apierrors.NewServiceUnavailable("etcd is down")
+		clock = clock.Add(20*time.Second - 50*time.Millisecond)
+		fenced, cancel, ok := a.fence(ctx, item)
+		defer cancel()
+		if !ok {
+			t.Fatal("a does not own the shard before renewDeadline")
+		}
+		if fenced.Err() != nil {
+			t.Fatal("the fenced context is cancelled before renewDeadline")
+		}
+
+		// ה-reconcile נתקע בקריאה איטית, והשעון עובר את ה-deadline בזמן שהוא רץ
+		select {
+		case <-fenced.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("a write after renewDeadline would still go through")
+		}
+		clock = clock.Add(time.Second)
+		if a.owns(ctx, item) {
+			t.Error("a still owns the shard after renewDeadline")
+		}
+	})
+
+	t.Run("conflict on renew drops the shard at once", func(t *testing.T) {
+		clock := time.Now()
+		server := newLeaseServer()
+		a := server.replica("a", &clock)
+		a.sync(ctx)
+
+		server.fail = apierrors.NewConflict(coordinationv1.Resource("leases"), a.leaseName(0), fmt.Errorf("taken"))
+		clock = clock.Add(11 * time.Second)
+		if a.owns(ctx, item) {
+			t.Error("a owns the shard after its renewal conflicted")
+		}
+		if _, held := a.held[0]; held {
+			t.Error("the conflicting lease is still held")
+		}
+	})
+
+	t.Run("takeover only after the lease is unchanged for a full duration", func(t *testing.T) {
+		clock := time.Now()
+		server := newLeaseServer()
+		a, b := server.replica("a", &clock), server.replica("b", &clock)
+		a.sync(ctx)
+		b.sync(ctx)
+		if b.owns(ctx, item) {
+			t.Fatal("b took a live lease")
+		}
+
+		// a חי ומחדש: כל חידוש מאפס את מה ש-b ראה
+		clock = clock.Add(15 * time.Second)
+		a.sync(ctx)
+		clock = clock.Add(16 * time.Second)
+		b.sync(ctx)
+		if b.owns(ctx, item) {
+			t.Fatal("b took a lease that was renewed 16s ago")
+		}
+
+		// a נתקע: b רואה את אותה גרסה duration שלם ולוקח
+		clock = clock.Add(31 * time.Second)
+		b.sync(ctx)
+		if !b.owns(ctx, item) {
+			t.Fatal("b did not take over a lease unchanged for a full duration")
+		}
+		// a חוזר לחיים: החידוש שלו נכשל ב-conflict, והוא מפסיק לטפל
+		if a.owns(ctx, item) {
+			t.Error("a and b both own the shard")
+		}
+	})
+}
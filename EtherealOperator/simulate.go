@@ -0,0 +1,637 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeCluster - ה-clients המזויפים של client-go, עם מה שחסר ל-tracker שלהם כדי להריץ את האופרטור:
+// generateName/UID/creationTimestamp ביצירה, ו-server-side apply (ה-tracker של v0.29 לא יודע ליצור בו)
+type fakeCluster struct {
+	client *kubefake.Clientset
+	dyn    *dynamicfake.FakeDynamicClient
+}
+
+// fakeSeq משותף לכל האשכולות המזויפים בתהליך, כדי ש-UIDs לא יחזרו בין סימולציות (ה-cache של statuses לפי UID)
+var fakeSeq int64
+
+func newFakeCluster() *fakeCluster {
+	listKinds := map[schema.GroupVersionResource]string{
+		gvr:                     "EtherealPodList",
+		healingPolicyGVR:        "HealingPolicyList",
+		clusterHealingPolicyGVR: "ClusterHealingPolicyList",
+		healingRecordGVR:        "HealingRecordList",
+		clusterTargetGVR:        "ClusterTargetList",
+	}
+	c := &fakeCluster{
+		client: kubefake.NewSimpleClientset(),
+		dyn:    dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds),
+	}
+
+	c.client.PrependReactor("create", "*", fillCreated)
+	c.client.PrependReactor("patch", "*", applyReactor(c.client.Tracker(), func(m map[string]interface{}) (runtime.Object, error) {
+		obj, err := scheme.Scheme.New(schema.FromAPIVersionAndKind(fmt.Sprint(m["apiVersion"]), fmt.Sprint(m["kind"])))
+		if err != nil {
+			return nil, err
+		}
+		return obj, runtime.DefaultUnstructuredConverter.FromUnstructured(m, obj)
+	}))
+	c.dyn.PrependReactor("create", "*", fillCreated)
+	c.dyn.PrependReactor("patch", "*", applyReactor(c.dyn.Tracker(), func(m map[string]interface{}) (runtime.Object, error) {
+		return &unstructured.Unstructured{Object: m}, nil
+	}))
+	return c
+}
+
+// resetOperatorState מאפסת את מה שהאופרטור זוכר בין סבבים, כדי שכל סימולציה (או בדיקה) תתחיל מאפס
+func resetOperatorState() {
+	statuses = &ownedStatus{byUID: map[types.UID]map[string]interface{}{}}
+	healingRecords = newHealingRecorder()
+	notifications = newNotifier()
+	shards = nil
+	clusters = &clusterRegistry{targets: map[string]*clusterTarget{}}
+	disruptionBudgets = &appliedBudgets{byUID: map[types.UID]string{}}
+	homeCluster = ""
+}
+
+// fillCreated משלימה את מה שה-API server ממלא ביצירה, ומשאירה את היצירה עצמה ל-reactor הרגיל
+func fillCreated(action k8stesting.Action) (bool, runtime.Object, error) {
+	if create, ok := action.(k8stesting.CreateAction); ok {
+		fillMeta(create.GetObject())
+	}
+	return false, nil, nil
+}
+
+func fillMeta(obj runtime.Object) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	seq := atomic.AddInt64(&fakeSeq, 1)
+	if m.GetName() == "" && m.GetGenerateName() != "" {
+		m.SetName(fmt.Sprintf("%s%05d", m.GetGenerateName(), seq))
+	}
+	if m.GetUID() == "" {
+		m.SetUID(types.UID(fmt.Sprintf("00000000-0000-0000-0000-%012d", seq)))
+	}
+	if created := m.GetCreationTimestamp(); created.IsZero() {
+		m.SetCreationTimestamp(metav1.Now())
+	}
+	if m.GetGeneration() == 0 {
+		m.SetGeneration(1)
+	}
+}
+
+// applyReactor - server-side apply פשוט: יוצר אם חסר, אחרת merge של מה שנשלח. ב-status מחליף את כל ה-status,
+// וזה מספיק כי האופרטור תמיד שולח את כל השדות שבבעלותו (statuses.merge)
+func applyReactor(tracker k8stesting.ObjectTracker, decode func(map[string]interface{}) (runtime.Object, error)) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		var applied map[string]interface{}
+		if err := utiljson.Unmarshal(patch.GetPatch(), &applied); err != nil {
+			return true, nil, apierrors.NewBadRequest(err.Error())
+		}
+		resource, ns, name := patch.GetResource(), patch.GetNamespace(), patch.GetName()
+
+		existing, err := tracker.Get(resource, ns, name)
+		if apierrors.IsNotFound(err) && patch.GetSubresource() == "" {
+			obj, err := decode(applied)
+			if err != nil {
+				return true, nil, apierrors.NewBadRequest(err.Error())
+			}
+			fillMeta(obj)
+			if err := tracker.Create(resource, obj, ns); err != nil {
+				return true, nil, err
+			}
+			return true, obj, nil
+		}
+		if err != nil {
+			return true, nil, err
+		}
+
+		current, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+		if err != nil {
+			return true, nil, err
+		}
+		if patch.GetSubresource() == "status" {
+			current["status"] = applied["status"]
+		} else {
+			current = mergeJSON(current, applied)
+		}
+		obj, err := decode(current)
+		if err != nil {
+			return true, nil, apierrors.NewBadRequest(err.Error())
+		}
+		if err := tracker.Update(resource, obj, ns); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	}
+}
+
+// scenario - קובץ ה-YAML של --simulate: רשימת צעדים שרצים לפי הסדר
+type scenario struct {
+	Steps []scenarioStep `json:"steps"`
+}
+
+// scenarioStep - בדיוק שדה אחד מוגדר בכל צעד
+type scenarioStep struct {
+	Apply     map[string]interface{} `json:"apply,omitempty"`
+	Reconcile int                    `json:"reconcile,omitempty"`
+	DeletePod *podAction             `json:"deletePod,omitempty"`
+	FailPod   *podAction             `json:"failPod,omitempty"`
+	SetImage  *imageChange           `json:"setImage,omitempty"`
+	Expect    *expectation           `json:"expect,omitempty"`
+}
+
+// podAction בוחרת פוד חי של EtherealPod לפי index (לפי סדר השמות)
+type podAction struct {
+	EtherealPod string `json:"etherealPod"`
+	Namespace   string `json:"namespace,omitempty"`
+	Index       int    `json:"index,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	ExitCode    int32  `json:"exitCode,omitempty"`
+}
+
+type imageChange struct {
+	EtherealPod string `json:"etherealPod"`
+	Namespace   string `json:"namespace,omitempty"`
+	Image       string `json:"image"`
+}
+
+// expectation - בדיקות על המצב אחרי הצעדים הקודמים. שדה שלא הוגדר לא נבדק
+type expectation struct {
+	EtherealPod   string  `json:"etherealPod"`
+	Namespace     string  `json:"namespace,omitempty"`
+	Pods          *int    `json:"pods,omitempty"`
+	Ready         *int    `json:"ready,omitempty"`
+	Available     string  `json:"available,omitempty"`
+	Resurrections *int64  `json:"resurrections,omitempty"`
+	Image         string  `json:"image,omitempty"`
+	WaitingReason *string `json:"waitingReason,omitempty"`
+	Event         string  `json:"event,omitempty"`
+}
+
+var errExpectation = errors.New("expectation failed")
+
+func parseScenario(data []byte) (*scenario, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var s scenario
+	if err := utiljson.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Steps) == 0 {
+		return nil, errors.New("scenario has no steps")
+	}
+	return &s, nil
+}
+
+// runSimulation מריצה תרחיש מול אשכול מזויף בזיכרון ומדפיסה את הפעולות של האופרטור ואת ציר הזמן של ה-status.
+// קוד יציאה 1 כשבדיקת expect נכשלה, 2 כשהתרחיש עצמו שבור
+func runSimulation(path string, out io.Writer) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	sc, err := parseScenario(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 2
+	}
+
+	// הפלט הוא ציר הזמן; לוגים רק כשמשהו השתבש
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	// שמות פודים קבועים בין הרצות, כדי שאפשר יהיה להשוות פלט
+	nameRand = rand.New(rand.NewSource(1))
+	resetOperatorState()
+
+	cluster := newFakeCluster()
+	sim := &simulation{
+		cluster: cluster,
+		loop: &operatorLoop{
+			client: cluster.client, dyn: cluster.dyn,
+			limiter: newResurrectionLimiter(0, 0, 0), chaos: newChaosController(),
+			recordMaxCount: 100,
+		},
+		out:     out,
+		printed: map[string]string{},
+	}
+
+	failed := 0
+	for i, step := range sc.Steps {
+		err := sim.run(context.Background(), i+1, step)
+		switch {
+		case errors.Is(err, errExpectation):
+			failed++
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: step %d: %v\n", path, i+1, err)
+			return 2
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "%d expectation(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+type simulation struct {
+	cluster *fakeCluster
+	loop    *operatorLoop
+	out     io.Writer
+	passes  int
+	// השורה האחרונה שהודפסה לכל EtherealPod, כדי להדפיס רק שינויים
+	printed map[string]string
+}
+
+func (s *simulation) run(ctx context.Context, n int, step scenarioStep) error {
+	switch {
+	case step.Apply != nil:
+		obj := &unstructured.Unstructured{Object: step.Apply}
+		fmt.Fprintf(s.out, "step %d: apply %s %s\n", n, obj.GetKind(), obj.GetName())
+		return s.apply(ctx, obj)
+	case step.Reconcile > 0:
+		fmt.Fprintf(s.out, "step %d: reconcile x%d\n", n, step.Reconcile)
+		for i := 0; i < step.Reconcile; i++ {
+			if err := s.pass(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	case step.DeletePod != nil:
+		pod, err := s.pod(ctx, step.DeletePod)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "step %d: delete pod %s\n", n, pod.Name)
+		return s.cluster.client.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("pods"), pod.Namespace, pod.Name)
+	case step.FailPod != nil:
+		pod, err := s.pod(ctx, step.FailPod)
+		if err != nil {
+			return err
+		}
+		reason, code := step.FailPod.Reason, step.FailPod.ExitCode
+		if reason == "" {
+			reason = "Error"
+		}
+		if code == 0 {
+			code = 1
+		}
+		fmt.Fprintf(s.out, "step %d: fail pod %s (%s, exit code %d)\n", n, pod.Name, reason, code)
+		failPod(pod, reason, code)
+		return s.cluster.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, pod.Namespace)
+	case step.SetImage != nil:
+		fmt.Fprintf(s.out, "step %d: set image of %s to %s\n", n, step.SetImage.EtherealPod, step.SetImage.Image)
+		item, err := s.etherealPod(ctx, step.SetImage.Namespace, step.SetImage.EtherealPod)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(item.Object, step.SetImage.Image, "spec", "image"); err != nil {
+			return err
+		}
+		item.SetGeneration(item.GetGeneration() + 1)
+		return s.cluster.dyn.Tracker().Update(gvr, item, item.GetNamespace())
+	case step.Expect != nil:
+		return s.expect(ctx, n, step.Expect)
+	}
+	return errors.New("empty step")
+}
+
+// apply יוצרת או מעדכנת אובייקט כמו kubectl apply, בלי לגעת ב-status שהאופרטור כתב
+func (s *simulation) apply(ctx context.Context, obj *unstructured.Unstructured) error {
+	var resource schema.GroupVersionResource
+	switch obj.GetKind() {
+	case "EtherealPod":
+		resource = gvr
+	case "HealingPolicy":
+		resource = healingPolicyGVR
+	case "ClusterHealingPolicy":
+		resource = clusterHealingPolicyGVR
+	case "ConfigMap", "Secret":
+		resource = corev1.SchemeGroupVersion.WithResource(strings.ToLower(obj.GetKind()) + "s")
+	default:
+		return fmt.Errorf("unsupported kind %q", obj.GetKind())
+	}
+	if obj.GetNamespace() == "" && obj.GetKind() != "ClusterHealingPolicy" {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+
+	if resource.Group == "" {
+		typed, err := scheme.Scheme.New(obj.GroupVersionKind())
+		if err != nil {
+			return err
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+			return err
+		}
+		tracker := s.cluster.client.Tracker()
+		if _, err := tracker.Get(resource, obj.GetNamespace(), obj.GetName()); apierrors.IsNotFound(err) {
+			fillMeta(typed)
+			return tracker.Create(resource, typed, obj.GetNamespace())
+		}
+		return tracker.Update(resource, typed, obj.GetNamespace())
+	}
+
+	tracker := s.cluster.dyn.Tracker()
+	existing, err := tracker.Get(resource, obj.GetNamespace(), obj.GetName())
+	if apierrors.IsNotFound(err) {
+		fillMeta(obj)
+		return tracker.Create(resource, obj, obj.GetNamespace())
+	}
+	if err != nil {
+		return err
+	}
+	current := existing.(*unstructured.Unstructured)
+	obj.SetUID(current.GetUID())
+	obj.SetCreationTimestamp(current.GetCreationTimestamp())
+	obj.SetGeneration(current.GetGeneration() + 1)
+	if status, ok := current.Object["status"]; ok {
+		obj.Object["status"] = status
+	}
+	return tracker.Update(resource, obj, obj.GetNamespace())
+}
+
+// pass מריצה סבב אחד של האופרטור ומדפיסה את מה שהוא כתב, ואחריו "kubelet" שמריץ את הפודים החדשים
+func (s *simulation) pass(ctx context.Context) error {
+	s.cluster.client.ClearActions()
+	s.cluster.dyn.ClearActions()
+	if err := s.loop.pass(ctx); err != nil {
+		return err
+	}
+	s.passes++
+	fmt.Fprintf(s.out, "  pass %d\n", s.passes)
+
+	actions := append(s.cluster.client.Actions(), s.cluster.dyn.Actions()...)
+	for _, action := range actions {
+		if line, ok := describeAction(action); ok {
+			fmt.Fprintf(s.out, "    %s\n", line)
+		}
+	}
+
+	if err := s.cluster.kubelet(ctx); err != nil {
+		return err
+	}
+	return s.timeline(ctx)
+}
+
+// describeAction - שורה לכל כתיבה של האופרטור. status נראה בציר הזמן, ו-Leases הם לא פעולות על האפליקציה
+func describeAction(action k8stesting.Action) (string, bool) {
+	resource := action.GetResource().Resource
+	if resource == "leases" || action.GetSubresource() != "" {
+		return "", false
+	}
+	switch a := action.(type) {
+	case k8stesting.CreateAction:
+		if event, ok := a.GetObject().(*corev1.Event); ok {
+			return fmt.Sprintf("event %s/%s %s %s: %s", event.Namespace, event.InvolvedObject.Name, event.Type, event.Reason, event.Message), true
+		}
+		m, err := meta.Accessor(a.GetObject())
+		if err != nil {
+			return "", false
+		}
+		name := m.GetName()
+		if name == "" {
+			name = m.GetGenerateName() + "*"
+		}
+		return fmt.Sprintf("create %s %s/%s", resource, a.GetNamespace(), name), true
+	case k8stesting.PatchAction:
+		verb := "patch"
+		if a.GetPatchType() == types.ApplyPatchType {
+			verb = "apply"
+		}
+		return fmt.Sprintf("%s %s %s/%s", verb, resource, a.GetNamespace(), a.GetName()), true
+	case k8stesting.UpdateAction:
+		m, err := meta.Accessor(a.GetObject())
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("update %s %s/%s", resource, a.GetNamespace(), m.GetName()), true
+	case k8stesting.DeleteAction:
+		return fmt.Sprintf("delete %s %s/%s", resource, a.GetNamespace(), a.GetName()), true
+	}
+	return "", false
+}
+
+// kubelet מזויף: כל פוד בלי phase עולה מיד ל-Running ו-Ready. עובד ישירות מול ה-tracker,
+// כדי שלא ייראה כפעולה של האופרטור
+func (c *fakeCluster) kubelet(ctx context.Context) error {
+	pods, err := c.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.StartTime = &now
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: now}}
+		for _, c := range pod.Spec.Containers {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name: c.Name, Image: c.Image, Ready: true,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: now}},
+			})
+		}
+		if err := c.client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, pod.Namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func failPod(pod *corev1.Pod, reason string, code int32) {
+	now := metav1.Now()
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse, LastTransitionTime: now}}
+	for i := range pod.Status.ContainerStatuses {
+		pod.Status.ContainerStatuses[i].Ready = false
+		pod.Status.ContainerStatuses[i].State = corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: code, Reason: reason, FinishedAt: now,
+		}}
+	}
+}
+
+// timeline מדפיסה שורת מצב לכל EtherealPod שהמצב שלו השתנה מאז הסבב הקודם
+func (s *simulation) timeline(ctx context.Context) error {
+	list, err := s.cluster.dyn.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		pods, err := s.livePods(ctx, item)
+		if err != nil {
+			return err
+		}
+		ready, _, _ := unstructured.NestedInt64(item.Object, "status", "readyReplicas")
+		resurrections, _, _ := unstructured.NestedInt64(item.Object, "status", "resurrections")
+		line := fmt.Sprintf("%d pods, %d ready, Available=%s, resurrections=%d, image=%s",
+			len(pods), ready, availableStatus(item), resurrections, podImages(pods))
+		if waiting, _, _ := unstructured.NestedString(item.Object, "status", "waitingReason"); waiting != "" {
+			line += ", waiting=" + waiting
+		}
+		key := item.GetNamespace() + "/" + item.GetName()
+		if s.printed[key] != line {
+			s.printed[key] = line
+			fmt.Fprintf(s.out, "    status %s: %s\n", key, line)
+		}
+	}
+	return nil
+}
+
+func (s *simulation) expect(ctx context.Context, n int, e *expectation) error {
+	item, err := s.etherealPod(ctx, e.Namespace, e.EtherealPod)
+	if err != nil {
+		return err
+	}
+	pods, err := s.livePods(ctx, *item)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	check := func(field string, got, want interface{}) {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			failures = append(failures, fmt.Sprintf("%s = %v, want %v", field, got, want))
+		}
+	}
+	if e.Pods != nil {
+		check("pods", len(pods), *e.Pods)
+	}
+	if e.Ready != nil {
+		ready, _, _ := unstructured.NestedInt64(item.Object, "status", "readyReplicas")
+		check("ready", ready, *e.Ready)
+	}
+	if e.Available != "" {
+		check("available", availableStatus(*item), e.Available)
+	}
+	if e.Resurrections != nil {
+		resurrections, _, _ := unstructured.NestedInt64(item.Object, "status", "resurrections")
+		check("resurrections", resurrections, *e.Resurrections)
+	}
+	if e.Image != "" {
+		check("image", podImages(pods), e.Image)
+	}
+	if e.WaitingReason != nil {
+		waiting, _, _ := unstructured.NestedString(item.Object, "status", "waitingReason")
+		check("waitingReason", waiting, *e.WaitingReason)
+	}
+	if e.Event != "" {
+		events, err := s.cluster.client.CoreV1().Events(item.GetNamespace()).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, event := range events.Items {
+			found = found || (event.InvolvedObject.Name == item.GetName() && event.Reason == e.Event)
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("no %s event", e.Event))
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(s.out, "step %d: expect %s: FAIL: %s\n", n, item.GetName(), strings.Join(failures, "; "))
+		return errExpectation
+	}
+	fmt.Fprintf(s.out, "step %d: expect %s: ok\n", n, item.GetName())
+	return nil
+}
+
+func (s *simulation) etherealPod(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return s.cluster.dyn.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// livePods - הפודים של ה-EtherealPod שלא הסתיימו, לפי סדר השמות
+func (s *simulation) livePods(ctx context.Context, item unstructured.Unstructured) ([]corev1.Pod, error) {
+	list, err := s.cluster.client.CoreV1().Pods(item.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: labelEtherealPod + "=" + item.GetName()})
+	if err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase != corev1.PodFailed && pod.Status.Phase != corev1.PodSucceeded && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+func (s *simulation) pod(ctx context.Context, a *podAction) (*corev1.Pod, error) {
+	item, err := s.etherealPod(ctx, a.Namespace, a.EtherealPod)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := s.livePods(ctx, *item)
+	if err != nil {
+		return nil, err
+	}
+	if a.Index < 0 || a.Index >= len(pods) {
+		return nil, fmt.Errorf("%s has %d live pods, no pod at index %d", a.EtherealPod, len(pods), a.Index)
+	}
+	return &pods[a.Index], nil
+}
+
+func availableStatus(item unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, c := range conditions {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == conditionAvailable {
+			return fmt.Sprint(m["status"])
+		}
+	}
+	return "Unknown"
+}
+
+// podImages - התמונות של הפודים החיים, ממוינות, כדי לראות rollout באמצע
+func podImages(pods []corev1.Pod) string {
+	seen := map[string]bool{}
+	var images []string
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			if !seen[c.Image] {
+				seen[c.Image] = true
+				images = append(images, c.Image)
+			}
+		}
+	}
+	if len(images) == 0 {
+		return "-"
+	}
+	sort.Strings(images)
+	return strings.Join(images, ",")
+}
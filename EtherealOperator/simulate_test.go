@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// כל תרחיש ב-scenarios/ הוא גם בדיקת רגרסיה: ה-expect שלו צריכים לעבור
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob("scenarios/*.yaml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scenarios found: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			var out bytes.Buffer
+			if code := runSimulation(file, &out); code != 0 {
+				t.Errorf("exit code %d:\n%s", code, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// patchStatus מעדכנת שדות ב-status של EtherealPod. העדכון הוא חלקי כמו merge patch (nil מוחק שדה),
+// אבל נשלח ב-server-side apply יחד עם כל שאר ה-status שהאופרטור מנהל
+func patchStatus(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, status map[string]interface{}) error {
+	return applyStatusOf(ctx, dyn.Resource(gvr).Namespace(item.GetNamespace()), item, statuses.merge(item, status))
+}
+
+// setConditions מעדכנת conditions בסגנון metav1.Condition ב-status.conditions.
+// lastTransitionTime משתנה רק כשה-status של ה-condition משתנה, ו-patch נשלח רק כשמשהו השתנה
+func setConditions(ctx context.Context, dyn dynamic.Interface, item unstructured.Unstructured, conditions ...metav1.Condition) error {
+	existing, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	now := time.Now().UTC().Format(time.RFC3339)
+	changed := false
+
+	for _, c := range conditions {
+		idx := -1
+		for i, e := range existing {
+			if m, ok := e.(map[string]interface{}); ok && m["type"] == c.Type {
+				idx = i
+				break
+			}
+		}
+
+		updated := map[string]interface{}{
+			"type":               c.Type,
+			"status":             string(c.Status),
+			"reason":             c.Reason,
+			"message":            c.Message,
+			"lastTransitionTime": now,
+		}
+		if idx < 0 {
+			existing = append(existing, updated)
+			changed = true
+			continue
+		}
+
+		old := existing[idx].(map[string]interface{})
+		if old["status"] == updated["status"] && old["reason"] == updated["reason"] && old["message"] == updated["message"] {
+			continue
+		}
+		if old["status"] == updated["status"] {
+			updated["lastTransitionTime"] = old["lastTransitionTime"]
+		}
+		existing[idx] = updated
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	// העדכון נשמר גם בעותק שבזיכרון, כדי שקריאות נוספות באותו סבב יראו אותו
+	if err := unstructured.SetNestedSlice(item.Object, existing, "status", "conditions"); err != nil {
+		return err
+	}
+	return patchStatus(ctx, dyn, item, map[string]interface{}{"conditions": existing})
+}
+
+// conditionStatus מחזירה את ה-status של condition לפי סוג, או "" אם הוא לא קיים
+func conditionStatus(item unstructured.Unstructured, conditionType string) metav1.ConditionStatus {
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, c := range conditions {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == conditionType {
+			s, _ := m["status"].(string)
+			return metav1.ConditionStatus(s)
+		}
+	}
+	return ""
+}
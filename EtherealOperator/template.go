@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"log/slog"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	annotationTemplateHash = "sunday.com/template-hash"
+	annotationConfigHash   = "sunday.com/config-hash"
+
+	// על ה-EtherealPod: "true" מבטל החלפת פוד כששינוי ב-ConfigMap/Secret
+	annotationIgnoreConfigChanges = "sunday.com/ignore-config-changes"
+)
+
+// podTemplate הוא מה שהאופרטור רוצה שירוץ, כפי שנגזר מה-spec (ומה-status, למשל autoTune)
+type podTemplate struct {
+	image      string
+	resources  corev1.ResourceRequirements
+	env        []corev1.EnvVar
+	envFrom    []corev1.EnvFromSource
+	configHash string
+	// restartedAt - restart מתוזמן; שינוי שלו מחליף את הפודים כמו כל שינוי בתבנית
+	restartedAt string
+	// probes הן nil כשאין spec.healthCheck, ואז הפוד מקבל את ה-liveness הקבוע
+	probes *probeSet
+	// active היא בדיקה של האופרטור ולא חלק מהפוד, ולכן לא נכנסת ל-hash
+	active *activeCheck
+	// placement היא nil בלי spec.placement, כדי שה-hash של פודים קיימים לא ישתנה
+	placement *podPlacement
+	// avoidNode - ה-node שבגללו הפוד הקודם נפל. רק להתחייה הבאה, ולכן לא ב-hash
+	avoidNode string
+	// ttl - spec.ttl: אחרי כמה זמן פוד ממוחזר. לא ב-hash, כי הוא לא משנה את הפוד עצמו
+	ttl time.Duration
+	// adopted - ה-snapshot של פוד שאומץ דרך spec.selector; כשהוא קיים הוא התבנית במקום שדות ה-spec
+	adopted *adoptedTemplate
+}
+
+// desiredTemplate בונה את התבנית מה-spec
+func desiredTemplate(item unstructured.Unstructured, spec map[string]interface{}) podTemplate {
+	// הגדרת ברירת מחדל לאימג' אם לא צוין ב-CR
+	image, _, _ := unstructured.NestedString(spec, "image")
+	if image == "" {
+		image = "sunday-app:v2"
+	}
+
+	t := podTemplate{image: image, resources: tunedResources(item, podResources(spec))}
+	t.restartedAt, _, _ = unstructured.NestedString(item.Object, "status", "restartedAt")
+	if ttl, found, _ := unstructured.NestedInt64(spec, "ttl"); found && ttl > 0 {
+		t.ttl = time.Duration(ttl) * time.Second
+	}
+	var err error
+	if t.placement, err = parsePlacement(spec); err != nil {
+		slog.Warn("Ignoring invalid spec.placement", "name", item.GetName(), "error", err)
+	}
+	if t.adopted = readAdoptedTemplate(item); t.adopted != nil {
+		t.image, t.resources = "", corev1.ResourceRequirements{}
+		if len(t.adopted.Spec.Containers) > 0 {
+			t.image = t.adopted.Spec.Containers[0].Image
+		}
+		return t
+	}
+
+	// env ו-envFrom באותו מבנה כמו בקונטיינר, אז ממירים דרך corev1.Container
+	var container corev1.Container
+	if err := fromUnstructured(map[string]interface{}{"env": spec["env"], "envFrom": spec["envFrom"]}, &container); err != nil {
+		slog.Warn("Ignoring invalid spec.env/spec.envFrom", "name", item.GetName(), "error", err)
+	} else {
+		t.env, t.envFrom = container.Env, container.EnvFrom
+	}
+
+	probes, active, err := parseHealthCheck(spec)
+	if err != nil {
+		slog.Warn("Ignoring invalid spec.healthCheck", "name", item.GetName(), "error", err)
+	} else {
+		t.probes, t.active = probes, active
+	}
+
+	return t
+}
+
+// hash מזהה את התבנית (בלי תוכן הקונפיגורציה, שיש לו hash משלו)
+func (t podTemplate) hash() string {
+	data, _ := json.Marshal(struct {
+		Image       string                      `json:"image"`
+		Resources   corev1.ResourceRequirements `json:"resources"`
+		Env         []corev1.EnvVar             `json:"env,omitempty"`
+		EnvFrom     []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+		RestartedAt string                      `json:"restartedAt,omitempty"`
+		Probes      *probeSet                   `json:"probes,omitempty"`
+		Placement   *podPlacement               `json:"placement,omitempty"`
+		Adopted     *adoptedTemplate            `json:"adopted,omitempty"`
+	}{t.image, t.resources, t.env, t.envFrom, t.restartedAt, t.probes, t.placement, t.adopted})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// annotations - מה שנרשם על הפוד כדי ש-detectDrift תדע לפי איזו תבנית הוא רץ
+func (t podTemplate) annotations() map[string]string {
+	annotations := map[string]string{
+		annotationTemplateHash: t.hash(),
+		annotationConfigHash:   t.configHash,
+	}
+	if t.restartedAt != "" {
+		annotations[annotationPodRestartedAt] = t.restartedAt
+	}
+	return annotations
+}
+
+// configRefs מחזירה את כל ה-ConfigMaps וה-Secrets שהתבנית מפנה אליהם
+func (t podTemplate) configRefs() (configMaps, secrets []string) {
+	cms, scs := map[string]bool{}, map[string]bool{}
+	for _, e := range t.envFrom {
+		if e.ConfigMapRef != nil {
+			cms[e.ConfigMapRef.Name] = true
+		}
+		if e.SecretRef != nil {
+			scs[e.SecretRef.Name] = true
+		}
+	}
+	for _, e := range t.env {
+		if e.ValueFrom == nil {
+			continue
+		}
+		if e.ValueFrom.ConfigMapKeyRef != nil {
+			cms[e.ValueFrom.ConfigMapKeyRef.Name] = true
+		}
+		if e.ValueFrom.SecretKeyRef != nil {
+			scs[e.ValueFrom.SecretKeyRef.Name] = true
+		}
+	}
+	return sortedKeys(cms), sortedKeys(scs)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// computeConfigHash מגבבת את התוכן של כל ה-ConfigMaps וה-Secrets שהתבנית מפנה אליהם.
+// אובייקט חסר נכנס ל-hash כ"חסר", כך שגם יצירה שלו מאוחר יותר נחשבת שינוי
+func computeConfigHash(ctx context.Context, client kubernetes.Interface, namespace string, t podTemplate) (string, error) {
+	configMaps, secrets := t.configRefs()
+	if len(configMaps) == 0 && len(secrets) == 0 {
+		return "", nil
+	}
+
+	h := sha256.New()
+	for _, name := range configMaps {
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			h.Write([]byte("configmap/" + name + "/missing\n"))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		writeHashedData(h, "configmap/"+name, cm.Data, cm.BinaryData)
+	}
+	for _, name := range secrets {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			h.Write([]byte("secret/" + name + "/missing\n"))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		writeHashedData(h, "secret/"+name, secret.StringData, secret.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+func writeHashedData(h hash.Hash, prefix string, data map[string]string, binary map[string][]byte) {
+	keys := make([]string, 0, len(data)+len(binary))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	for k := range binary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		h.Write([]byte(prefix + "/" + k + "="))
+		if v, ok := data[k]; ok {
+			h.Write([]byte(v))
+		} else {
+			h.Write(binary[k])
+		}
+		h.Write([]byte{'\n'})
+	}
+}
+
+// containerProbes מחזירה את ה-probes של הקונטיינר, או את ה-liveness הקבוע כשאין spec.healthCheck
+func (t podTemplate) containerProbes() probeSet {
+	if t.probes == nil {
+		return probeSet{Liveness: defaultLivenessProbe()}
+	}
+	return *t.probes
+}
@@ -55,6 +55,7 @@ func main() {
 
 		c.Next()
 
+		httpMetrics.observe(path, c.Writer.Status(), time.Since(start))
 		slog.Info("HTTP Request",
 			"method", c.Request.Method,
 			"path", path,
@@ -119,6 +120,9 @@ func main() {
 		c.JSON(200, gin.H{"status": "alive"})
 	})
 
+	r.GET("/metrics", httpMetrics.serve)
+	r.GET("/status", statusHandler)
+
 	slog.Info("Server is ready and listening")
 	r.Run(":8080")
 }
\ No newline at end of file
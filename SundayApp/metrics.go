@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestMetrics סופרת בקשות לפי מחלקת סטטוס (2xx, 4xx, 5xx) ואת סך זמן הטיפול בהן.
+// האופרטור קורא אותן ב-/metrics כדי להשוות גרסת canary מול הגרסה היציבה
+type requestMetrics struct {
+	mu       sync.Mutex
+	requests map[string]int64
+	duration float64
+	count    int64
+
+	// recent הן הבקשות האחרונות (מעגלי), בשביל שיעור שגיאות ו-latency עדכניים ב-/status
+	recent [recentWindow]sample
+	next   int
+}
+
+type sample struct {
+	failed  bool
+	elapsed time.Duration
+}
+
+const recentWindow = 200
+
+var httpMetrics = &requestMetrics{requests: map[string]int64{}}
+
+// בדיקות החיות ו-scrape של המטריקות עצמן לא נספרים, אחרת הם מטשטשים את התנועה האמיתית
+var unmeteredPaths = map[string]bool{"/health": true, "/metrics": true, "/status": true}
+
+func (m *requestMetrics) observe(path string, status int, elapsed time.Duration) {
+	if unmeteredPaths[path] {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[fmt.Sprintf("%dxx", status/100)]++
+	m.duration += elapsed.Seconds()
+	m.count++
+	m.recent[m.next%recentWindow] = sample{failed: status >= 500, elapsed: elapsed}
+	m.next++
+}
+
+// recentStats מחזירה את מספר הבקשות האחרונות, כמה מהן נכשלו (5xx), ואת ה-latency הממוצע שלהן
+func (m *requestMetrics) recentStats() (total, failed int, avg time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total = min(m.next, recentWindow)
+	var sum time.Duration
+	for _, s := range m.recent[:total] {
+		if s.failed {
+			failed++
+		}
+		sum += s.elapsed
+	}
+	if total > 0 {
+		avg = sum / time.Duration(total)
+	}
+	return total, failed, avg
+}
+
+// serve כותבת את המונים בפורמט הטקסט של Prometheus
+func (m *requestMetrics) serve(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	classes := make([]string, 0, len(m.requests))
+	for class := range m.requests {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "# HELP sunday_http_requests_total HTTP requests handled, by status class.")
+	fmt.Fprintln(w, "# TYPE sunday_http_requests_total counter")
+	for _, class := range classes {
+		fmt.Fprintf(w, "sunday_http_requests_total{status=%q} %d\n", class, m.requests[class])
+	}
+	fmt.Fprintln(w, "# HELP sunday_http_request_duration_seconds Time spent handling HTTP requests.")
+	fmt.Fprintln(w, "# TYPE sunday_http_request_duration_seconds summary")
+	fmt.Fprintf(w, "sunday_http_request_duration_seconds_sum %g\n", m.duration)
+	fmt.Fprintf(w, "sunday_http_request_duration_seconds_count %d\n", m.count)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var startedAt = time.Now()
+
+// statusHandler הוא בדיקת בריאות מורחבת בשביל האופרטור: האם ה-DB זמין וכמה מהר,
+// ושיעור השגיאות וה-latency של הבקשות האחרונות. /health נשאר בדיקת חיות פשוטה ל-kubelet
+func statusHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	dbErr := db.PingContext(ctx)
+	if dbErr == nil {
+		var one int
+		dbErr = db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	}
+	dbLatency := time.Since(start)
+
+	database := gin.H{"reachable": dbErr == nil, "latencyMs": dbLatency.Milliseconds()}
+	if dbErr != nil {
+		database["error"] = dbErr.Error()
+	}
+
+	total, failed, avg := httpMetrics.recentStats()
+	ratio := 0.0
+	if total > 0 {
+		ratio = float64(failed) / float64(total)
+	}
+
+	status, code := "ok", http.StatusOK
+	if dbErr != nil {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":        status,
+		"uptimeSeconds": int64(time.Since(startedAt).Seconds()),
+		"db":            database,
+		"requests": gin.H{
+			"window":       total,
+			"errors":       failed,
+			"errorRatio":   ratio,
+			"avgLatencyMs": avg.Milliseconds(),
+		},
+	})
+}